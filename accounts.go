@@ -0,0 +1,149 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/auth"
+	"github.com/MediaExchange/mex/clients/plextv"
+	"github.com/MediaExchange/mex/clients/pms"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/plex"
+	"github.com/MediaExchange/mex/storage"
+	"strings"
+	"time"
+)
+
+const (
+	// Settings key holding the identifier MEX uses with plex.tv.
+	plexClientIdSetting = "plex.client_id"
+)
+
+// configureAuth applies the auth settings and creates the first admin from
+// the configuration if no users exist yet. Otherwise the first person to
+// open the UI is asked to create one.
+func configureAuth(conf *MexConfig, store *storage.Store) error {
+	if conf.Auth.SessionDays > 0 {
+		auth.SessionLifetime = time.Duration(conf.Auth.SessionDays) * 24 * time.Hour
+	}
+	auth.SecureCookies = conf.Auth.SecureCookies
+
+	required, err := auth.SetupRequired(store.Users)
+	if err != nil {
+		log.Error("Unable to count users", log.Err(err))
+		return err
+	}
+
+	if !required {
+		return nil
+	}
+
+	if len(conf.Auth.AdminUsername) == 0 || len(conf.Auth.AdminPassword) == 0 {
+		log.Warn("No users exist. Open MEX in a browser to create the first admin.")
+		return nil
+	}
+
+	if _, err := auth.CreateUser(store.Users, conf.Auth.AdminUsername, conf.Auth.AdminPassword, models.Admin); err != nil {
+		log.Error("Unable to create the first admin", log.Err(err))
+		return err
+	}
+	return nil
+}
+
+// configurePlex sets up signing in with Plex and the Plex Media Server. The
+// client identifier is generated once and kept in the database, because
+// Plex lists every new identifier as a separate device.
+func configurePlex(conf *MexConfig, store *storage.Store) error {
+	if len(conf.Plex.BaseUrl) > 0 {
+		plextv.BaseUri = strings.TrimRight(conf.Plex.BaseUrl, "/")
+	}
+	if len(conf.Plex.AppUrl) > 0 {
+		plextv.AppUri = strings.TrimRight(conf.Plex.AppUrl, "/")
+	}
+
+	auth.PlexServerId = conf.Plex.ServerId
+	pms.BaseUri = strings.TrimRight(conf.Plex.ServerUrl, "/")
+	pms.Token = conf.Plex.Token
+	if len(pms.BaseUri) > 0 && len(pms.Token) == 0 {
+		log.Warn("plex.server_url is set without plex.token; MEX won't talk to the Plex Media Server")
+	}
+	plex.WebhookSecret = conf.Plex.WebhookSecret
+	plex.Cleanup = plex.CleanupRules {
+		DeleteMovies:      conf.Plex.Cleanup.DeleteMovies,
+		DeleteEpisodes:    conf.Plex.Cleanup.DeleteEpisodes,
+		WaitForRequesters: conf.Plex.Cleanup.WaitForRequesters,
+		Delay:             cleanupDelay(conf),
+		MoviesDir:         conf.Import.MoviesDir,
+		TvDir:             conf.Import.TvDir,
+	}
+	if len(conf.Plex.DefaultRole) > 0 {
+		role := models.Role(conf.Plex.DefaultRole)
+		if !auth.ValidRole(role) {
+			log.Error("plex.default_role must be admin, requester or viewer", log.String("role", conf.Plex.DefaultRole))
+			return auth.ErrInvalidRole
+		}
+		auth.PlexDefaultRole = role
+	}
+
+	err := store.Settings.Get(plexClientIdSetting, &plextv.ClientId)
+	if err == storage.ErrNotFound {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		plextv.ClientId = "mex-" + hex.EncodeToString(buf)
+		err = store.Settings.Set(plexClientIdSetting, plextv.ClientId)
+	}
+	if err != nil {
+		log.Error("Unable to load the Plex client identifier", log.Err(err))
+		return err
+	}
+
+	return nil
+}
+
+// plexSyncInterval returns how often the Plex libraries are read, or 0 if
+// they aren't.
+func plexSyncInterval(conf *MexConfig) time.Duration {
+	switch {
+	case !pms.Configured() || conf.Plex.SyncInterval < 0:
+		return 0
+	case conf.Plex.SyncInterval > 0:
+		return seconds(conf.Plex.SyncInterval)
+	}
+	return time.Hour
+}
+
+// cleanupDelay returns how long after media is watched its files are
+// deleted.
+func cleanupDelay(conf *MexConfig) time.Duration {
+	if conf.Plex.Cleanup.Delay > 0 {
+		return seconds(conf.Plex.Cleanup.Delay)
+	}
+	return 24 * time.Hour
+}
+
+// expireSessions returns a function that deletes sessions that have expired.
+func expireSessions(store *storage.Store) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		if err := store.Sessions.DeleteExpired(time.Now()); err != nil {
+			log.Error("Unable to delete expired sessions", log.Err(err))
+		}
+	}
+}
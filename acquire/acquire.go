@@ -0,0 +1,500 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package acquire searches the indexers for wanted media and sends the best
+// release to a download client. A background job searches for every
+// monitored movie and wanted episode, and single items or seasons can be
+// searched on demand.
+//
+// TV shows are searched a season at a time when every aired episode of the
+// season is wanted, and an episode at a time otherwise. Episodes that are
+// already downloading are skipped.
+//
+// Between searches, the indexers' RSS feeds are read for new releases of
+// monitored items. Releases whose downloads fail are blocklisted and another
+// release is searched for.
+package acquire
+
+import (
+	"context"
+	"errors"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/blocklist"
+	"github.com/MediaExchange/mex/clients/download"
+	"github.com/MediaExchange/mex/clients/torznab"
+	"github.com/MediaExchange/mex/downloads"
+	"github.com/MediaExchange/mex/events"
+	"github.com/MediaExchange/mex/history"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/quality"
+	"github.com/MediaExchange/mex/releases"
+	"github.com/MediaExchange/mex/storage"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoIndexers is returned when searching without any indexers configured.
+	ErrNoIndexers = errors.New("acquire: no indexers are configured")
+
+	// ErrNoClients is returned when searching without any download clients configured.
+	ErrNoClients = errors.New("acquire: no download clients are configured")
+
+	// ErrUnavailable is returned when none of the indexers could be searched.
+	ErrUnavailable = errors.New("acquire: no indexer could be searched")
+
+	// ErrNoClient is returned when no download client handles a release's protocol.
+	ErrNoClient = errors.New("acquire: no download client is configured for the release's protocol")
+
+	// ErrUnknownSeason is returned when searching for a season the show doesn't have.
+	ErrUnknownSeason = errors.New("acquire: the show has no such season")
+
+	// ErrNotTv is returned when searching for a season of a movie.
+	ErrNotTv = errors.New("acquire: seasons can only be searched for TV shows")
+)
+
+var (
+	// Only one search runs at a time, so the same release isn't grabbed twice.
+	mutex sync.Mutex
+)
+
+// Run returns a function for services.NewTicker that searches for every
+// monitored item in the library.
+func Run(store *storage.Store) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		if len(torznab.Indexers()) == 0 || len(download.Clients()) == 0 {
+			return
+		}
+
+		items, err := store.Media.List()
+		if err != nil {
+			log.Error("acquire.Run: unable to list the library", log.Err(err))
+			return
+		}
+
+		for i := range items {
+			if ctx.Err() != nil {
+				return
+			}
+			if !items[i].Monitored {
+				continue
+			}
+			if _, err := sweep(ctx, store, items[i].Id); err != nil {
+				log.Warn("acquire.Run: search failed", log.String("id", items[i].Id), log.Err(err))
+			}
+		}
+	}
+}
+
+// sweep searches for one monitored item on behalf of Run. The lock is only
+// held for this item, so a manual search waits for at most one item instead
+// of the whole library.
+func sweep(ctx context.Context, store *storage.Store, id string) ([]models.History, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// The item may have changed since the library was listed.
+	item, err := store.Media.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !item.Monitored {
+		return nil, nil
+	}
+	return search(ctx, store, item, wanted)
+}
+
+// SearchItem searches now for a library item, whether or not it is
+// monitored: a movie that isn't downloaded, or the wanted episodes of a TV
+// show, along with upgrades of copies below the cutoff. It returns what was
+// grabbed.
+func SearchItem(store *storage.Store, id string) ([]models.History, error) {
+	if err := ready(); err != nil {
+		return nil, err
+	}
+
+	item, err := store.Media.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	return search(context.Background(), store, item, wanted)
+}
+
+// SearchSeason searches now for every episode of a season that isn't
+// downloaded, wanted or not. It returns what was grabbed.
+func SearchSeason(store *storage.Store, id string, season int) ([]models.History, error) {
+	if err := ready(); err != nil {
+		return nil, err
+	}
+
+	item, err := store.Media.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if item.Type != models.TvShow {
+		return nil, ErrNotTv
+	}
+
+	found := false
+	for _, e := range item.Episodes {
+		found = found || e.Season == season
+	}
+	if !found {
+		return nil, ErrUnknownSeason
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	return search(context.Background(), store, item, func(e *models.LibraryEpisode) bool {
+		return e.Season == season && e.State != models.Downloaded
+	})
+}
+
+// Grab sends a release chosen for a library item to the download client for
+// its protocol and records it as a download and in the history.
+func Grab(store *storage.Store, item *models.MediaItem, d *models.Decision, season int, episodes []int) (*models.History, error) {
+	r := &d.Release
+	c := download.ForProtocol(download.Protocol(r.Protocol))
+	if c == nil {
+		return nil, ErrNoClient
+	}
+
+	// Magnet links save the client a trip to the indexer.
+	url := r.DownloadUrl
+	if len(r.MagnetUrl) > 0 {
+		url = r.MagnetUrl
+	}
+
+	dl, err := send(store, c, item, d, url, season, episodes)
+	if err != nil {
+		return nil, err
+	}
+	events.Publish(events.DownloadAdded, dl.Public())
+
+	log.Info("acquire.Grab", log.String("mediaId", item.Id), log.String("release", r.Title), log.String("client", c.Name()))
+	return history.Record(store.History, models.History {
+		Type:       models.HistoryGrabbed,
+		MediaId:    item.Id,
+		Title:      item.Title,
+		Release:    r.Title,
+		Season:     season,
+		Episodes:   episodes,
+		Quality:    d.Quality,
+		Indexer:    r.Indexer,
+		DownloadId: dl.Id,
+	})
+}
+
+// send adds a release to a download client and saves the download.
+func send(store *storage.Store, c download.DownloadClient, item *models.MediaItem, d *models.Decision, url string, season int, episodes []int) (*models.Download, error) {
+	r := &d.Release
+	dl, err := downloads.Send(store, c, download.AddRequest {
+		Url:    url,
+		Labels: []string{downloads.Category},
+	}, func(id string) *models.Download {
+		now := time.Now()
+		return &models.Download {
+			Id:         downloads.Id(c.Name(), id),
+			Client:     c.Name(),
+			DownloadId: id,
+			Protocol:   string(c.Protocol()),
+			MediaId:    item.Id,
+			Name:       r.Title,
+			Url:        url,
+			Season:     season,
+			Episodes:   episodes,
+			Quality:    d.Quality,
+			Indexer:    r.Indexer,
+			Release:    r.Title,
+			InfoHash:   strings.ToLower(r.InfoHash),
+			Status:     string(download.Queued),
+			Size:       r.Size,
+			Eta:        -1,
+			Added:      now,
+			Updated:    now,
+		}
+	})
+	if err != nil {
+		log.Error("acquire.Grab: unable to add release", log.String("client", c.Name()), log.String("release", r.Title), log.Err(err))
+		return nil, err
+	}
+	return dl, nil
+}
+
+// ready returns an error if searching can't grab anything.
+func ready() error {
+	if len(torznab.Indexers()) == 0 {
+		return ErrNoIndexers
+	}
+	if len(download.Clients()) == 0 {
+		return ErrNoClients
+	}
+	return nil
+}
+
+// wanted selects the episodes a show is waiting for.
+func wanted(e *models.LibraryEpisode) bool {
+	return e.State == models.Wanted
+}
+
+// search looks for a movie, or for the episodes of a show chosen by want,
+// and grabs the best release of each. Copies downloaded below the quality
+// profile's cutoff are upgraded. The caller holds the mutex.
+func search(ctx context.Context, store *storage.Store, item *models.MediaItem, want func(*models.LibraryEpisode) bool) ([]models.History, error) {
+	grabbed := make([]models.History, 0)
+
+	profile, err := quality.Profile(store.Profiles, item.ProfileId)
+	if err != nil {
+		log.Error("acquire.search: unable to find the quality profile", log.String("id", item.Id), log.Err(err))
+		return nil, err
+	}
+
+	busy, err := downloading(store.Downloads, item.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	have, err := history.Qualities(store.History, item.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	details := detailsOf(item)
+	if item.Type == models.Movie {
+		// Movies without a release date are searched in case they're out.
+		current := have[history.Episode{}]
+		if (item.State == models.Downloaded && !upgradable(profile, current)) || busy[episodeKey{}] || (len(details.ReleaseDate) > 0 && !released(details.ReleaseDate)) {
+			return grabbed, nil
+		}
+		if item.State != models.Downloaded {
+			current = ""
+		}
+		h, err := best(store, item, profile, &details, 0, 0, nil, current)
+		if h != nil {
+			grabbed = append(grabbed, *h)
+		}
+		return grabbed, err
+	}
+
+	// Aired episodes by season, which of them to search for, and which of
+	// those are upgrades.
+	aired := make(map[int]int)
+	seasons := make(map[int][]int)
+	upgrades := make(map[episodeKey]string)
+	for i := range item.Episodes {
+		e := &item.Episodes[i]
+		if !released(e.AirDate) {
+			continue
+		}
+		aired[e.Season]++
+		if busy[episodeKey{e.Season, e.Episode}] {
+			continue
+		}
+
+		current := have[history.Episode{Season: e.Season, Episode: e.Episode}]
+		if e.State == models.Downloaded && upgradable(profile, current) {
+			upgrades[episodeKey{e.Season, e.Episode}] = current
+			seasons[e.Season] = append(seasons[e.Season], e.Episode)
+		} else if want(e) {
+			seasons[e.Season] = append(seasons[e.Season], e.Episode)
+		}
+	}
+
+	order := make([]int, 0, len(seasons))
+	for s := range seasons {
+		order = append(order, s)
+	}
+	sort.Ints(order)
+
+	var lastErr error
+	for _, s := range order {
+		episodes := seasons[s]
+		sort.Ints(episodes)
+
+		// A whole season is wanted, so a season pack is worth a try.
+		// Upgrades are searched for an episode at a time.
+		pack := len(episodes) > 1 && len(episodes) == aired[s]
+		for _, e := range episodes {
+			_, upgrade := upgrades[episodeKey{s, e}]
+			pack = pack && !upgrade
+		}
+		if pack {
+			if ctx.Err() != nil {
+				return grabbed, nil
+			}
+			h, err := best(store, item, profile, &details, s, 0, episodes, "")
+			if err != nil {
+				lastErr = err
+			}
+			if h != nil {
+				grabbed = append(grabbed, *h)
+				continue
+			}
+		}
+
+		covered := make(map[int]bool)
+		for _, e := range episodes {
+			if covered[e] {
+				continue
+			}
+			if ctx.Err() != nil {
+				return grabbed, nil
+			}
+
+			h, err := best(store, item, profile, &details, s, e, nil, upgrades[episodeKey{s, e}])
+			if err != nil {
+				lastErr = err
+			}
+			if h != nil {
+				grabbed = append(grabbed, *h)
+				for _, n := range h.Episodes {
+					covered[n] = true
+				}
+			}
+		}
+	}
+
+	return grabbed, lastErr
+}
+
+// upgradable returns true if a downloaded copy of a known quality is below
+// the profile's cutoff.
+func upgradable(profile *models.QualityProfile, current string) bool {
+	return len(current) > 0 && !quality.Met(profile, current)
+}
+
+// best searches for a movie, a season pack when episode is 0, or a single
+// episode, and grabs the best accepted release. It returns nil if nothing
+// was accepted. For season packs, episodes lists the episodes in the pack.
+// Current is the quality of the copy being upgraded, if any.
+func best(store *storage.Store, item *models.MediaItem, profile *models.QualityProfile, details *models.Details, season int, episode int, episodes []int, current string) (*models.History, error) {
+	found := releases.Search(details, season, episode)
+
+	available := false
+	for _, i := range found.Indexers {
+		available = available || i.Available
+	}
+	if !available {
+		return nil, ErrUnavailable
+	}
+
+	if h := choose(store, item, profile, details, season, episode, episodes, current, found.Releases); h != nil {
+		return h, nil
+	}
+
+	log.Info("acquire.best: no acceptable release", log.String("id", item.Id), log.Int64("season", int64(season)), log.Int64("episode", int64(episode)))
+	return nil, nil
+}
+
+// choose grabs the best accepted release of a movie, season pack or episode,
+// as with best. Blocklisted releases are skipped. It returns nil if nothing
+// was accepted or could be grabbed.
+func choose(store *storage.Store, item *models.MediaItem, profile *models.QualityProfile, details *models.Details, season int, episode int, episodes []int, current string, releases []models.Release) *models.History {
+	decisions, err := blocklist.Reject(store.Blocklist, quality.Decide(profile, details, season, episode, current, releases))
+	if err != nil {
+		log.Error("acquire.choose: unable to read the blocklist", log.Err(err))
+		return nil
+	}
+
+	for _, d := range decisions {
+		if !d.Accepted {
+			break
+		}
+		if download.ForProtocol(download.Protocol(d.Release.Protocol)) == nil {
+			continue
+		}
+
+		// Multi-episode releases cover every episode in their name.
+		list := episodes
+		if episode > 0 {
+			list = d.Parsed.Episodes
+			if len(list) == 0 {
+				list = []int{episode}
+			}
+		}
+
+		h, err := Grab(store, item, &d, season, list)
+		if err != nil {
+			// Try the next best release rather than give up.
+			continue
+		}
+		return h
+	}
+	return nil
+}
+
+// detailsOf returns the details of a library item with its episodes, which
+// the decision engine uses to match daily and anime releases.
+func detailsOf(item *models.MediaItem) models.Details {
+	details := item.Details
+	details.Episodes = make([]models.Episode, 0, len(item.Episodes))
+	for _, e := range item.Episodes {
+		details.Episodes = append(details.Episodes, models.Episode {
+			Name:    e.Name,
+			Number:  e.Number,
+			Season:  e.Season,
+			Episode: e.Episode,
+			AirDate: e.AirDate,
+		})
+	}
+	return details
+}
+
+// episodeKey identifies an episode. The zero key stands for a movie.
+type episodeKey struct {
+	season  int
+	episode int
+}
+
+// downloading returns the movie or episodes of a library item that are still
+// being transferred. Finished downloads don't count: once imported, the
+// library state decides whether the item is wanted or can be upgraded.
+func downloading(repo storage.DownloadRepository, mediaId string) (map[episodeKey]bool, error) {
+	list, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	busy := make(map[episodeKey]bool)
+	for _, d := range list {
+		if d.MediaId != mediaId || d.Imported {
+			continue
+		}
+		switch download.Status(d.Status) {
+		case download.Failed, download.Completed, download.Seeding, downloads.Removed:
+			continue
+		}
+		if len(d.Episodes) == 0 {
+			busy[episodeKey{d.Season, 0}] = true
+		}
+		for _, e := range d.Episodes {
+			busy[episodeKey{d.Season, e}] = true
+		}
+	}
+	return busy, nil
+}
+
+// released returns true if a date in the format YYYY-MM-DD is today or
+// earlier. Episodes without an air date haven't aired.
+func released(date string) bool {
+	t, err := time.Parse("2006-01-02", date)
+	return err == nil && !t.After(time.Now())
+}
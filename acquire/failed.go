@@ -0,0 +1,192 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package acquire
+
+import (
+	"context"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/blocklist"
+	"github.com/MediaExchange/mex/clients/download"
+	"github.com/MediaExchange/mex/downloads"
+	"github.com/MediaExchange/mex/history"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/storage"
+	"sync"
+)
+
+// replacement is what a failed download was grabbed for.
+type replacement struct {
+	mediaId  string
+	season   int
+	episodes []int
+}
+
+var (
+	// Searches for releases to replace failed downloads, by download ID.
+	queue = make(map[string]replacement)
+
+	// Guards the queue. It's separate from the search lock so failed
+	// downloads can be queued while a search runs.
+	queueMutex sync.Mutex
+)
+
+// Failed returns a function for services.NewTicker that handles the
+// downloads MEX grabbed which their client reports as failed.
+func Failed(store *storage.Store) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		list, err := store.Downloads.List()
+		if err != nil {
+			log.Error("acquire.Failed: unable to list downloads", log.Err(err))
+			return
+		}
+
+		for i := range list {
+			if ctx.Err() != nil {
+				return
+			}
+
+			d := &list[i]
+			if d.Status != string(download.Failed) || len(d.MediaId) == 0 || d.Blocklisted {
+				continue
+			}
+
+			reason := "Download failed"
+			if len(d.Error) > 0 {
+				reason += ": " + d.Error
+			}
+			if err := Fail(store, d, reason); err != nil {
+				log.Warn("acquire.Failed: unable to handle failed download", log.String("id", d.Id), log.Err(err))
+			}
+		}
+	}
+}
+
+// Fail blocklists the release of a download MEX grabbed, records why in the
+// history, and queues a search for another release if the library item is
+// monitored. The search is left to Replace, since a library search can hold
+// the search lock for a long time and downloads shouldn't wait for it.
+func Fail(store *storage.Store, d *models.Download, reason string) error {
+	item, err := store.Media.Get(d.MediaId)
+	if err != nil && err != storage.ErrNotFound {
+		return err
+	}
+
+	title := ""
+	if item != nil {
+		title = item.Title
+	}
+
+	// Downloads grabbed before releases were recorded only have the name
+	// the client gave them.
+	release := d.Release
+	if len(release) == 0 {
+		release = d.Name
+	}
+
+	if _, err := blocklist.Add(store.Blocklist, models.BlocklistEntry {
+		MediaId:  d.MediaId,
+		Title:    title,
+		Release:  release,
+		InfoHash: d.InfoHash,
+		Indexer:  d.Indexer,
+		Protocol: d.Protocol,
+		Season:   d.Season,
+		Episodes: d.Episodes,
+		Quality:  d.Quality,
+		Reason:   reason,
+	}); err != nil {
+		return err
+	}
+
+	if _, err := downloads.Update(store, d.Id, func(d *models.Download) {
+		d.Blocklisted = true
+	}); err != nil {
+		return err
+	}
+
+	if _, err := history.Record(store.History, models.History {
+		Type:       models.HistoryFailed,
+		MediaId:    d.MediaId,
+		Title:      title,
+		Release:    release,
+		Season:     d.Season,
+		Episodes:   d.Episodes,
+		Quality:    d.Quality,
+		Indexer:    d.Indexer,
+		DownloadId: d.Id,
+		Message:    reason,
+	}); err != nil {
+		return err
+	}
+
+	if item == nil || !item.Monitored || ready() != nil {
+		return nil
+	}
+
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+	queue[d.Id] = replacement {
+		mediaId:  d.MediaId,
+		season:   d.Season,
+		episodes: d.Episodes,
+	}
+	return nil
+}
+
+// Replace returns a function for services.NewTicker that searches for
+// releases to replace the failed downloads queued by Fail.
+func Replace(store *storage.Store) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		queueMutex.Lock()
+		pending := queue
+		queue = make(map[string]replacement)
+		queueMutex.Unlock()
+
+		if len(pending) == 0 || ready() != nil {
+			return
+		}
+
+		for id, r := range pending {
+			if ctx.Err() != nil {
+				return
+			}
+
+			grabbed, err := replace(ctx, store, r)
+			if err != nil {
+				log.Warn("acquire.Replace: search failed", log.String("id", id), log.Err(err))
+				continue
+			}
+			log.Info("acquire.Replace: searched for another release", log.String("id", id), log.Int64("grabbed", int64(len(grabbed))))
+		}
+	}
+}
+
+// replace searches for the movie, or the episodes a failed release would have
+// provided. Like sweep, it only holds the lock for the one item.
+func replace(ctx context.Context, store *storage.Store, r replacement) ([]models.History, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// The item may have changed while the search was queued.
+	item, err := store.Media.Get(r.mediaId)
+	if err != nil || !item.Monitored {
+		return nil, nil
+	}
+
+	return search(ctx, store, item, func(e *models.LibraryEpisode) bool {
+		return e.Season == r.season && e.State != models.Downloaded && (len(r.episodes) == 0 || contains(r.episodes, e.Episode))
+	})
+}
@@ -0,0 +1,290 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package acquire
+
+import (
+	"context"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/clients/torznab"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/parser"
+	"github.com/MediaExchange/mex/quality"
+	"github.com/MediaExchange/mex/storage"
+	"sort"
+	"time"
+)
+
+// Settings key prefix of each indexer's watermark.
+const watermarkPrefix = "rss."
+
+// watermark is the newest release seen in an indexer's feed. Releases up to
+// and including it have already been considered.
+type watermark struct {
+	Guid      string    `json:"guid"`
+	Published time.Time `json:"published"`
+}
+
+// target is what a release in a feed was matched to: a movie, a season pack
+// when episode is 0, or an episode.
+type target struct {
+	item    int
+	season  int
+	episode int
+}
+
+// Sync returns a function for services.NewTicker that reads the RSS feed of
+// every indexer and grabs the new releases that monitored items want. Only
+// releases newer than each indexer's watermark are considered, and the
+// watermarks are kept in the settings so a restart doesn't reconsider them.
+func Sync(store *storage.Store) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		if ready() != nil {
+			return
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		// Every feed is read first so the best release is chosen across indexers.
+		fresh := make([]models.Release, 0)
+		marks := make(map[string]watermark)
+		for _, c := range torznab.Indexers() {
+			if ctx.Err() != nil {
+				return
+			}
+
+			list, err := c.Recent()
+			if err != nil {
+				log.Warn("acquire.Sync: unable to read feed", log.String("indexer", c.Name()), log.Err(err))
+				continue
+			}
+
+			var mark watermark
+			if err := store.Settings.Get(watermarkPrefix + c.Name(), &mark); err != nil && err != storage.ErrNotFound {
+				log.Error("acquire.Sync: unable to read watermark", log.String("indexer", c.Name()), log.Err(err))
+				continue
+			}
+
+			n := unseen(list, mark)
+			fresh = append(fresh, list[:n]...)
+			if n > 0 {
+				marks[c.Name()] = watermark {
+					Guid:      list[0].Guid,
+					Published: list[0].Published,
+				}
+			}
+			log.Info("acquire.Sync: read feed", log.String("indexer", c.Name()), log.Int64("releases", int64(len(list))), log.Int64("new", int64(n)))
+		}
+
+		if len(fresh) > 0 {
+			if err := match(ctx, store, fresh); err != nil {
+				log.Error("acquire.Sync: unable to match releases", log.Err(err))
+				return
+			}
+		}
+
+		// The watermarks only move once their releases have been considered.
+		if ctx.Err() != nil {
+			return
+		}
+		for name, mark := range marks {
+			if err := store.Settings.Set(watermarkPrefix + name, mark); err != nil {
+				log.Error("acquire.Sync: unable to save watermark", log.String("indexer", name), log.Err(err))
+			}
+		}
+	}
+}
+
+// unseen returns how many releases at the start of a feed, newest first, are
+// newer than the watermark. Every release is new if the watermark is empty
+// or has dropped out of the feed.
+func unseen(list []models.Release, mark watermark) int {
+	for i, r := range list {
+		if len(mark.Guid) > 0 && r.Guid == mark.Guid {
+			return i
+		}
+		if !mark.Published.IsZero() && !r.Published.IsZero() && r.Published.Before(mark.Published) {
+			return i
+		}
+	}
+	return len(list)
+}
+
+// match finds the monitored items that want each release and grabs the best
+// release for each movie, season pack and episode. The caller holds the
+// mutex.
+func match(ctx context.Context, store *storage.Store, fresh []models.Release) error {
+	items, err := store.Media.List()
+	if err != nil {
+		return err
+	}
+
+	parsed := make([]parser.Result, len(fresh))
+	for i := range fresh {
+		parsed[i] = parser.Parse(fresh[i].Title)
+	}
+
+	found := make(map[target][]models.Release)
+	packs := make(map[target][]int)
+	busy := make(map[int]map[episodeKey]bool)
+	for i := range items {
+		item := &items[i]
+		if !item.Monitored {
+			continue
+		}
+
+		for j := range fresh {
+			if !quality.SameMedia(&item.Details, &fresh[j], &parsed[j]) {
+				continue
+			}
+
+			if busy[i] == nil {
+				if busy[i], err = downloading(store.Downloads, item.Id); err != nil {
+					return err
+				}
+			}
+
+			t, episodes, ok := wants(item, busy[i], &parsed[j])
+			if !ok {
+				continue
+			}
+			t.item = i
+			found[t] = append(found[t], fresh[j])
+			if t.episode == 0 && len(episodes) > 0 {
+				packs[t] = episodes
+			}
+		}
+	}
+
+	// Season packs go before the episodes they would cover.
+	order := make([]target, 0, len(found))
+	for t := range found {
+		order = append(order, t)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if a.item != b.item {
+			return a.item < b.item
+		}
+		if (a.episode == 0) != (b.episode == 0) {
+			return a.episode == 0
+		}
+		if a.season != b.season {
+			return a.season < b.season
+		}
+		return a.episode < b.episode
+	})
+
+	for _, t := range order {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		item := &items[t.item]
+		if busy[t.item][episodeKey{t.season, t.episode}] {
+			continue
+		}
+
+		profile, err := quality.Profile(store.Profiles, item.ProfileId)
+		if err != nil {
+			log.Error("acquire.match: unable to find the quality profile", log.String("id", item.Id), log.Err(err))
+			continue
+		}
+
+		details := detailsOf(item)
+		h := choose(store, item, profile, &details, t.season, t.episode, packs[t], "", found[t])
+		if h == nil {
+			continue
+		}
+
+		if len(h.Episodes) == 0 {
+			busy[t.item][episodeKey{h.Season, 0}] = true
+		}
+		for _, e := range h.Episodes {
+			busy[t.item][episodeKey{h.Season, e}] = true
+		}
+	}
+	return nil
+}
+
+// wants returns what a release of a library item would be grabbed as, if the
+// item wants it: a movie that isn't downloaded, a season pack of a season
+// whose aired episodes are all wanted, or episodes that are all wanted. For
+// season packs, it also returns the episodes in the pack.
+func wants(item *models.MediaItem, busy map[episodeKey]bool, parsed *parser.Result) (target, []int, bool) {
+	if item.Type == models.Movie {
+		if item.State == models.Downloaded || busy[episodeKey{}] || (len(item.Details.ReleaseDate) > 0 && !released(item.Details.ReleaseDate)) {
+			return target{}, nil, false
+		}
+		return target{}, nil, true
+	}
+
+	if parsed.FullSeason {
+		if len(parsed.Seasons) != 1 {
+			return target{}, nil, false
+		}
+
+		season := parsed.Seasons[0]
+		aired := 0
+		episodes := make([]int, 0)
+		for i := range item.Episodes {
+			e := &item.Episodes[i]
+			if e.Season != season || !released(e.AirDate) {
+				continue
+			}
+			aired++
+			if wanted(e) && !busy[episodeKey{e.Season, e.Episode}] {
+				episodes = append(episodes, e.Episode)
+			}
+		}
+		if len(episodes) == 0 || len(episodes) != aired {
+			return target{}, nil, false
+		}
+		sort.Ints(episodes)
+		return target{season: season}, episodes, true
+	}
+
+	// Every episode in the release must be wanted. Daily and anime releases
+	// are matched through the air date or absolute number.
+	t := target{}
+	for i := range item.Episodes {
+		e := &item.Episodes[i]
+		numbered := len(parsed.Seasons) == 1 && parsed.Seasons[0] == e.Season && contains(parsed.Episodes, e.Episode)
+		dated := len(parsed.AirDate) > 0 && parsed.AirDate == e.AirDate
+		absolute := e.Number > 0 && contains(parsed.Absolute, e.Number)
+		if !numbered && !dated && !absolute {
+			continue
+		}
+
+		if !wanted(e) || !released(e.AirDate) || busy[episodeKey{e.Season, e.Episode}] {
+			return target{}, nil, false
+		}
+		if t.episode == 0 || e.Season < t.season || (e.Season == t.season && e.Episode < t.episode) {
+			t.season, t.episode = e.Season, e.Episode
+		}
+	}
+	return t, nil, t.episode > 0
+}
+
+// contains returns true if list has n.
+func contains(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
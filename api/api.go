@@ -0,0 +1,47 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package api
+
+import (
+	"encoding/json"
+	"github.com/MediaExchange/mex/storage"
+	"net/http"
+)
+
+var (
+	// Store holds MEX state. It is set by main before the server starts.
+	Store *storage.Store
+)
+
+// writeJson responds with a JSON-encoded value.
+func writeJson(writer http.ResponseWriter, status int, v interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(v)
+}
+
+// writeText responds with a plain text message, usually an error.
+func writeText(writer http.ResponseWriter, status int, message string) {
+	writer.Header().Set("Content-Type", "text/plain")
+	writer.WriteHeader(status)
+	_, _ = writer.Write([]byte(message))
+}
+
+// readJson decodes the request body into v.
+func readJson(request *http.Request, v interface{}) error {
+	defer request.Body.Close()
+	return json.NewDecoder(request.Body).Decode(v)
+}
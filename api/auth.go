@@ -0,0 +1,382 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package api
+
+import (
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/router"
+	"github.com/MediaExchange/mex/auth"
+	"github.com/MediaExchange/mex/clients/plextv"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/storage"
+	"net/http"
+	"strconv"
+)
+
+// credentials is the request body of Login and Setup.
+type credentials struct {
+	Username    string          `json:"username"`
+	Password    string          `json:"password"`
+}
+
+// setupStatus is the response body of GetSetup.
+type setupStatus struct {
+	Required    bool            `json:"required"`       // True until the first admin has been created.
+}
+
+// createUser is the request body of CreateUser.
+type createUser struct {
+	Username    string          `json:"username"`
+	Password    string          `json:"password"`
+	Role        models.Role     `json:"role"`
+}
+
+// updateUser is the request body of UpdateUser. Fields left out are not changed.
+type updateUser struct {
+	Password    string          `json:"password"`
+	Role        models.Role     `json:"role"`
+}
+
+// createToken is the request body of CreateToken.
+type createToken struct {
+	Name        string          `json:"name"`           // Description of what the token is for.
+}
+
+// createdToken is the response body of CreateToken.
+type createdToken struct {
+	models.ApiToken
+	Token       string          `json:"token"`          // The token. It can't be retrieved again.
+}
+
+// startPlexLogin is the request body of StartPlexLogin.
+type startPlexLogin struct {
+	ForwardUrl  string          `json:"forwardUrl"`     // Where Plex sends the browser after signing in.
+}
+
+// plexPin is the response body of StartPlexLogin.
+type plexPin struct {
+	Id          int             `json:"id"`             // Pass to FinishPlexLogin.
+	Code        string          `json:"code"`           // Pass to FinishPlexLogin.
+	AuthUrl     string          `json:"authUrl"`        // Plex page where the user signs in.
+}
+
+// finishPlexLogin is the request body of FinishPlexLogin.
+type finishPlexLogin struct {
+	Code        string          `json:"code"`           // Code returned by StartPlexLogin.
+}
+
+// plexPending is the response body of FinishPlexLogin while the user hasn't signed in yet.
+type plexPending struct {
+	Pending     bool            `json:"pending"`
+}
+
+// Login checks a username and password and starts a session cookie.
+func Login(writer http.ResponseWriter, request *http.Request) {
+	var body credentials
+	if err := readJson(request, &body); err != nil {
+		writeText(writer, http.StatusBadRequest, "api.Login: invalid request body: " + err.Error())
+		return
+	}
+
+	user, token, err := auth.Login(Store, body.Username, body.Password)
+	if err != nil {
+		authError(writer, "api.Login", err)
+		return
+	}
+
+	auth.SetCookie(writer, request, token)
+	writeJson(writer, http.StatusOK, user)
+}
+
+// StartPlexLogin begins signing in with Plex. The UI opens the returned
+// authUrl, then calls FinishPlexLogin until the user has signed in.
+func StartPlexLogin(writer http.ResponseWriter, request *http.Request) {
+	if len(auth.PlexServerId) == 0 {
+		authError(writer, "api.StartPlexLogin", auth.ErrPlexDisabled)
+		return
+	}
+
+	var body startPlexLogin
+	if request.ContentLength > 0 {
+		if err := readJson(request, &body); err != nil {
+			writeText(writer, http.StatusBadRequest, "api.StartPlexLogin: invalid request body: " + err.Error())
+			return
+		}
+	}
+
+	pin, err := plextv.CreatePin()
+	if err != nil {
+		writeText(writer, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	writeJson(writer, http.StatusOK, plexPin {
+		Id:      pin.Id,
+		Code:    pin.Code,
+		AuthUrl: plextv.AuthUrl(pin, body.ForwardUrl),
+	})
+}
+
+// FinishPlexLogin checks whether the user has signed in to Plex. It responds
+// with 202 Accepted while waiting, and starts a session cookie once the user
+// has signed in and has access to the server.
+func FinishPlexLogin(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.Atoi(router.GetParams(request.Context())["id"])
+	if err != nil {
+		writeText(writer, http.StatusBadRequest, "api.FinishPlexLogin: id must be a number")
+		return
+	}
+
+	var body finishPlexLogin
+	if err := readJson(request, &body); err != nil {
+		writeText(writer, http.StatusBadRequest, "api.FinishPlexLogin: invalid request body: " + err.Error())
+		return
+	}
+
+	pin, err := plextv.CheckPin(id)
+	if err != nil {
+		writeText(writer, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	// The code proves the caller started this sign in; pin IDs alone are guessable.
+	if pin.Code != body.Code {
+		log.Warn("api.FinishPlexLogin: code does not match", log.Int64("id", int64(id)))
+		writeText(writer, http.StatusUnauthorized, "api.FinishPlexLogin: code does not match")
+		return
+	}
+
+	if len(pin.AuthToken) == 0 {
+		writeJson(writer, http.StatusAccepted, plexPending{Pending: true})
+		return
+	}
+
+	user, token, err := auth.LoginWithPlex(Store, pin.AuthToken)
+	if err != nil {
+		authError(writer, "api.FinishPlexLogin", err)
+		return
+	}
+
+	auth.SetCookie(writer, request, token)
+	writeJson(writer, http.StatusOK, user)
+}
+
+// Logout ends the current session.
+func Logout(writer http.ResponseWriter, request *http.Request) {
+	if token := auth.Token(request); len(token) > 0 {
+		if err := auth.Logout(Store, token); err != nil {
+			log.Error("api.Logout: unable to end session", log.Err(err))
+		}
+	}
+
+	auth.ClearCookie(writer, request)
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// Me returns the logged in user.
+func Me(writer http.ResponseWriter, request *http.Request) {
+	writeJson(writer, http.StatusOK, auth.User(request.Context()))
+}
+
+// GetSetup reports whether the first admin still needs to be created.
+func GetSetup(writer http.ResponseWriter, request *http.Request) {
+	required, err := auth.SetupRequired(Store.Users)
+	if err != nil {
+		authError(writer, "api.GetSetup", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, setupStatus{Required: required})
+}
+
+// Setup creates the first admin and logs them in. It only works while no
+// users exist.
+func Setup(writer http.ResponseWriter, request *http.Request) {
+	var body credentials
+	if err := readJson(request, &body); err != nil {
+		writeText(writer, http.StatusBadRequest, "api.Setup: invalid request body: " + err.Error())
+		return
+	}
+
+	user, err := auth.Setup(Store.Users, body.Username, body.Password)
+	if err != nil {
+		authError(writer, "api.Setup", err)
+		return
+	}
+
+	token, err := auth.StartSession(Store, user)
+	if err != nil {
+		authError(writer, "api.Setup", err)
+		return
+	}
+
+	auth.SetCookie(writer, request, token)
+	writeJson(writer, http.StatusCreated, user)
+}
+
+// ListUsers lists every user.
+func ListUsers(writer http.ResponseWriter, request *http.Request) {
+	users, err := Store.Users.List()
+	if err != nil {
+		authError(writer, "api.ListUsers", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, users)
+}
+
+// CreateUser adds a user with a password and role.
+func CreateUser(writer http.ResponseWriter, request *http.Request) {
+	var body createUser
+	if err := readJson(request, &body); err != nil {
+		writeText(writer, http.StatusBadRequest, "api.CreateUser: invalid request body: " + err.Error())
+		return
+	}
+
+	user, err := auth.CreateUser(Store.Users, body.Username, body.Password, body.Role)
+	if err != nil {
+		authError(writer, "api.CreateUser", err)
+		return
+	}
+
+	writeJson(writer, http.StatusCreated, user)
+}
+
+// UpdateUser changes a user's role or password. The last admin can't be
+// given another role.
+func UpdateUser(writer http.ResponseWriter, request *http.Request) {
+	username := router.GetParams(request.Context())["username"]
+
+	var body updateUser
+	if err := readJson(request, &body); err != nil {
+		writeText(writer, http.StatusBadRequest, "api.UpdateUser: invalid request body: " + err.Error())
+		return
+	}
+
+	user, err := Store.Users.Get(username)
+	if err != nil {
+		authError(writer, "api.UpdateUser", err)
+		return
+	}
+
+	if len(body.Role) > 0 {
+		if user, err = auth.SetRole(Store.Users, user.Username, body.Role); err != nil {
+			authError(writer, "api.UpdateUser", err)
+			return
+		}
+	}
+
+	// Changing the password logs the user out everywhere.
+	if len(body.Password) > 0 {
+		if err := auth.SetPassword(Store.Users, user.Username, body.Password); err != nil {
+			authError(writer, "api.UpdateUser", err)
+			return
+		}
+	}
+
+	writeJson(writer, http.StatusOK, user)
+}
+
+// DeleteUser removes a user. Admins can't delete themselves, which keeps at
+// least one admin around.
+func DeleteUser(writer http.ResponseWriter, request *http.Request) {
+	username := router.GetParams(request.Context())["username"]
+
+	if user, err := Store.Users.Get(username); err == nil && user.Username == auth.Username(request.Context()) {
+		writeText(writer, http.StatusConflict, "api.DeleteUser: you can't delete yourself")
+		return
+	}
+
+	if err := Store.Users.Delete(username); err != nil {
+		authError(writer, "api.DeleteUser", err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// ListTokens lists the logged in user's API tokens.
+func ListTokens(writer http.ResponseWriter, request *http.Request) {
+	tokens, err := Store.Tokens.List(auth.Username(request.Context()))
+	if err != nil {
+		authError(writer, "api.ListTokens", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, tokens)
+}
+
+// CreateToken creates an API token for the logged in user. The token is
+// only included in this response.
+func CreateToken(writer http.ResponseWriter, request *http.Request) {
+	var body createToken
+	if err := readJson(request, &body); err != nil {
+		writeText(writer, http.StatusBadRequest, "api.CreateToken: invalid request body: " + err.Error())
+		return
+	}
+
+	token, t, err := auth.CreateToken(Store, auth.Username(request.Context()), body.Name)
+	if err != nil {
+		authError(writer, "api.CreateToken", err)
+		return
+	}
+
+	writeJson(writer, http.StatusCreated, createdToken{ApiToken: *t, Token: token})
+}
+
+// DeleteToken revokes one of the logged in user's API tokens.
+func DeleteToken(writer http.ResponseWriter, request *http.Request) {
+	id := router.GetParams(request.Context())["id"]
+
+	t, err := Store.Tokens.Get(id)
+	if err != nil || t.Username != auth.Username(request.Context()) {
+		authError(writer, "api.DeleteToken", storage.ErrNotFound)
+		return
+	}
+
+	if err := Store.Tokens.Delete(id); err != nil {
+		authError(writer, "api.DeleteToken", err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// authError responds with the status code that matches an auth error.
+func authError(writer http.ResponseWriter, caller string, err error) {
+	var status int
+	switch err {
+	case auth.ErrInvalidCredentials:
+		status = http.StatusUnauthorized
+	case auth.ErrNoServerAccess:
+		status = http.StatusForbidden
+	case auth.ErrPlexDisabled:
+		status = http.StatusNotFound
+	case auth.ErrInvalidPlexAccount:
+		status = http.StatusBadGateway
+	case auth.ErrInvalidUsername, auth.ErrWeakPassword, auth.ErrInvalidRole:
+		status = http.StatusBadRequest
+	case auth.ErrUserExists, auth.ErrSetupComplete, auth.ErrLastAdmin:
+		status = http.StatusConflict
+	case storage.ErrNotFound:
+		status = http.StatusNotFound
+	default:
+		status = http.StatusInternalServerError
+	}
+
+	log.Error(caller, log.Err(err))
+	writeText(writer, status, err.Error())
+}
@@ -0,0 +1,77 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package api
+
+import (
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/router"
+	"github.com/MediaExchange/mex/blocklist"
+	"github.com/MediaExchange/mex/storage"
+	"net/http"
+	"strconv"
+)
+
+// ListBlocklist lists the releases MEX won't grab again, newest first. The
+// optional query parameter `mediaId` filters the list.
+func ListBlocklist(writer http.ResponseWriter, request *http.Request) {
+	params := router.GetParams(request.Context())
+
+	list, err := blocklist.List(Store.Blocklist, blocklist.Filter{MediaId: params["mediaId"]})
+	if err != nil {
+		log.Error("api.ListBlocklist: unexpected error", log.Err(err))
+		writeText(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJson(writer, http.StatusOK, list)
+}
+
+// DeleteBlocklistEntry removes a release from the blocklist so it can be
+// grabbed again.
+func DeleteBlocklistEntry(writer http.ResponseWriter, request *http.Request) {
+	param := router.GetParams(request.Context())["id"]
+	id, err := strconv.ParseUint(param, 10, 64)
+	if err != nil {
+		writeText(writer, http.StatusBadRequest, "blocklist id must be a number: " + param)
+		return
+	}
+
+	if err := blocklist.Remove(Store.Blocklist, id); err != nil {
+		status := http.StatusInternalServerError
+		if err == storage.ErrNotFound {
+			status = http.StatusNotFound
+		}
+		log.Error("api.DeleteBlocklistEntry", log.Err(err))
+		writeText(writer, status, err.Error())
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// ClearBlocklist removes every release from the blocklist, or only those of
+// the library item in the optional query parameter `mediaId`.
+func ClearBlocklist(writer http.ResponseWriter, request *http.Request) {
+	params := router.GetParams(request.Context())
+
+	if _, err := blocklist.Clear(Store.Blocklist, blocklist.Filter{MediaId: params["mediaId"]}); err != nil {
+		log.Error("api.ClearBlocklist: unexpected error", log.Err(err))
+		writeText(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,52 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package api
+
+import (
+	"net/http"
+)
+
+// Cors wraps a handler to allow the listed origins, such as the Angular
+// development server on http://localhost:4200, to call the API with
+// cookies. Requests from the origin MEX itself is served on never need it.
+func Cors(origins []string, next http.Handler) http.Handler {
+	allowed := make(map[string]bool)
+	for _, o := range origins {
+		allowed[o] = true
+	}
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		origin := request.Header.Get("Origin")
+		if len(origin) == 0 || !allowed[origin] {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		writer.Header().Set("Access-Control-Allow-Origin", origin)
+		writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		writer.Header().Add("Vary", "Origin")
+
+		// Answer preflight requests here; the router doesn't know about OPTIONS.
+		if request.Method == http.MethodOptions {
+			writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
+			writer.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type")
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
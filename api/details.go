@@ -6,6 +6,7 @@ import (
 	"github.com/MediaExchange/router"
 	"github.com/MediaExchange/mex/clients/tmdb"
 	"github.com/MediaExchange/mex/clients/tvdb"
+	"github.com/MediaExchange/mex/health"
 	"net/http"
 	"strconv"
 	"strings"
@@ -14,8 +15,6 @@ import (
 // GetDetails retrieves detailed information for media.
 // The query parameter `id` contains the media provider and the provider's ID in the format `provider:id`.
 func GetDetails(writer http.ResponseWriter, request *http.Request) {
-	writer.Header().Add("Access-Control-Allow-Origin", "*")
-
 	// Get the provider and ID from the query string.
 	params := router.GetParams(request.Context())
 	param := params["id"]
@@ -44,6 +43,10 @@ func GetDetails(writer http.ResponseWriter, request *http.Request) {
 
 	switch provider {
 	case "tmdb":
+		if unavailable(writer, provider) {
+			return
+		}
+
 		res, err := tmdb.Details(id)
 		if err != nil {
 			// Error was already logged in tmdb.Details. Just report it back to the client.
@@ -58,6 +61,10 @@ func GetDetails(writer http.ResponseWriter, request *http.Request) {
 		_ = json.NewEncoder(writer).Encode(res)
 
 	case "tvdb":
+		if unavailable(writer, provider) {
+			return
+		}
+
 		res, err := tvdb.Details(id)
 		if err != nil {
 			// Error was already logged in tmdb.Details. Just report it back to the client.
@@ -78,3 +85,17 @@ func GetDetails(writer http.ResponseWriter, request *http.Request) {
 		_, _ = writer.Write([]byte("api.GetDetails: Unknown provider: " + provider))
 	}
 }
+
+// unavailable responds with 503 Service Unavailable and returns true if the
+// provider is down or failed to log in.
+func unavailable(writer http.ResponseWriter, provider string) bool {
+	if health.Provider(provider).Available() {
+		return false
+	}
+
+	log.Warn("api.unavailable: provider is unavailable", log.String("provider", provider))
+	writer.Header().Set("Content-Type", "text/plain")
+	writer.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = writer.Write([]byte("provider is unavailable: " + provider))
+	return true
+}
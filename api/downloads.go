@@ -0,0 +1,208 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package api
+
+import (
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/router"
+	"github.com/MediaExchange/mex/clients/download"
+	"github.com/MediaExchange/mex/downloads"
+	"github.com/MediaExchange/mex/importer"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/storage"
+	"net/http"
+	"strconv"
+)
+
+// downloadView is a download with a summary of the library item it's for.
+type downloadView struct {
+	models.Download
+	Media       *mediaSummary   `json:"media"`          // Linked library item, or null.
+}
+
+// mediaSummary identifies a library item without its full details.
+type mediaSummary struct {
+	Id          string              `json:"id"`
+	Type        models.MediaType    `json:"type"`
+	Title       string              `json:"title"`
+	Year        int                 `json:"year"`
+}
+
+// ListDownloads lists active and recent downloads from every download
+// client. The optional query parameters `client`, `status` and `mediaId`
+// filter the results.
+func ListDownloads(writer http.ResponseWriter, request *http.Request) {
+	params := router.GetParams(request.Context())
+
+	filter := downloads.Filter {
+		Client:  params["client"],
+		Status:  params["status"],
+		MediaId: params["mediaId"],
+	}
+	if len(filter.Status) > 0 && !downloads.ValidStatus(filter.Status) {
+		writeText(writer, http.StatusBadRequest, "api.ListDownloads: unknown `status`: " + filter.Status)
+		return
+	}
+
+	list, err := downloads.List(Store.Downloads, filter)
+	if err != nil {
+		log.Error("api.ListDownloads: unexpected error", log.Err(err))
+		writeText(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Several downloads are often for the same show.
+	media := make(map[string]*mediaSummary)
+	views := make([]downloadView, 0, len(list))
+	for _, d := range list {
+		s, ok := media[d.MediaId]
+		if !ok {
+			s = summarize(d.MediaId)
+			media[d.MediaId] = s
+		}
+		views = append(views, downloadView{Download: d.Public(), Media: s})
+	}
+
+	writeJson(writer, http.StatusOK, views)
+}
+
+// GetDownload returns a single download.
+func GetDownload(writer http.ResponseWriter, request *http.Request) {
+	id := router.GetParams(request.Context())["id"]
+
+	d, err := Store.Downloads.Get(id)
+	if err != nil {
+		downloadError(writer, "api.GetDownload", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, downloadView{Download: d.Public(), Media: summarize(d.MediaId)})
+}
+
+// PauseDownload pauses a download in its client.
+func PauseDownload(writer http.ResponseWriter, request *http.Request) {
+	downloadAction(writer, request, "api.PauseDownload", downloads.Pause)
+}
+
+// ResumeDownload resumes a paused download.
+func ResumeDownload(writer http.ResponseWriter, request *http.Request) {
+	downloadAction(writer, request, "api.ResumeDownload", downloads.Resume)
+}
+
+// RetryDownload sends a failed download to its client again.
+func RetryDownload(writer http.ResponseWriter, request *http.Request) {
+	downloadAction(writer, request, "api.RetryDownload", downloads.Retry)
+}
+
+// ImportDownload places the videos of a completed download in the library
+// now, and responds with what was imported. Downloads that failed to import
+// automatically can be imported again once the problem is fixed.
+func ImportDownload(writer http.ResponseWriter, request *http.Request) {
+	id := router.GetParams(request.Context())["id"]
+
+	imported, err := importer.Import(Store, id)
+	if err != nil {
+		var status int
+		switch err {
+		case storage.ErrNotFound:
+			status = http.StatusNotFound
+		case importer.ErrNotGrabbed:
+			status = http.StatusBadRequest
+		case importer.ErrNotComplete, importer.ErrMissing, importer.ErrNoVideo, importer.ErrNoMatch:
+			status = http.StatusConflict
+		case importer.ErrNoRoot:
+			status = http.StatusServiceUnavailable
+		default:
+			status = http.StatusInternalServerError
+		}
+		log.Error("api.ImportDownload", log.String("id", id), log.Err(err))
+		writeText(writer, status, err.Error())
+		return
+	}
+
+	writeJson(writer, http.StatusOK, imported)
+}
+
+// DeleteDownload removes a download from its client. The optional query
+// parameter `deleteData=true` also deletes the downloaded files.
+func DeleteDownload(writer http.ResponseWriter, request *http.Request) {
+	params := router.GetParams(request.Context())
+
+	deleteData := false
+	if v := params["deleteData"]; len(v) > 0 {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeText(writer, http.StatusBadRequest, "api.DeleteDownload: `deleteData` must be true or false")
+			return
+		}
+		deleteData = b
+	}
+
+	if err := downloads.Remove(Store, params["id"], deleteData); err != nil {
+		downloadError(writer, "api.DeleteDownload", err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// downloadAction runs an action on the download in the path and responds
+// with its new state.
+func downloadAction(writer http.ResponseWriter, request *http.Request, caller string, action func(*storage.Store, string) (*models.Download, error)) {
+	id := router.GetParams(request.Context())["id"]
+
+	d, err := action(Store, id)
+	if err != nil {
+		downloadError(writer, caller, err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, downloadView{Download: d.Public(), Media: summarize(d.MediaId)})
+}
+
+// summarize returns a summary of a library item, or nil if there isn't one.
+func summarize(mediaId string) *mediaSummary {
+	if len(mediaId) == 0 {
+		return nil
+	}
+
+	item, err := Store.Media.Get(mediaId)
+	if err != nil {
+		return nil
+	}
+	return &mediaSummary{Id: item.Id, Type: item.Type, Title: item.Title, Year: item.Year}
+}
+
+// downloadError responds with the status code that matches a download error.
+// Anything else came from the download client.
+func downloadError(writer http.ResponseWriter, caller string, err error) {
+	var status int
+	switch err {
+	case storage.ErrNotFound, download.ErrNotFound:
+		status = http.StatusNotFound
+	case downloads.ErrNotRetryable:
+		status = http.StatusConflict
+	case download.ErrNotSupported:
+		status = http.StatusNotImplemented
+	case downloads.ErrUnknownClient:
+		status = http.StatusServiceUnavailable
+	default:
+		status = http.StatusBadGateway
+	}
+
+	log.Error(caller, log.Err(err))
+	writeText(writer, status, err.Error())
+}
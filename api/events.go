@@ -0,0 +1,135 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/router"
+	"github.com/MediaExchange/mex/events"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// Event sent when a client reconnects with an ID whose events are no
+	// longer kept. The client should reload everything it displays.
+	resetEvent = "stream.reset"
+
+	// How often a comment is sent so proxies don't close an idle stream.
+	heartbeat = 15 * time.Second
+
+	// Milliseconds a browser waits before reconnecting.
+	reconnectDelay = 1000
+)
+
+var (
+	// StreamDuration limits how long a single event stream stays open. It must
+	// be shorter than the server's write timeout; browsers reconnect and
+	// resume from the last event they received.
+	StreamDuration = 10 * time.Minute
+)
+
+// Events streams events to the client as server-sent events. Each event has
+// its ID, its type as the event name, and the changed object as JSON data.
+// Clients resume after a disconnect with the Last-Event-ID header, which
+// browsers send automatically, or the `lastEventId` query parameter.
+func Events(writer http.ResponseWriter, request *http.Request) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writeText(writer, http.StatusInternalServerError, "api.Events: streaming is not supported")
+		return
+	}
+
+	since, err := lastEventId(request)
+	if err != nil {
+		writeText(writer, http.StatusBadRequest, "api.Events: invalid last event ID")
+		return
+	}
+
+	sub, missed, complete := events.Subscribe(since)
+	defer sub.Cancel()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+
+	_, _ = fmt.Fprintf(writer, "retry: %d\n\n", reconnectDelay)
+	if !complete {
+		_, _ = fmt.Fprintf(writer, "event: %s\ndata: {}\n\n", resetEvent)
+	}
+	for _, e := range missed {
+		if err := writeEvent(writer, e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	deadline := time.NewTimer(StreamDuration)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case e, ok := <-sub.Events:
+			if !ok {
+				// Dropped for falling behind, or MEX is shutting down. The
+				// browser reconnects and replays what it missed.
+				return
+			}
+			if err := writeEvent(writer, e); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(writer, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-deadline.C:
+			return
+		case <-request.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// lastEventId returns the ID of the last event a reconnecting client saw, or 0.
+func lastEventId(request *http.Request) (uint64, error) {
+	id := request.Header.Get("Last-Event-ID")
+	if len(id) == 0 {
+		id = router.GetParams(request.Context())["lastEventId"]
+	}
+	if len(id) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseUint(id, 10, 64)
+}
+
+// writeEvent writes a single event in the text/event-stream format.
+func writeEvent(writer http.ResponseWriter, e events.Event) error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		log.Error("api.writeEvent: unable to encode event", log.String("type", e.Type), log.Err(err))
+		return nil
+	}
+
+	_, err = fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", e.Id, e.Type, data)
+	return err
+}
@@ -0,0 +1,95 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package api
+
+import (
+	"encoding/json"
+	"github.com/MediaExchange/mex/health"
+	"github.com/MediaExchange/mex/version"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// readiness is the response body of /readyz.
+type readiness struct {
+	Ready           bool                    `json:"ready"`          // True if MEX can serve requests.
+	Degraded        bool                    `json:"degraded"`       // True if any provider is unavailable.
+	ConfigLoaded    bool                    `json:"configLoaded"`   // True if the configuration file was read.
+	Providers       []health.ProviderStatus `json:"providers"`      // State of each media provider.
+}
+
+// systemStatus is the response body of /api/system/status.
+type systemStatus struct {
+	Version         string                  `json:"version"`        // Release version.
+	Commit          string                  `json:"commit"`         // Git commit the executable was built from.
+	BuildDate       string                  `json:"buildDate"`      // When the executable was built.
+	GoVersion       string                  `json:"goVersion"`      // Go runtime version.
+	Started         time.Time               `json:"started"`        // When the process started.
+	Uptime          int64                   `json:"uptime"`         // Seconds since the process started.
+	Ready           bool                    `json:"ready"`          // True if MEX can serve requests.
+	Degraded        bool                    `json:"degraded"`       // True if any provider is unavailable.
+	Providers       []health.ProviderStatus `json:"providers"`      // State of each media provider.
+}
+
+// Healthz reports that the process is alive and able to answer HTTP requests.
+func Healthz(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write([]byte("ok"))
+}
+
+// Readyz reports whether the configuration is loaded and at least one media
+// provider is authenticated and reachable. The status code is 503 when MEX is
+// not ready; a degraded MEX is still ready.
+func Readyz(writer http.ResponseWriter, request *http.Request) {
+	r := readiness {
+		Ready:        health.Ready(),
+		Degraded:     health.Degraded(),
+		ConfigLoaded: health.ConfigLoaded(),
+		Providers:    health.Providers(),
+	}
+
+	status := http.StatusOK
+	if !r.Ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(r)
+}
+
+// SystemStatus reports diagnostic information about the running executable.
+func SystemStatus(writer http.ResponseWriter, request *http.Request) {
+	s := systemStatus {
+		Version:   version.Version,
+		Commit:    version.Commit,
+		BuildDate: version.BuildDate,
+		GoVersion: runtime.Version(),
+		Started:   health.Started,
+		Uptime:    int64(time.Since(health.Started).Seconds()),
+		Ready:     health.Ready(),
+		Degraded:  health.Degraded(),
+		Providers: health.Providers(),
+	}
+
+	writer.Header().Add("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(writer).Encode(s)
+}
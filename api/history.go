@@ -0,0 +1,44 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package api
+
+import (
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/router"
+	"github.com/MediaExchange/mex/history"
+	"github.com/MediaExchange/mex/models"
+	"net/http"
+)
+
+// ListHistory lists what MEX did with releases, newest first. The optional
+// query parameters `mediaId` and `type` filter the list.
+func ListHistory(writer http.ResponseWriter, request *http.Request) {
+	params := router.GetParams(request.Context())
+
+	filter := history.Filter {
+		MediaId: params["mediaId"],
+		Type:    models.HistoryType(params["type"]),
+	}
+
+	list, err := history.List(Store.History, filter)
+	if err != nil {
+		log.Error("api.ListHistory: unexpected error", log.Err(err))
+		writeText(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJson(writer, http.StatusOK, list)
+}
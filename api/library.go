@@ -0,0 +1,270 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package api
+
+import (
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/acquire"
+	"github.com/MediaExchange/router"
+	"github.com/MediaExchange/mex/events"
+	"github.com/MediaExchange/mex/library"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/storage"
+	"net/http"
+	"strconv"
+)
+
+// addLibraryItem is the request body of AddLibraryItem.
+type addLibraryItem struct {
+	Id          string  `json:"id"`             // ID of the media in the format `provider:id`.
+	Monitored   *bool   `json:"monitored"`      // Whether MEX should acquire the media. Defaults to true.
+	ProfileId   uint64  `json:"profileId"`      // Quality profile, or 0 for the default profile.
+}
+
+// ListLibrary lists the items in the library. The optional query parameters
+// `type` (movie or tv), `monitored` (true or false), `state` (wanted,
+// downloaded or missing) and `q` (part of the title) filter the results.
+func ListLibrary(writer http.ResponseWriter, request *http.Request) {
+	params := router.GetParams(request.Context())
+
+	var filter library.Filter
+	switch params["type"] {
+	case "":
+	case "movie":
+		t := models.Movie
+		filter.Type = &t
+	case "tv":
+		t := models.TvShow
+		filter.Type = &t
+	default:
+		writeText(writer, http.StatusBadRequest, "api.ListLibrary: `type` must be movie or tv")
+		return
+	}
+
+	if m := params["monitored"]; len(m) > 0 {
+		b, err := strconv.ParseBool(m)
+		if err != nil {
+			writeText(writer, http.StatusBadRequest, "api.ListLibrary: `monitored` must be true or false")
+			return
+		}
+		filter.Monitored = &b
+	}
+
+	filter.State = models.MediaState(params["state"])
+	if len(filter.State) > 0 && !library.ValidState(filter.State) {
+		writeText(writer, http.StatusBadRequest, "api.ListLibrary: `state` must be wanted, downloaded or missing")
+		return
+	}
+
+	filter.Title = params["q"]
+
+	items, err := library.List(Store.Media, filter)
+	if err != nil {
+		log.Error("api.ListLibrary: unexpected error", log.Err(err))
+		writeText(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJson(writer, http.StatusOK, items)
+}
+
+// GetLibraryItem returns a single item from the library.
+func GetLibraryItem(writer http.ResponseWriter, request *http.Request) {
+	id := router.GetParams(request.Context())["id"]
+
+	item, err := Store.Media.Get(id)
+	if err != nil {
+		libraryError(writer, "api.GetLibraryItem", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, item)
+}
+
+// AddLibraryItem adds media to the library by its `provider:id`, storing a
+// snapshot of the provider's details.
+func AddLibraryItem(writer http.ResponseWriter, request *http.Request) {
+	var body addLibraryItem
+	if err := readJson(request, &body); err != nil {
+		writeText(writer, http.StatusBadRequest, "api.AddLibraryItem: invalid request body: " + err.Error())
+		return
+	}
+
+	monitored := true
+	if body.Monitored != nil {
+		monitored = *body.Monitored
+	}
+
+	if !validProfile(writer, "api.AddLibraryItem", body.ProfileId) {
+		return
+	}
+
+	item, err := library.Add(Store.Media, body.Id, monitored, body.ProfileId)
+	if err != nil {
+		libraryError(writer, "api.AddLibraryItem", err)
+		return
+	}
+
+	writeJson(writer, http.StatusCreated, item)
+}
+
+// UpdateLibraryItem changes whether an item is monitored and its quality
+// profile. Fields left out of the body are unchanged.
+func UpdateLibraryItem(writer http.ResponseWriter, request *http.Request) {
+	id := router.GetParams(request.Context())["id"]
+
+	var body library.ItemUpdate
+	if err := readJson(request, &body); err != nil {
+		writeText(writer, http.StatusBadRequest, "api.UpdateLibraryItem: invalid request body: " + err.Error())
+		return
+	}
+
+	if body.ProfileId != nil && !validProfile(writer, "api.UpdateLibraryItem", *body.ProfileId) {
+		return
+	}
+
+	item, err := library.Update(Store.Media, id, body)
+	if err != nil {
+		libraryError(writer, "api.UpdateLibraryItem", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, item)
+}
+
+// UpdateLibraryEpisodes changes the state of episodes of a TV show. The body
+// is a list of `{"season": 1, "episode": 2, "state": "wanted"}` objects.
+func UpdateLibraryEpisodes(writer http.ResponseWriter, request *http.Request) {
+	id := router.GetParams(request.Context())["id"]
+
+	var body []library.EpisodeUpdate
+	if err := readJson(request, &body); err != nil {
+		writeText(writer, http.StatusBadRequest, "api.UpdateLibraryEpisodes: invalid request body: " + err.Error())
+		return
+	}
+
+	item, err := library.SetEpisodes(Store.Media, id, body)
+	if err != nil {
+		libraryError(writer, "api.UpdateLibraryEpisodes", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, item)
+}
+
+// DeleteLibraryItem removes an item from the library.
+func DeleteLibraryItem(writer http.ResponseWriter, request *http.Request) {
+	id := router.GetParams(request.Context())["id"]
+
+	if err := Store.Media.Delete(id); err != nil {
+		libraryError(writer, "api.DeleteLibraryItem", err)
+		return
+	}
+	events.Publish(events.LibraryRemoved, map[string]string{"id": id})
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// SearchLibraryItem searches the indexers now for a movie that isn't
+// downloaded, or the wanted episodes of a TV show, and grabs the best
+// releases. The response lists what was grabbed.
+func SearchLibraryItem(writer http.ResponseWriter, request *http.Request) {
+	id := router.GetParams(request.Context())["id"]
+
+	grabbed, err := acquire.SearchItem(Store, id)
+	if err != nil && grabbed == nil {
+		acquireError(writer, "api.SearchLibraryItem", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, grabbed)
+}
+
+// SearchLibrarySeason searches the indexers now for every episode of a
+// season that isn't downloaded and grabs the best releases. The response
+// lists what was grabbed.
+func SearchLibrarySeason(writer http.ResponseWriter, request *http.Request) {
+	params := router.GetParams(request.Context())
+
+	season, err := strconv.Atoi(params["season"])
+	if err != nil || season < 0 {
+		writeText(writer, http.StatusBadRequest, "api.SearchLibrarySeason: season must be a number: " + params["season"])
+		return
+	}
+
+	grabbed, err := acquire.SearchSeason(Store, params["id"], season)
+	if err != nil && grabbed == nil {
+		acquireError(writer, "api.SearchLibrarySeason", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, grabbed)
+}
+
+// validProfile returns true if the profile exists or is 0 for the default
+// profile. A 400 response is written if it doesn't exist.
+func validProfile(writer http.ResponseWriter, caller string, id uint64) bool {
+	if id == 0 {
+		return true
+	}
+
+	if _, err := Store.Profiles.Get(id); err != nil {
+		if err == storage.ErrNotFound {
+			writeText(writer, http.StatusBadRequest, caller + ": unknown quality profile")
+		} else {
+			profileError(writer, caller, err)
+		}
+		return false
+	}
+	return true
+}
+
+// acquireError responds with the status code that matches a search error.
+func acquireError(writer http.ResponseWriter, caller string, err error) {
+	var status int
+	switch err {
+	case acquire.ErrNoIndexers, acquire.ErrNoClients, acquire.ErrUnavailable:
+		status = http.StatusServiceUnavailable
+	case acquire.ErrNotTv, acquire.ErrUnknownSeason:
+		status = http.StatusBadRequest
+	default:
+		libraryError(writer, caller, err)
+		return
+	}
+
+	log.Error(caller, log.Err(err))
+	writeText(writer, status, err.Error())
+}
+
+// libraryError responds with the status code that matches a library error.
+func libraryError(writer http.ResponseWriter, caller string, err error) {
+	var status int
+	switch err {
+	case storage.ErrNotFound:
+		status = http.StatusNotFound
+	case library.ErrExists:
+		status = http.StatusConflict
+	case library.ErrUnavailable:
+		status = http.StatusServiceUnavailable
+	case library.ErrInvalidId, library.ErrUnknownProvider, library.ErrInvalidState:
+		status = http.StatusBadRequest
+	default:
+		status = http.StatusInternalServerError
+	}
+
+	log.Error(caller, log.Err(err))
+	writeText(writer, status, err.Error())
+}
@@ -0,0 +1,68 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package api
+
+import (
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/naming"
+	"net/http"
+)
+
+// namingView describes the naming templates in use and what they can use.
+type namingView struct {
+	Format  naming.Format   `json:"format"`         // Templates in use.
+	Tokens  []string        `json:"tokens"`         // Tokens the templates can use.
+	Styles  []string        `json:"styles"`         // Multi-episode styles.
+}
+
+// GetNaming returns the naming templates used to import files.
+func GetNaming(writer http.ResponseWriter, request *http.Request) {
+	writeJson(writer, http.StatusOK, namingView {
+		Format: naming.Current,
+		Tokens: naming.Tokens(),
+		Styles: naming.Styles(),
+	})
+}
+
+// PreviewNaming renders example paths from the naming templates in the
+// request body, so they can be checked before being put in the
+// configuration. Fields left empty use the templates in use.
+func PreviewNaming(writer http.ResponseWriter, request *http.Request) {
+	var body naming.Format
+	if err := readJson(request, &body); err != nil {
+		writeText(writer, http.StatusBadRequest, "api.PreviewNaming: invalid request body: " + err.Error())
+		return
+	}
+
+	if len(body.Movie) == 0 {
+		body.Movie = naming.Current.Movie
+	}
+	if len(body.Episode) == 0 {
+		body.Episode = naming.Current.Episode
+	}
+	if len(body.MultiEpisodeStyle) == 0 {
+		body.MultiEpisodeStyle = naming.Current.MultiEpisodeStyle
+	}
+
+	examples, err := body.Preview()
+	if err != nil {
+		log.Warn("api.PreviewNaming", log.Err(err))
+		writeText(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJson(writer, http.StatusOK, examples)
+}
@@ -0,0 +1,57 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package api
+
+import (
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/clients/pms"
+	"github.com/MediaExchange/mex/plex"
+	"net/http"
+)
+
+// ListPlexLibraries lists the libraries of the Plex Media Server.
+func ListPlexLibraries(writer http.ResponseWriter, request *http.Request) {
+	libraries, err := pms.Libraries()
+	if err != nil {
+		plexError(writer, "api.ListPlexLibraries", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, libraries)
+}
+
+// SyncPlex reads the Plex libraries now, marking the movies and episodes
+// Plex already has as downloaded, and responds with what it found.
+func SyncPlex(writer http.ResponseWriter, request *http.Request) {
+	summary, err := plex.Sync(request.Context(), Store)
+	if err != nil {
+		plexError(writer, "api.SyncPlex", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, summary)
+}
+
+// plexError writes the response for an error talking to the Plex Media Server.
+func plexError(writer http.ResponseWriter, caller string, err error) {
+	status := http.StatusBadGateway
+	if err == pms.ErrNotConfigured {
+		status = http.StatusServiceUnavailable
+	}
+
+	log.Error(caller, log.Err(err))
+	writeText(writer, status, err.Error())
+}
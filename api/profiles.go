@@ -0,0 +1,144 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package api
+
+import (
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/router"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/quality"
+	"github.com/MediaExchange/mex/storage"
+	"net/http"
+	"strconv"
+)
+
+// ListQualities lists every quality MEX recognizes, worst first.
+func ListQualities(writer http.ResponseWriter, request *http.Request) {
+	writeJson(writer, http.StatusOK, quality.Qualities())
+}
+
+// ListProfiles lists the quality profiles, oldest first. The first is the
+// default for library items without a profile.
+func ListProfiles(writer http.ResponseWriter, request *http.Request) {
+	list, err := Store.Profiles.List()
+	if err != nil {
+		log.Error("api.ListProfiles: unexpected error", log.Err(err))
+		writeText(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJson(writer, http.StatusOK, list)
+}
+
+// GetProfile returns a single quality profile.
+func GetProfile(writer http.ResponseWriter, request *http.Request) {
+	id, ok := profileId(writer, request)
+	if !ok {
+		return
+	}
+
+	p, err := Store.Profiles.Get(id)
+	if err != nil {
+		profileError(writer, "api.GetProfile", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, p)
+}
+
+// CreateProfile adds a quality profile.
+func CreateProfile(writer http.ResponseWriter, request *http.Request) {
+	var body models.QualityProfile
+	if err := readJson(request, &body); err != nil {
+		writeText(writer, http.StatusBadRequest, "api.CreateProfile: invalid request body: " + err.Error())
+		return
+	}
+
+	body.Id = 0
+	if err := quality.Save(Store.Profiles, &body); err != nil {
+		profileError(writer, "api.CreateProfile", err)
+		return
+	}
+
+	writeJson(writer, http.StatusCreated, body)
+}
+
+// UpdateProfile replaces a quality profile.
+func UpdateProfile(writer http.ResponseWriter, request *http.Request) {
+	id, ok := profileId(writer, request)
+	if !ok {
+		return
+	}
+
+	var body models.QualityProfile
+	if err := readJson(request, &body); err != nil {
+		writeText(writer, http.StatusBadRequest, "api.UpdateProfile: invalid request body: " + err.Error())
+		return
+	}
+
+	body.Id = id
+	if err := quality.Save(Store.Profiles, &body); err != nil {
+		profileError(writer, "api.UpdateProfile", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, body)
+}
+
+// DeleteProfile removes a quality profile that no library item uses.
+func DeleteProfile(writer http.ResponseWriter, request *http.Request) {
+	id, ok := profileId(writer, request)
+	if !ok {
+		return
+	}
+
+	if err := quality.Delete(Store, id); err != nil {
+		profileError(writer, "api.DeleteProfile", err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// profileId returns the `id` path parameter as a profile ID. A 400 response
+// is written if it isn't a number.
+func profileId(writer http.ResponseWriter, request *http.Request) (uint64, bool) {
+	param := router.GetParams(request.Context())["id"]
+	id, err := strconv.ParseUint(param, 10, 64)
+	if err != nil {
+		writeText(writer, http.StatusBadRequest, "profile id must be a number: " + param)
+		return 0, false
+	}
+	return id, true
+}
+
+// profileError responds with the status code that matches a profile error.
+func profileError(writer http.ResponseWriter, caller string, err error) {
+	var status int
+	switch err {
+	case storage.ErrNotFound:
+		status = http.StatusNotFound
+	case quality.ErrProfileExists, quality.ErrProfileInUse, quality.ErrLastProfile:
+		status = http.StatusConflict
+	case quality.ErrInvalidProfile, quality.ErrUnknownQuality, quality.ErrInvalidCutoff, quality.ErrInvalidSize, quality.ErrInvalidWord:
+		status = http.StatusBadRequest
+	default:
+		status = http.StatusInternalServerError
+	}
+
+	log.Error(caller, log.Err(err))
+	writeText(writer, status, err.Error())
+}
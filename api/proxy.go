@@ -18,6 +18,8 @@ package api
 import (
 	"github.com/MediaExchange/log"
 	"github.com/MediaExchange/router"
+	"github.com/MediaExchange/mex/clients/tmdb"
+	"github.com/MediaExchange/mex/clients/tvdb"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -38,6 +40,14 @@ func Proxy(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
+	// Only images from the providers are proxied, so MEX can't be used to
+	// reach arbitrary hosts from inside the network.
+	if !proxyAllowed(urlString) {
+		log.Error("api.Proxy url is not a provider image.", log.String("url", urlString))
+		writer.WriteHeader(http.StatusForbidden)
+		return
+	}
+
 	log.Info("api.Proxy", log.String("url", urlString))
 
 	res, err := http.Get(urlString)
@@ -66,3 +76,13 @@ func Proxy(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 }
+
+// proxyAllowed returns true if the URL is an image hosted by a provider.
+func proxyAllowed(urlString string) bool {
+	for _, prefix := range []string{tmdb.ImageUri, tvdb.ImageUri} {
+		if strings.HasPrefix(urlString, prefix) {
+			return true
+		}
+	}
+	return false
+}
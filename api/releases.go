@@ -0,0 +1,163 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package api
+
+import (
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/router"
+	"github.com/MediaExchange/mex/blocklist"
+	"github.com/MediaExchange/mex/clients/torznab"
+	"github.com/MediaExchange/mex/history"
+	"github.com/MediaExchange/mex/library"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/quality"
+	"github.com/MediaExchange/mex/releases"
+	"net/http"
+	"strconv"
+)
+
+// ListReleases searches every indexer for releases of the media in the `id`
+// query parameter, in the format `provider:id`. For TV shows the optional
+// `season` and `episode` parameters narrow the search.
+func ListReleases(writer http.ResponseWriter, request *http.Request) {
+	details, season, episode, ok := releaseSearch(writer, request, "api.ListReleases")
+	if !ok {
+		return
+	}
+
+	response := releases.Search(details, season, episode)
+	writeJson(writer, searchStatus(response.Indexers), response)
+}
+
+// ListDecisions searches like ListReleases and judges every release against
+// a quality profile, listing why each rejected release was skipped. The
+// optional `profile` parameter chooses the profile; otherwise the library
+// item's profile, or the default profile, is used.
+func ListDecisions(writer http.ResponseWriter, request *http.Request) {
+	params := router.GetParams(request.Context())
+
+	// Media that isn't in the library hasn't been downloaded.
+	item, _ := Store.Media.Get(params["id"])
+
+	profileId := uint64(0)
+	if v := params["profile"]; len(v) > 0 {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeText(writer, http.StatusBadRequest, "api.ListDecisions: `profile` must be a number")
+			return
+		}
+		profileId = n
+	} else if item != nil {
+		profileId = item.ProfileId
+	}
+
+	profile, err := quality.Profile(Store.Profiles, profileId)
+	if err != nil {
+		profileError(writer, "api.ListDecisions", err)
+		return
+	}
+
+	details, season, episode, ok := releaseSearch(writer, request, "api.ListDecisions")
+	if !ok {
+		return
+	}
+
+	current, err := downloadedQuality(item, season, episode)
+	if err != nil {
+		log.Error("api.ListDecisions: unable to read the history", log.Err(err))
+		writeText(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	found := releases.Search(details, season, episode)
+	decisions, err := blocklist.Reject(Store.Blocklist, quality.Decide(profile, details, season, episode, current, found.Releases))
+	if err != nil {
+		log.Error("api.ListDecisions: unable to read the blocklist", log.Err(err))
+		writeText(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := models.DecisionResponse {
+		Profile:   *profile,
+		Decisions: decisions,
+		Indexers:  found.Indexers,
+	}
+	writeJson(writer, searchStatus(response.Indexers), response)
+}
+
+// downloadedQuality returns the quality of the downloaded copy of a movie or
+// episode in the library, or an empty string if it hasn't been downloaded.
+// Season packs are judged as if nothing was downloaded.
+func downloadedQuality(item *models.MediaItem, season int, episode int) (string, error) {
+	if item == nil {
+		return "", nil
+	}
+
+	if item.Type == models.Movie {
+		if item.State != models.Downloaded {
+			return "", nil
+		}
+	} else if e := item.FindEpisode(season, episode); e == nil || e.State != models.Downloaded {
+		return "", nil
+	}
+
+	have, err := history.Qualities(Store.History, item.Id)
+	if err != nil {
+		return "", err
+	}
+	return have[history.Episode{Season: season, Episode: episode}], nil
+}
+
+// releaseSearch reads the parameters of a release search and looks up the
+// media. A response is written if they aren't valid.
+func releaseSearch(writer http.ResponseWriter, request *http.Request, caller string) (*models.Details, int, int, bool) {
+	params := router.GetParams(request.Context())
+
+	var numbers [2]int
+	for i, name := range []string{"season", "episode"} {
+		if v := params[name]; len(v) > 0 {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				writeText(writer, http.StatusBadRequest, caller + ": `" + name + "` must be a number")
+				return nil, 0, 0, false
+			}
+			numbers[i] = n
+		}
+	}
+
+	if len(torznab.Indexers()) == 0 {
+		writeText(writer, http.StatusServiceUnavailable, caller + ": no indexers are configured")
+		return nil, 0, 0, false
+	}
+
+	details, err := library.Lookup(params["id"])
+	if err != nil {
+		libraryError(writer, caller, err)
+		return nil, 0, 0, false
+	}
+
+	return details, numbers[0], numbers[1], true
+}
+
+// searchStatus returns 200 if any indexer answered, otherwise 503.
+func searchStatus(indexers []models.ProviderState) int {
+	for _, i := range indexers {
+		if i.Available {
+			return http.StatusOK
+		}
+	}
+	return http.StatusServiceUnavailable
+}
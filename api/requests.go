@@ -0,0 +1,168 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package api
+
+import (
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/router"
+	"github.com/MediaExchange/mex/auth"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/requests"
+	"github.com/MediaExchange/mex/storage"
+	"net/http"
+	"strconv"
+)
+
+// submitRequest is the request body of SubmitRequest.
+type submitRequest struct {
+	Id          string  `json:"id"`             // ID of the media in the format `provider:id`.
+	Seasons     []int   `json:"seasons"`        // Seasons of a TV show. Empty for a movie or the whole series.
+}
+
+// reviewRequest is the request body of ApproveRequest and DenyRequest.
+type reviewRequest struct {
+	Comment     string  `json:"comment"`        // Optional note for the requesters.
+}
+
+// ListRequests lists media requests, newest first. The optional query
+// parameter `status` limits the list to pending, approved, denied or
+// available requests.
+func ListRequests(writer http.ResponseWriter, request *http.Request) {
+	status := models.RequestStatus(router.GetParams(request.Context())["status"])
+	if len(status) > 0 && !requests.ValidStatus(status) {
+		writeText(writer, http.StatusBadRequest, "api.ListRequests: `status` must be pending, approved, denied or available")
+		return
+	}
+
+	list, err := requests.List(Store.Requests, status)
+	if err != nil {
+		log.Error("api.ListRequests: unexpected error", log.Err(err))
+		writeText(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJson(writer, http.StatusOK, list)
+}
+
+// GetRequest returns a single media request.
+func GetRequest(writer http.ResponseWriter, request *http.Request) {
+	id, ok := requestId(writer, request)
+	if !ok {
+		return
+	}
+
+	r, err := Store.Requests.Get(id)
+	if err != nil {
+		requestError(writer, "api.GetRequest", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, r)
+}
+
+// SubmitRequest asks for media to be acquired. Requests for a title that
+// already has an open request are merged into it.
+func SubmitRequest(writer http.ResponseWriter, request *http.Request) {
+	var body submitRequest
+	if err := readJson(request, &body); err != nil {
+		writeText(writer, http.StatusBadRequest, "api.SubmitRequest: invalid request body: " + err.Error())
+		return
+	}
+
+	r, err := requests.Submit(Store, body.Id, body.Seasons, auth.Username(request.Context()))
+	if err != nil {
+		requestError(writer, "api.SubmitRequest", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, r)
+}
+
+// ApproveRequest approves a pending request and adds the media to the library.
+func ApproveRequest(writer http.ResponseWriter, request *http.Request) {
+	review(writer, request, "api.ApproveRequest", requests.Approve)
+}
+
+// DenyRequest denies an open request.
+func DenyRequest(writer http.ResponseWriter, request *http.Request) {
+	review(writer, request, "api.DenyRequest", requests.Deny)
+}
+
+// DeleteRequest removes a media request.
+func DeleteRequest(writer http.ResponseWriter, request *http.Request) {
+	id, ok := requestId(writer, request)
+	if !ok {
+		return
+	}
+
+	if err := Store.Requests.Delete(id); err != nil {
+		requestError(writer, "api.DeleteRequest", err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// review applies an admin's decision to a request.
+func review(writer http.ResponseWriter, request *http.Request, caller string, decide func(*storage.Store, uint64, string, string) (*models.MediaRequest, error)) {
+	id, ok := requestId(writer, request)
+	if !ok {
+		return
+	}
+
+	// The comment is optional, so the body may be left out.
+	var body reviewRequest
+	if request.ContentLength > 0 {
+		if err := readJson(request, &body); err != nil {
+			writeText(writer, http.StatusBadRequest, caller + ": invalid request body: " + err.Error())
+			return
+		}
+	}
+
+	r, err := decide(Store, id, auth.Username(request.Context()), body.Comment)
+	if err != nil {
+		requestError(writer, caller, err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, r)
+}
+
+// requestId returns the `id` path parameter as a request ID. A 400 response
+// is written if it isn't a number.
+func requestId(writer http.ResponseWriter, request *http.Request) (uint64, bool) {
+	param := router.GetParams(request.Context())["id"]
+	id, err := strconv.ParseUint(param, 10, 64)
+	if err != nil {
+		writeText(writer, http.StatusBadRequest, "request id must be a number: " + param)
+		return 0, false
+	}
+	return id, true
+}
+
+// requestError responds with the status code that matches a request error.
+func requestError(writer http.ResponseWriter, caller string, err error) {
+	switch err {
+	case requests.ErrInvalidTransition:
+		log.Error(caller, log.Err(err))
+		writeText(writer, http.StatusConflict, err.Error())
+	case requests.ErrSeasonsForMovie:
+		log.Error(caller, log.Err(err))
+		writeText(writer, http.StatusBadRequest, err.Error())
+	default:
+		libraryError(writer, caller, err)
+	}
+}
@@ -0,0 +1,146 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package api
+
+import (
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/router"
+	"github.com/MediaExchange/mex/library"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/scanner"
+	"github.com/MediaExchange/mex/storage"
+	"net/http"
+	"strconv"
+)
+
+// resolveScanEntry is the request body of ResolveScanEntry.
+type resolveScanEntry struct {
+	MediaId     string  `json:"mediaId"`        // ID of the media in the format `provider:id`.
+}
+
+// ScanLibrary starts scanning the library folders and responds with 202
+// Accepted. What the scan found is sent as a library.scanned event once it
+// finishes. Only one scan runs at a time.
+func ScanLibrary(writer http.ResponseWriter, request *http.Request) {
+	if err := scanner.Start(Store); err != nil {
+		scanError(writer, "api.ScanLibrary", err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusAccepted)
+}
+
+// ListScanEntries lists the folders found by the scanner, sorted by path.
+// The optional query parameter `status` (matched, pending or ignored)
+// filters the list.
+func ListScanEntries(writer http.ResponseWriter, request *http.Request) {
+	params := router.GetParams(request.Context())
+
+	list, err := scanner.List(Store.Scans, scanner.Filter{Status: models.ScanStatus(params["status"])})
+	if err != nil {
+		log.Error("api.ListScanEntries: unexpected error", log.Err(err))
+		writeText(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJson(writer, http.StatusOK, list)
+}
+
+// ResolveScanEntry matches a scanned folder with the media in the body,
+// `{"mediaId": "tmdb:603"}`, usually one of its candidates.
+func ResolveScanEntry(writer http.ResponseWriter, request *http.Request) {
+	id, ok := scanEntryId(writer, request)
+	if !ok {
+		return
+	}
+
+	var body resolveScanEntry
+	if err := readJson(request, &body); err != nil {
+		writeText(writer, http.StatusBadRequest, "api.ResolveScanEntry: invalid request body: " + err.Error())
+		return
+	}
+
+	entry, err := scanner.Resolve(Store, id, body.MediaId)
+	if err != nil {
+		scanError(writer, "api.ResolveScanEntry", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, entry)
+}
+
+// IgnoreScanEntry leaves a scanned folder out of the library.
+func IgnoreScanEntry(writer http.ResponseWriter, request *http.Request) {
+	id, ok := scanEntryId(writer, request)
+	if !ok {
+		return
+	}
+
+	entry, err := scanner.Ignore(Store, id)
+	if err != nil {
+		scanError(writer, "api.IgnoreScanEntry", err)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, entry)
+}
+
+// DeleteScanEntry forgets a scanned folder so the next scan matches it again.
+func DeleteScanEntry(writer http.ResponseWriter, request *http.Request) {
+	id, ok := scanEntryId(writer, request)
+	if !ok {
+		return
+	}
+
+	if err := scanner.Remove(Store, id); err != nil {
+		scanError(writer, "api.DeleteScanEntry", err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// scanEntryId returns the `id` path parameter, or writes an error response
+// if it isn't a number.
+func scanEntryId(writer http.ResponseWriter, request *http.Request) (uint64, bool) {
+	param := router.GetParams(request.Context())["id"]
+	id, err := strconv.ParseUint(param, 10, 64)
+	if err != nil {
+		writeText(writer, http.StatusBadRequest, "scan entry id must be a number: " + param)
+		return 0, false
+	}
+	return id, true
+}
+
+// scanError writes the response for an error from the scanner.
+func scanError(writer http.ResponseWriter, caller string, err error) {
+	var status int
+	switch err {
+	case storage.ErrNotFound:
+		status = http.StatusNotFound
+	case scanner.ErrScanning, scanner.ErrMissing:
+		status = http.StatusConflict
+	case scanner.ErrNoRoot, library.ErrUnavailable:
+		status = http.StatusServiceUnavailable
+	case scanner.ErrWrongType, library.ErrInvalidId, library.ErrUnknownProvider:
+		status = http.StatusBadRequest
+	default:
+		status = http.StatusInternalServerError
+	}
+
+	log.Error(caller, log.Err(err))
+	writeText(writer, status, err.Error())
+}
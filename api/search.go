@@ -21,14 +21,22 @@ import (
 	"github.com/MediaExchange/router"
 	"github.com/MediaExchange/mex/clients/tmdb"
 	"github.com/MediaExchange/mex/clients/tvdb"
+	"github.com/MediaExchange/mex/health"
 	"github.com/MediaExchange/mex/models"
 	"net/http"
 )
 
+// searchProviders are searched in this order.
+var searchProviders = []struct {
+	name   string
+	search func(string, *[]models.SearchResult) error
+}{
+	{"tmdb", tmdb.Search},
+	{"tvdb", tvdb.Search},
+}
+
 // Search finds media from all the search providers that matches the requested name.
 func Search(writer http.ResponseWriter, request *http.Request) {
-	writer.Header().Add("Access-Control-Allow-Origin", "*")
-
 	// Get the name from the `?q=` query parameter.
 	params := router.GetParams(request.Context())
 	name := params["q"]
@@ -38,29 +46,43 @@ func Search(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	results := make([]models.SearchResult, 0)
+	response := models.SearchResponse {
+		Results:   make([]models.SearchResult, 0),
+		Providers: make([]models.ProviderState, 0),
+	}
 
-	err := tmdb.Search(name, &results)
-	if err != nil {
-		// Error was already logged in tmdb.Search. Just report it back to the client.
-		writer.Header().Set("Content-Type", "text/plain")
-		writer.WriteHeader(http.StatusInternalServerError)
-		_, _ = writer.Write([]byte(err.Error()))
-		return
+	// Search each provider that is available. A provider that is down or
+	// fails is reported in the response instead of failing the whole search.
+	available := 0
+	for _, p := range searchProviders {
+		state := models.ProviderState {
+			Name: p.name,
+		}
+
+		if status := health.Provider(p.name); !status.Available() {
+			state.Error = "provider is unavailable"
+			if len(status.Error) > 0 {
+				state.Error = status.Error
+			}
+		} else if err := p.search(name, &response.Results); err != nil {
+			// Error was already logged by the provider.
+			state.Error = err.Error()
+		} else {
+			state.Available = true
+			available++
+		}
+
+		response.Providers = append(response.Providers, state)
 	}
 
-	err = tvdb.Search(name, &results)
-	if err != nil {
-		// Error was already logged in tvdb.Search. Just report it back to the client.
-		writer.Header().Set("Content-Type", "text/plain")
-		writer.WriteHeader(http.StatusInternalServerError)
-		_, _ = writer.Write([]byte(err.Error()))
-		return
+	status := http.StatusOK
+	if available == 0 {
+		status = http.StatusServiceUnavailable
 	}
 
 	writer.Header().Add("Content-Type", "application/json")
-	writer.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(writer).Encode(results)
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(response)
 	return
 
 	/*
@@ -89,7 +111,6 @@ func Search(writer http.ResponseWriter, request *http.Request) {
 
 	// Respond with the combined results.
 	writer.Header().Add("Content-Type", "application/json")
-	writer.Header().Add("Access-Control-Allow-Origin", "*")
 
 	if err := json.NewEncoder(writer).Encode(results); err != nil {
 		log.Error("api.Search: serializer error", log.Err(err))
@@ -0,0 +1,91 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/router"
+	"github.com/MediaExchange/mex/auth"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/plex"
+	"net/http"
+)
+
+// Largest webhook accepted. Plex attaches a thumbnail to some events.
+const maxWebhookSize = 10 << 20
+
+// PlexWebhook receives the webhooks of a Plex Media Server. Plex posts a
+// multipart form whose `payload` field holds the event as JSON. The `secret`
+// query parameter must match the configured webhook secret.
+func PlexWebhook(writer http.ResponseWriter, request *http.Request) {
+	if len(plex.WebhookSecret) == 0 {
+		writeText(writer, http.StatusServiceUnavailable, "api.PlexWebhook: plex.webhook_secret isn't configured")
+		return
+	}
+
+	secret := router.GetParams(request.Context())["secret"]
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(plex.WebhookSecret)) != 1 {
+		log.Warn("api.PlexWebhook: wrong secret", log.String("remote", request.RemoteAddr))
+		writeText(writer, http.StatusForbidden, "api.PlexWebhook: wrong secret")
+		return
+	}
+
+	request.Body = http.MaxBytesReader(writer, request.Body, maxWebhookSize)
+	if err := request.ParseMultipartForm(maxWebhookSize); err != nil && err != http.ErrNotMultipart {
+		writeText(writer, http.StatusBadRequest, "api.PlexWebhook: invalid form: " + err.Error())
+		return
+	}
+
+	var payload plex.Payload
+	if err := json.Unmarshal([]byte(request.FormValue("payload")), &payload); err != nil {
+		writeText(writer, http.StatusBadRequest, "api.PlexWebhook: invalid payload: " + err.Error())
+		return
+	}
+
+	if err := plex.Handle(Store, &payload); err != nil {
+		log.Error("api.PlexWebhook", log.String("event", payload.Event), log.Err(err))
+		writeText(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// ListWatchHistory lists what users watched in Plex, newest first. The
+// optional query parameters `user` and `mediaId` filter the list. Users
+// other than admins only see their own history.
+func ListWatchHistory(writer http.ResponseWriter, request *http.Request) {
+	params := router.GetParams(request.Context())
+
+	filter := plex.WatchFilter {
+		User:    params["user"],
+		MediaId: params["mediaId"],
+	}
+	if user := auth.User(request.Context()); !auth.Allows(user, models.Admin) {
+		filter.User = user.Username
+	}
+
+	list, err := plex.ListWatches(Store.Watches, filter)
+	if err != nil {
+		log.Error("api.ListWatchHistory: unexpected error", log.Err(err))
+		writeText(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJson(writer, http.StatusOK, list)
+}
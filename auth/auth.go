@@ -0,0 +1,271 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package auth implements local user accounts. Users log in with a password
+// to get a session cookie, or call the API with a token. Every request is
+// checked against the user's role: viewers can browse, requesters can also
+// ask for media, and admins can do everything.
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/storage"
+	"golang.org/x/crypto/bcrypt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Shortest password accepted.
+	minPasswordLength = 8
+)
+
+var (
+	// ErrInvalidCredentials is returned when a username or password is wrong.
+	ErrInvalidCredentials = errors.New("auth: invalid username or password")
+
+	// ErrInvalidUsername is returned when a username contains unsupported characters.
+	ErrInvalidUsername = errors.New("auth: username must be 1 to 64 letters, digits, or . _ - @")
+
+	// ErrWeakPassword is returned when a password is too short.
+	ErrWeakPassword = errors.New("auth: password must be at least 8 characters")
+
+	// ErrInvalidRole is returned when a role is not admin, requester or viewer.
+	ErrInvalidRole = errors.New("auth: role must be admin, requester or viewer")
+
+	// ErrUserExists is returned when creating a user whose username is taken.
+	ErrUserExists = errors.New("auth: username is already taken")
+
+	// ErrSetupComplete is returned when creating the first admin after users exist.
+	ErrSetupComplete = errors.New("auth: setup has already been completed")
+
+	// ErrLastAdmin is returned when changing the role of the only admin.
+	ErrLastAdmin = errors.New("auth: the last admin can't be given another role")
+
+	// Characters allowed in a username.
+	usernameRE = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+	// Compared against when a user doesn't exist so the response takes as long as for a wrong password.
+	dummyHash, _ = bcrypt.GenerateFromPassword([]byte("mex-dummy-password"), bcrypt.DefaultCost)
+
+	// Held while users are created or their roles change, so two requests
+	// can't both take a username, complete setup or demote the last admin.
+	mutex sync.Mutex
+
+	// Rank of each role. A user may do anything a lower-ranked role may do.
+	ranks = map[models.Role]int {
+		models.Viewer:    1,
+		models.Requester: 2,
+		models.Admin:     3,
+	}
+)
+
+// contextKey is the type of the request context key holding the user.
+type contextKey struct{}
+
+// WithUser returns a context that carries the user.
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// User returns the logged in user from a request context, or nil.
+func User(ctx context.Context) *models.User {
+	user, _ := ctx.Value(contextKey{}).(*models.User)
+	return user
+}
+
+// Username returns the name of the logged in user, or an empty string.
+func Username(ctx context.Context) string {
+	if user := User(ctx); user != nil {
+		return user.Username
+	}
+	return ""
+}
+
+// Allows returns true if the user's role includes everything role may do.
+func Allows(user *models.User, role models.Role) bool {
+	return user != nil && ranks[user.Role] >= ranks[role]
+}
+
+// ValidRole returns true if role is one of the known roles.
+func ValidRole(role models.Role) bool {
+	_, ok := ranks[role]
+	return ok
+}
+
+// CreateUser adds a user with a password and role.
+func CreateUser(repo storage.UserRepository, username string, password string, role models.Role) (*models.User, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return createUser(repo, username, password, role)
+}
+
+// createUser adds a user, as with CreateUser. The caller holds the mutex.
+func createUser(repo storage.UserRepository, username string, password string, role models.Role) (*models.User, error) {
+	if !usernameRE.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+
+	if !ValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+
+	if len(password) < minPasswordLength {
+		return nil, ErrWeakPassword
+	}
+
+	if _, err := repo.Get(username); err == nil {
+		return nil, ErrUserExists
+	} else if err != storage.ErrNotFound {
+		return nil, err
+	}
+
+	user := &models.User {
+		Username: username,
+		Role:     role,
+		Created:  time.Now(),
+	}
+
+	// The user is saved first so a password is never stored for a user that doesn't exist.
+	if err := repo.Save(user); err != nil {
+		log.Error("auth.CreateUser: unable to save user", log.String("username", username), log.Err(err))
+		return nil, err
+	}
+
+	if err := SetPassword(repo, username, password); err != nil {
+		log.Error("auth.CreateUser: unable to save password", log.String("username", username), log.Err(err))
+		_ = repo.Delete(username)
+		return nil, err
+	}
+
+	log.Info("auth.CreateUser", log.String("username", username), log.String("role", string(role)))
+	return user, nil
+}
+
+// Setup creates the first admin. It fails once any user exists.
+func Setup(repo storage.UserRepository, username string, password string) (*models.User, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	required, err := SetupRequired(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	if !required {
+		return nil, ErrSetupComplete
+	}
+
+	return createUser(repo, username, password, models.Admin)
+}
+
+// SetRole changes a user's role. The last admin can't be given another role,
+// or nobody could manage MEX.
+func SetRole(repo storage.UserRepository, username string, role models.Role) (*models.User, error) {
+	if !ValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	users, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var user *models.User
+	admins := 0
+	for i := range users {
+		if users[i].Role == models.Admin {
+			admins++
+		}
+		if strings.EqualFold(users[i].Username, username) {
+			user = &users[i]
+		}
+	}
+
+	if user == nil {
+		return nil, storage.ErrNotFound
+	}
+	if user.Role == models.Admin && role != models.Admin && admins == 1 {
+		return nil, ErrLastAdmin
+	}
+
+	user.Role = role
+	if err := repo.Save(user); err != nil {
+		log.Error("auth.SetRole: unable to save user", log.String("username", username), log.Err(err))
+		return nil, err
+	}
+
+	log.Info("auth.SetRole", log.String("username", user.Username), log.String("role", string(role)))
+	return user, nil
+}
+
+// SetupRequired returns true until the first user has been created.
+func SetupRequired(repo storage.UserRepository) (bool, error) {
+	count, err := repo.Count()
+	if err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+// SetPassword hashes and stores a user's password. The user's sessions and
+// API tokens are revoked, so whoever knew the old password is logged out.
+func SetPassword(repo storage.UserRepository, username string, password string) error {
+	if len(password) < minPasswordLength {
+		return ErrWeakPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	return repo.SetPasswordHash(username, hash)
+}
+
+// Verify returns the user if the password is correct.
+func Verify(repo storage.UserRepository, username string, password string) (*models.User, error) {
+	user, err := repo.Get(username)
+	if err == storage.ErrNotFound {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+
+	hash, err := repo.PasswordHash(username)
+	if err == storage.ErrNotFound {
+		// Users without a password can only log in some other way.
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
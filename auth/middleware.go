@@ -0,0 +1,59 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package auth
+
+import (
+	"github.com/MediaExchange/router"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/storage"
+	"net/http"
+)
+
+// Authenticate wraps a handler, usually the router, so that every request
+// carries the logged in user in its context. It does not reject anything;
+// that is left to Require on each route.
+func Authenticate(store *storage.Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if user := Resolve(store, request); user != nil {
+			request = request.WithContext(WithUser(request.Context(), user))
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// Require wraps a route handler so that it only runs for users with at
+// least the given role. Anonymous requests get 401 Unauthorized and users
+// without the role get 403 Forbidden.
+func Require(role models.Role, next router.Handler) router.Handler {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		user := User(request.Context())
+		if user == nil {
+			writer.Header().Set("Content-Type", "text/plain")
+			writer.WriteHeader(http.StatusUnauthorized)
+			_, _ = writer.Write([]byte("login required"))
+			return
+		}
+
+		if !Allows(user, role) {
+			writer.Header().Set("Content-Type", "text/plain")
+			writer.WriteHeader(http.StatusForbidden)
+			_, _ = writer.Write([]byte("forbidden: requires the " + string(role) + " role"))
+			return
+		}
+
+		next(writer, request)
+	}
+}
@@ -0,0 +1,162 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/clients/plextv"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/storage"
+	"time"
+)
+
+var (
+	// ErrPlexDisabled is returned when no Plex server has been configured.
+	ErrPlexDisabled = errors.New("auth: Plex sign in is not configured")
+
+	// ErrNoServerAccess is returned when a Plex user can't access the configured server.
+	ErrNoServerAccess = errors.New("auth: this Plex account does not have access to the server")
+
+	// ErrInvalidPlexAccount is returned when plex.tv doesn't say which account signed in.
+	ErrInvalidPlexAccount = errors.New("auth: plex.tv did not identify the account")
+
+	// PlexServerId is the machine identifier of the Plex Media Server whose
+	// users may sign in. Plex sign in is disabled when it is empty.
+	PlexServerId string
+
+	// PlexDefaultRole is given to Plex users the first time they sign in.
+	// The owner of the server always becomes an admin.
+	PlexDefaultRole = models.Requester
+)
+
+// LoginWithPlex signs in a Plex user who has access to the configured server,
+// creating a MEX account for them the first time. The returned token is the
+// value of the session cookie.
+func LoginWithPlex(store *storage.Store, plexToken string) (*models.User, string, error) {
+	if len(PlexServerId) == 0 {
+		return nil, "", ErrPlexDisabled
+	}
+
+	account, err := plextv.GetAccount(plexToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Local accounts have no Plex ID, so a reply without one would match them.
+	if account.Id == 0 {
+		log.Warn("auth.LoginWithPlex: account has no id", log.String("plexUser", account.Username))
+		return nil, "", ErrInvalidPlexAccount
+	}
+
+	access, owner, err := plextv.ServerAccess(plexToken, PlexServerId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !access {
+		log.Warn("auth.LoginWithPlex: no access to server", log.String("plexUser", account.Username))
+		return nil, "", ErrNoServerAccess
+	}
+
+	user, err := plexUser(store.Users, account, owner)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, err := StartSession(store, user)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, token, nil
+}
+
+// plexUser returns the MEX account linked to the Plex account, creating it
+// if necessary. The server owner is always an admin.
+func plexUser(repo storage.UserRepository, account *plextv.Account, owner bool) (*models.User, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	users, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range users {
+		user := &users[i]
+		if user.PlexId == 0 || user.PlexId != account.Id {
+			continue
+		}
+
+		if owner && user.Role != models.Admin {
+			log.Info("auth.plexUser: promoting server owner to admin", log.String("username", user.Username))
+			user.Role = models.Admin
+			if err := repo.Save(user); err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	}
+
+	username, err := plexUsername(repo, account)
+	if err != nil {
+		return nil, err
+	}
+
+	role := PlexDefaultRole
+	if owner {
+		role = models.Admin
+	}
+
+	user := &models.User {
+		Username: username,
+		Role:     role,
+		PlexId:   account.Id,
+		Email:    account.Email,
+		Created:  time.Now(),
+	}
+	if err := repo.Save(user); err != nil {
+		log.Error("auth.plexUser: unable to save user", log.String("username", username), log.Err(err))
+		return nil, err
+	}
+
+	log.Info("auth.plexUser: created user for Plex account", log.String("username", username), log.String("role", string(role)))
+	return user, nil
+}
+
+// plexUsername returns the Plex username unless it is taken by someone else
+// or can't be used here. Then plex-<id> is used, with a number added until
+// it's free.
+func plexUsername(repo storage.UserRepository, account *plextv.Account) (string, error) {
+	username := account.Username
+	for n := 1; ; n++ {
+		if usernameRE.MatchString(username) {
+			_, err := repo.Get(username)
+			if err == storage.ErrNotFound {
+				return username, nil
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+
+		username = fmt.Sprintf("plex-%d", account.Id)
+		if n > 1 {
+			username = fmt.Sprintf("plex-%d-%d", account.Id, n)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/storage"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// CookieName is the name of the session cookie.
+	CookieName = "mex_session"
+
+	// Prefix of the Authorization header carrying an API token.
+	bearerPrefix = "Bearer "
+)
+
+var (
+	// SessionLifetime is how long a session lasts after logging in.
+	SessionLifetime = 30 * 24 * time.Hour
+
+	// SecureCookies marks session cookies as HTTPS-only. Requests received
+	// over TLS always get secure cookies.
+	SecureCookies = false
+)
+
+// Login verifies a user's password and starts a session. The returned
+// token is the value of the session cookie.
+func Login(store *storage.Store, username string, password string) (*models.User, string, error) {
+	user, err := Verify(store.Users, username, password)
+	if err != nil {
+		log.Warn("auth.Login: failed login", log.String("username", username))
+		return nil, "", err
+	}
+
+	token, err := StartSession(store, user)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, token, nil
+}
+
+// StartSession starts a session for a user who has already been verified.
+// The returned token is the value of the session cookie.
+func StartSession(store *storage.Store, user *models.User) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	session := &models.Session {
+		Username: user.Username,
+		Created:  now,
+		Expires:  now.Add(SessionLifetime),
+	}
+	if err := store.Sessions.Save(hash(token), session); err != nil {
+		log.Error("auth.StartSession: unable to save session", log.Err(err))
+		return "", err
+	}
+
+	user.LastLogin = now
+	if err := store.Users.Save(user); err != nil {
+		log.Error("auth.StartSession: unable to save user", log.Err(err))
+		return "", err
+	}
+
+	log.Info("auth.StartSession", log.String("username", user.Username))
+	return token, nil
+}
+
+// Logout ends the session identified by the session cookie value.
+func Logout(store *storage.Store, token string) error {
+	err := store.Sessions.Delete(hash(token))
+	if err == storage.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// CreateToken creates an API token for a user. The token is only returned
+// here; MEX keeps just its hash.
+func CreateToken(store *storage.Store, username string, name string) (string, *models.ApiToken, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	t := &models.ApiToken {
+		Id:       hash(token),
+		Name:     name,
+		Username: username,
+		Created:  time.Now(),
+	}
+	if err := store.Tokens.Save(t); err != nil {
+		log.Error("auth.CreateToken: unable to save token", log.Err(err))
+		return "", nil, err
+	}
+
+	log.Info("auth.CreateToken", log.String("username", username), log.String("name", name))
+	return token, t, nil
+}
+
+// SetCookie adds the session cookie to a response.
+func SetCookie(writer http.ResponseWriter, request *http.Request, token string) {
+	http.SetCookie(writer, &http.Cookie {
+		Name:     CookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  time.Now().Add(SessionLifetime),
+		HttpOnly: true,
+		Secure:   SecureCookies || request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearCookie removes the session cookie from the browser.
+func ClearCookie(writer http.ResponseWriter, request *http.Request) {
+	http.SetCookie(writer, &http.Cookie {
+		Name:     CookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   SecureCookies || request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Resolve returns the user making a request, identified by an API token in
+// the Authorization header or by the session cookie, or nil.
+func Resolve(store *storage.Store, request *http.Request) *models.User {
+	var username string
+
+	if header := request.Header.Get("Authorization"); strings.HasPrefix(header, bearerPrefix) {
+		t, err := store.Tokens.Get(hash(strings.TrimPrefix(header, bearerPrefix)))
+		if err != nil {
+			return nil
+		}
+
+		// Only record the last use occasionally so every request isn't a database write.
+		if time.Since(t.LastUsed) > time.Hour {
+			t.LastUsed = time.Now()
+			_ = store.Tokens.Save(t)
+		}
+		username = t.Username
+	} else if cookie, err := request.Cookie(CookieName); err == nil {
+		session, err := store.Sessions.Get(hash(cookie.Value))
+		if err != nil || session.Expires.Before(time.Now()) {
+			return nil
+		}
+		username = session.Username
+	} else {
+		return nil
+	}
+
+	user, err := store.Users.Get(username)
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+// Token returns the session cookie value from a request, or an empty string.
+func Token(request *http.Request) string {
+	if cookie, err := request.Cookie(CookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// newToken returns a random token encoded as hex.
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		log.Error("auth.newToken: unable to read random bytes", log.Err(err))
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// hash returns the key a token is stored under, so a copy of the database
+// doesn't give access to MEX.
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
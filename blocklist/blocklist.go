@@ -0,0 +1,140 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package blocklist keeps the releases MEX won't grab again, such as fakes
+// and releases whose downloads failed. A release is blocked if its torrent
+// info hash matches an entry, or if its name and indexer do.
+package blocklist
+
+import (
+	"fmt"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/storage"
+	"strings"
+	"time"
+)
+
+// Filter limits the entries returned by List and removed by Clear. Empty
+// fields match everything.
+type Filter struct {
+	MediaId string
+}
+
+// Add blocklists a release, dated now.
+func Add(repo storage.BlocklistRepository, entry models.BlocklistEntry) (*models.BlocklistEntry, error) {
+	entry.Id = 0
+	entry.InfoHash = strings.ToLower(entry.InfoHash)
+	entry.Date = time.Now()
+	if err := repo.Save(&entry); err != nil {
+		log.Error("blocklist.Add: unable to save entry", log.String("release", entry.Release), log.Err(err))
+		return nil, err
+	}
+
+	log.Info("blocklist.Add", log.String("mediaId", entry.MediaId), log.String("release", entry.Release), log.String("reason", entry.Reason))
+	return &entry, nil
+}
+
+// List returns the entries that match the filter, newest first.
+func List(repo storage.BlocklistRepository, filter Filter) ([]models.BlocklistEntry, error) {
+	all, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.BlocklistEntry, 0, len(all))
+	for i := len(all) - 1; i >= 0; i-- {
+		if len(filter.MediaId) > 0 && all[i].MediaId != filter.MediaId {
+			continue
+		}
+		list = append(list, all[i])
+	}
+	return list, nil
+}
+
+// Remove deletes an entry, so its release can be grabbed again.
+func Remove(repo storage.BlocklistRepository, id uint64) error {
+	if err := repo.Delete(id); err != nil {
+		return err
+	}
+	log.Info("blocklist.Remove", log.Int64("id", int64(id)))
+	return nil
+}
+
+// Clear deletes the entries that match the filter and returns how many
+// were deleted.
+func Clear(repo storage.BlocklistRepository, filter Filter) (int, error) {
+	list, err := List(repo, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range list {
+		if err := repo.Delete(entry.Id); err != nil {
+			log.Error("blocklist.Clear: unable to delete entry", log.Int64("id", int64(entry.Id)), log.Err(err))
+			return 0, err
+		}
+	}
+	log.Info("blocklist.Clear", log.String("mediaId", filter.MediaId), log.Int64("count", int64(len(list))))
+	return len(list), nil
+}
+
+// Blocked returns the entry that blocks a release, or nil.
+func Blocked(entries []models.BlocklistEntry, r *models.Release) *models.BlocklistEntry {
+	for i := range entries {
+		e := &entries[i]
+		if len(e.InfoHash) > 0 && len(r.InfoHash) > 0 {
+			if strings.EqualFold(e.InfoHash, r.InfoHash) {
+				return e
+			}
+			continue
+		}
+
+		// Without hashes, the same name from the same indexer is the same
+		// release. Entries for releases added by hand have no indexer.
+		if strings.EqualFold(e.Release, r.Title) && (len(e.Indexer) == 0 || strings.EqualFold(e.Indexer, r.Indexer)) {
+			return e
+		}
+	}
+	return nil
+}
+
+// Reject rejects the blocklisted releases among decisions sorted by
+// quality.Decide. Accepted releases stay first, in the same order.
+func Reject(repo storage.BlocklistRepository, decisions []models.Decision) ([]models.Decision, error) {
+	entries, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return decisions, nil
+	}
+
+	accepted := make([]models.Decision, 0, len(decisions))
+	rejected := make([]models.Decision, 0)
+	for _, d := range decisions {
+		if e := Blocked(entries, &d.Release); e != nil {
+			d.Rejections = append(d.Rejections, fmt.Sprintf("Is blocklisted: %s", e.Reason))
+			d.Accepted = false
+		}
+		if d.Accepted {
+			accepted = append(accepted, d)
+		} else {
+			rejected = append(rejected, d)
+		}
+	}
+	return append(accepted, rejected...), nil
+}
@@ -0,0 +1,169 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package download defines the interface MEX uses to talk to download
+// clients such as Transmission, along with a registry of the clients that
+// have been configured. Each client reports its transfers using the same
+// normalized Item so the rest of MEX doesn't care which client is in use.
+package download
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Protocol is the kind of release a client downloads.
+type Protocol string
+
+// Defines the supported protocols.
+const (
+	Torrent Protocol = "torrent"
+	Usenet  Protocol = "usenet"
+)
+
+// Status is the normalized state of a transfer.
+type Status string
+
+// Defines the states a transfer can be in.
+const (
+	Queued      Status = "queued"       // Waiting to start.
+	Checking    Status = "checking"     // Verifying data already on disk.
+	Downloading Status = "downloading"  // Transferring data.
+	Paused      Status = "paused"       // Stopped by a user.
+	Seeding     Status = "seeding"      // Complete and uploading to other peers.
+	Completed   Status = "completed"    // Complete and no longer transferring.
+	Failed      Status = "failed"       // Stopped because of an error.
+)
+
+var (
+	// ErrNotFound is returned when a client doesn't have the requested transfer.
+	ErrNotFound = errors.New("download: not found")
+
+	// ErrNotSupported is returned when a client can't perform an operation.
+	ErrNotSupported = errors.New("download: operation not supported by this client")
+)
+
+// AddRequest describes a release to send to a download client. Exactly one
+// of Url and File must be set.
+type AddRequest struct {
+	Url         string      // Magnet link, or URL of a .torrent or .nzb file the client downloads itself.
+	File        []byte      // Contents of a .torrent or .nzb file.
+	FileName    string      // Name of File, which some clients require.
+	Path        string      // Directory to download into, or empty for the client's default.
+	Labels      []string    // Labels or category to apply. Clients that support one category use the first.
+	Paused      bool        // Add without starting.
+}
+
+// Item is a transfer reported by a download client.
+type Item struct {
+	Id              string      `json:"id"`             // ID assigned by the client, e.g. the torrent info hash.
+	Name            string      `json:"name"`           // Name of the release.
+	Status          Status      `json:"status"`         // Normalized state.
+	Progress        float64     `json:"progress"`       // Fraction complete, from 0 to 1.
+	Size            int64       `json:"size"`           // Total size in bytes.
+	Downloaded      int64       `json:"downloaded"`     // Bytes downloaded so far.
+	DownloadSpeed   int64       `json:"downloadSpeed"`  // Bytes per second.
+	UploadSpeed     int64       `json:"uploadSpeed"`    // Bytes per second.
+	Eta             int64       `json:"eta"`            // Seconds until complete, or -1 if unknown.
+	Path            string      `json:"path"`           // Directory the release is downloaded into.
+	Labels          []string    `json:"labels"`         // Labels or category.
+	Error           string      `json:"error"`          // Why the transfer failed, if it did.
+	Added           time.Time   `json:"added"`          // When the transfer was added to the client.
+}
+
+// DownloadClient is implemented by each supported download client.
+type DownloadClient interface {
+	// Name identifies the client in the configuration and in download IDs.
+	Name() string
+
+	// Protocol returns the kind of release the client downloads.
+	Protocol() Protocol
+
+	// Add sends a release to the client and returns the ID of the transfer.
+	Add(request AddRequest) (string, error)
+
+	// List returns every transfer the client knows about.
+	List() ([]Item, error)
+
+	// Pause stops a transfer.
+	Pause(id string) error
+
+	// Resume restarts a paused transfer.
+	Resume(id string) error
+
+	// Remove deletes a transfer, and its downloaded data if deleteData is true.
+	Remove(id string, deleteData bool) error
+
+	// SetLabels replaces the labels or category of a transfer.
+	SetLabels(id string, labels []string) error
+
+	// SetPath moves a transfer's data to another directory.
+	SetPath(id string, path string) error
+}
+
+// ShareLimiter is implemented by torrent clients that can stop seeding a
+// transfer once it reaches a share ratio or has seeded for long enough.
+type ShareLimiter interface {
+	// SetShareLimits sets the limits for one transfer. A negative ratio or
+	// seed time removes that limit.
+	SetShareLimits(id string, ratio float64, seedTime time.Duration) error
+}
+
+var (
+	mutex   sync.RWMutex
+	clients = make(map[string]DownloadClient)
+)
+
+// Register adds a configured client to the registry, replacing any client with the same name.
+func Register(c DownloadClient) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	clients[c.Name()] = c
+}
+
+// Get returns the client with the name, or nil.
+func Get(name string) DownloadClient {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return clients[name]
+}
+
+// Clients returns every registered client, sorted by name.
+func Clients() []DownloadClient {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	list := make([]DownloadClient, 0, len(clients))
+	for _, c := range clients {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	return list
+}
+
+// ForProtocol returns the first registered client, by name, that downloads the protocol, or nil.
+func ForProtocol(p Protocol) DownloadClient {
+	for _, c := range Clients() {
+		if c.Protocol() == p {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package download
+
+import (
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Deepest nesting of lists and dictionaries in a torrent file. Real ones
+// nest a few levels; the limit keeps malformed files from exhausting the
+// stack.
+const maxDepth = 32
+
+var (
+	// ErrInvalidTorrent is returned when a torrent file or magnet link can't be parsed.
+	ErrInvalidTorrent = errors.New("download: invalid torrent")
+)
+
+// InfoHash returns the lowercase hex SHA-1 info hash of a .torrent file,
+// which torrent clients use to identify the transfer.
+func InfoHash(torrent []byte) (string, error) {
+	if len(torrent) == 0 || torrent[0] != 'd' {
+		return "", ErrInvalidTorrent
+	}
+
+	// Walk the top-level dictionary looking for the "info" key, then hash
+	// the raw bytes of its value.
+	pos := 1
+	for pos < len(torrent) && torrent[pos] != 'e' {
+		key, next, err := bstring(torrent, pos)
+		if err != nil {
+			return "", err
+		}
+
+		end, err := skip(torrent, next, 1)
+		if err != nil {
+			return "", err
+		}
+
+		if key == "info" {
+			sum := sha1.Sum(torrent[next:end])
+			return hex.EncodeToString(sum[:]), nil
+		}
+		pos = end
+	}
+
+	return "", ErrInvalidTorrent
+}
+
+// MagnetHash returns the lowercase hex info hash from a magnet link.
+func MagnetHash(magnet string) (string, error) {
+	u, err := url.Parse(magnet)
+	if err != nil || u.Scheme != "magnet" {
+		return "", ErrInvalidTorrent
+	}
+
+	for _, xt := range u.Query()["xt"] {
+		if !strings.HasPrefix(xt, "urn:btih:") {
+			continue
+		}
+
+		h := strings.TrimPrefix(xt, "urn:btih:")
+		switch len(h) {
+		case 40:
+			if _, err := hex.DecodeString(h); err == nil {
+				return strings.ToLower(h), nil
+			}
+		case 32:
+			// Older links use base32.
+			if b, err := base32.StdEncoding.DecodeString(strings.ToUpper(h)); err == nil {
+				return hex.EncodeToString(b), nil
+			}
+		}
+	}
+
+	return "", ErrInvalidTorrent
+}
+
+// skip returns the position after the bencoded value starting at pos,
+// which is nested depth lists and dictionaries deep.
+func skip(b []byte, pos int, depth int) (int, error) {
+	if pos >= len(b) || depth > maxDepth {
+		return 0, ErrInvalidTorrent
+	}
+
+	switch c := b[pos]; {
+	case c == 'i':
+		end := indexFrom(b, pos, 'e')
+		if end < 0 {
+			return 0, ErrInvalidTorrent
+		}
+		return end + 1, nil
+	case c == 'l' || c == 'd':
+		pos++
+		for pos < len(b) && b[pos] != 'e' {
+			next, err := skip(b, pos, depth + 1)
+			if err != nil {
+				return 0, err
+			}
+			pos = next
+		}
+		if pos >= len(b) {
+			return 0, ErrInvalidTorrent
+		}
+		return pos + 1, nil
+	case c >= '0' && c <= '9':
+		_, next, err := bstring(b, pos)
+		return next, err
+	}
+
+	return 0, ErrInvalidTorrent
+}
+
+// bstring decodes the bencoded string at pos and returns it along with the
+// position that follows it.
+func bstring(b []byte, pos int) (string, int, error) {
+	colon := indexFrom(b, pos, ':')
+	if colon < 0 {
+		return "", 0, ErrInvalidTorrent
+	}
+
+	length := 0
+	for _, c := range b[pos:colon] {
+		if c < '0' || c > '9' {
+			return "", 0, ErrInvalidTorrent
+		}
+		length = length * 10 + int(c - '0')
+		if length > len(b) {
+			return "", 0, ErrInvalidTorrent
+		}
+	}
+
+	end := colon + 1 + length
+	if colon == pos || end > len(b) {
+		return "", 0, ErrInvalidTorrent
+	}
+	return string(b[colon + 1:end]), end, nil
+}
+
+// indexFrom returns the index of the first c at or after pos, or -1.
+func indexFrom(b []byte, pos int, c byte) int {
+	for i := pos; i < len(b); i++ {
+		if b[i] == c {
+			return i
+		}
+	}
+	return -1
+}
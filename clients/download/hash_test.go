@@ -0,0 +1,83 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package download
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInfoHash(t *testing.T) {
+	tests := []struct {
+		name    string
+		torrent string
+		want    string
+		err     error
+	}{
+		{"info only", "d4:infod4:name3:abc6:lengthi5eee", "0cf21cee53c2578e754981fda0190d16ffacd8f6", nil},
+		{"info after other keys", "d8:announce3:foo13:announce-listll3:fooel3:baree4:infod4:name3:abc6:lengthi5eee", "0cf21cee53c2578e754981fda0190d16ffacd8f6", nil},
+		{"keys after info", "d4:infod4:name3:abc6:lengthi5ee8:url-listl3:abcee", "0cf21cee53c2578e754981fda0190d16ffacd8f6", nil},
+		{"nested dicts and lists", "d4:infod5:filesld6:lengthi1e4:pathl1:a1:beed6:lengthi2e4:pathl1:ceee4:name1:xee", "853c24fce880858333b1228e2854cc155a2d7e47", nil},
+		{"nesting at the cap", "d4:info" + strings.Repeat("l", 32) + strings.Repeat("e", 32) + "e", "441f67c5d1c13a0099f01520679b0a8c0e43ed12", nil},
+		{"nesting over the cap", "d4:info" + strings.Repeat("l", 33) + strings.Repeat("e", 33) + "e", "", ErrInvalidTorrent},
+		{"deeply nested before info", "d1:a" + strings.Repeat("l", 10000) + strings.Repeat("e", 10000) + "4:infodee", "", ErrInvalidTorrent},
+		{"empty", "", "", ErrInvalidTorrent},
+		{"not a dictionary", "l4:infoe", "", ErrInvalidTorrent},
+		{"no info", "d8:announce3:fooe", "", ErrInvalidTorrent},
+		{"truncated info", "d4:infod4:name3:abc6:lengthi5e", "", ErrInvalidTorrent},
+		{"truncated string", "d4:infod4:name3:a", "", ErrInvalidTorrent},
+		{"truncated integer", "d4:infod6:lengthi5", "", ErrInvalidTorrent},
+		{"truncated key", "d4:in", "", ErrInvalidTorrent},
+		{"oversized string length", "d4:info99999999999999999999999:abce", "", ErrInvalidTorrent},
+		{"oversized key length", "d9999:infodee", "", ErrInvalidTorrent},
+		{"non-numeric length", "d4:infod4x:namei1eee", "", ErrInvalidTorrent},
+		{"missing length", "d:infodee", "", ErrInvalidTorrent},
+		{"unknown type", "d4:infoxe", "", ErrInvalidTorrent},
+	}
+
+	for _, test := range tests {
+		got, err := InfoHash([]byte(test.torrent))
+		if got != test.want || err != test.err {
+			t.Errorf("%s: InfoHash() = %q, %v, want %q, %v", test.name, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestMagnetHash(t *testing.T) {
+	tests := []struct {
+		name   string
+		magnet string
+		want   string
+		err    error
+	}{
+		{"hex", "magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a&dn=name", "c12fe1c06bba254a9dc9f519b335aa7c1367a88a", nil},
+		{"uppercase hex", "magnet:?xt=urn:btih:C12FE1C06BBA254A9DC9F519B335AA7C1367A88A", "c12fe1c06bba254a9dc9f519b335aa7c1367a88a", nil},
+		{"base32", "magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK", "c12fe1c06bba254a9dc9f519b335aa7c1367a88a", nil},
+		{"lowercase base32", "magnet:?xt=urn:btih:yex6dqdlxisuvhoj6um3gnnkpqjwpkek", "c12fe1c06bba254a9dc9f519b335aa7c1367a88a", nil},
+		{"btih after other topics", "magnet:?xt=urn:btmh:1220abcd&xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a", "c12fe1c06bba254a9dc9f519b335aa7c1367a88a", nil},
+		{"not a magnet link", "http://example.com/?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a", "", ErrInvalidTorrent},
+		{"no btih", "magnet:?dn=name", "", ErrInvalidTorrent},
+		{"short hash", "magnet:?xt=urn:btih:c12fe1c06bba", "", ErrInvalidTorrent},
+		{"invalid hex", "magnet:?xt=urn:btih:z12fe1c06bba254a9dc9f519b335aa7c1367a88a", "", ErrInvalidTorrent},
+	}
+
+	for _, test := range tests {
+		got, err := MagnetHash(test.magnet)
+		if got != test.want || err != test.err {
+			t.Errorf("%s: MagnetHash() = %q, %v, want %q, %v", test.name, got, err, test.want, test.err)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package nzbget is a download client for NZBGet's JSON-RPC API.
+// https://nzbget.com/documentation/api/
+package nzbget
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/clients/download"
+	"github.com/MediaExchange/mex/clients/rest"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	bytesPerMB = 1024 * 1024
+)
+
+// Client talks to a single NZBGet instance.
+type Client struct {
+	name     string
+	url      string
+	username string
+	password string
+}
+
+// rpcRequest is the body of every RPC call.
+type rpcRequest struct {
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+// rpcReply is the body of every RPC response. The result is decoded into
+// the value supplied by the caller.
+type rpcReply struct {
+	Result  interface{}   `json:"result"`
+	Error   *struct {
+		Message string    `json:"message"`
+	}                     `json:"error"`
+}
+
+// group is a job in the download queue, from listgroups.
+type group struct {
+	NZBID               int64   `json:"NZBID"`
+	NZBName             string  `json:"NZBName"`
+	Status              string  `json:"Status"`
+	FileSizeMB          int64   `json:"FileSizeMB"`
+	RemainingSizeMB     int64   `json:"RemainingSizeMB"`
+	DownloadedSizeMB    int64   `json:"DownloadedSizeMB"`
+	Category            string  `json:"Category"`
+	DestDir             string  `json:"DestDir"`
+	ActiveDownloads     int     `json:"ActiveDownloads"`
+}
+
+// history is a finished job, from history.
+type history struct {
+	NZBID               int64   `json:"NZBID"`
+	Name                string  `json:"Name"`
+	Status              string  `json:"Status"`
+	FileSizeMB          int64   `json:"FileSizeMB"`
+	DestDir             string  `json:"DestDir"`
+	FinalDir            string  `json:"FinalDir"`
+	Category            string  `json:"Category"`
+	HistoryTime         int64   `json:"HistoryTime"`
+}
+
+// New returns a client for the NZBGet instance at url, e.g.
+// http://localhost:6789. The username and password are NZBGet's
+// ControlUsername and ControlPassword.
+func New(name string, url string, username string, password string) *Client {
+	return &Client {
+		name:     name,
+		url:      strings.TrimSuffix(url, "/") + "/jsonrpc",
+		username: username,
+		password: password,
+	}
+}
+
+// Name returns the configured name of the client.
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Protocol returns download.Usenet.
+func (c *Client) Protocol() download.Protocol {
+	return download.Usenet
+}
+
+// Add sends an NZB by URL or file contents and returns the job's NZBID.
+func (c *Client) Add(request download.AddRequest) (string, error) {
+	var content string
+	switch {
+	case len(request.File) > 0:
+		content = base64.StdEncoding.EncodeToString(request.File)
+	case len(request.Url) > 0:
+		content = request.Url
+	default:
+		return "", errors.New("nzbget.Add: a URL or file must be provided")
+	}
+
+	category := ""
+	if len(request.Labels) > 0 {
+		category = request.Labels[0]
+	}
+
+	// NZBGet names URL downloads itself when the file name is empty.
+	fileName := request.FileName
+	if len(fileName) == 0 && len(request.File) > 0 {
+		fileName = "mex.nzb"
+	}
+
+	// append(NZBFilename, Content, Category, Priority, AddToTop, AddPaused,
+	//        DupeKey, DupeScore, DupeMode, PPParameters)
+	var id int64
+	err := c.call("append", &id, fileName, content, category, 0, false, request.Paused, "", 0, "SCORE", []interface{}{})
+	if err != nil {
+		return "", err
+	}
+	if id <= 0 {
+		return "", errors.New("nzbget.Add: job was not added")
+	}
+
+	log.Info("nzbget.Add", log.String("client", c.name), log.Int64("id", id))
+	return strconv.FormatInt(id, 10), nil
+}
+
+// List returns the jobs in the queue followed by those in the history.
+func (c *Client) List() ([]download.Item, error) {
+	status := struct {
+		DownloadRate int64 `json:"DownloadRate"`
+	}{}
+	if err := c.call("status", &status); err != nil {
+		return nil, err
+	}
+
+	groups := make([]group, 0)
+	if err := c.call("listgroups", &groups, 0); err != nil {
+		return nil, err
+	}
+
+	finished := make([]history, 0)
+	if err := c.call("history", &finished, false); err != nil {
+		return nil, err
+	}
+
+	items := make([]download.Item, 0, len(groups) + len(finished))
+	for _, g := range groups {
+		item := g.item()
+
+		// The rate is for the whole server; attribute it to the active job.
+		if g.ActiveDownloads > 0 {
+			item.DownloadSpeed = status.DownloadRate
+			if status.DownloadRate > 0 {
+				item.Eta = g.RemainingSizeMB * bytesPerMB / status.DownloadRate
+			}
+		}
+		items = append(items, item)
+	}
+	for _, h := range finished {
+		// Jobs deleted on purpose are left out, as if they were removed.
+		if !h.removed() {
+			items = append(items, h.item())
+		}
+	}
+	return items, nil
+}
+
+// Pause pauses a queued job.
+func (c *Client) Pause(id string) error {
+	return c.edit("GroupPause", "", id)
+}
+
+// Resume resumes a paused job.
+func (c *Client) Resume(id string) error {
+	return c.edit("GroupResume", "", id)
+}
+
+// Remove deletes a job from the queue, or from the history if it has
+// finished. NZBGet deletes the partial files of queued jobs; it never
+// deletes the files of finished jobs, so deleteData only affects the queue.
+func (c *Client) Remove(id string, deleteData bool) error {
+	items, err := c.List()
+	if err != nil {
+		return err
+	}
+
+	for _, i := range items {
+		if i.Id != id {
+			continue
+		}
+
+		switch {
+		case i.Status == download.Completed || i.Status == download.Failed:
+			return c.edit("HistoryFinalDelete", "", id)
+		case deleteData:
+			return c.edit("GroupFinalDelete", "", id)
+		default:
+			return c.edit("GroupDelete", "", id)
+		}
+	}
+	return download.ErrNotFound
+}
+
+// SetLabels changes a queued job's category to the first label.
+func (c *Client) SetLabels(id string, labels []string) error {
+	category := ""
+	if len(labels) > 0 {
+		category = labels[0]
+	}
+	return c.edit("GroupApplyCategory", category, id)
+}
+
+// SetPath is not supported; NZBGet places jobs by category.
+func (c *Client) SetPath(id string, path string) error {
+	return download.ErrNotSupported
+}
+
+// edit runs an editqueue command on one job. This is the form of editqueue
+// used by NZBGet 16 and later.
+func (c *Client) edit(command string, param string, id string) error {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return download.ErrNotFound
+	}
+
+	var ok bool
+	err = c.call("editqueue", &ok, command, param, []int64{n})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("nzbget: %s failed", command)
+	}
+	return nil
+}
+
+// call invokes an RPC method and decodes the result into result.
+func (c *Client) call(method string, result interface{}, params ...interface{}) error {
+	if params == nil {
+		params = make([]interface{}, 0)
+	}
+
+	reply := rpcReply{Result: result}
+	res, err := rest.NewRequest().
+		SetBasicAuth(c.username, c.password).
+		SetBody(rpcRequest{Method: method, Params: params}).
+		SetReplyBody(&reply).
+		Post(c.url)
+	if res != nil {
+		_ = res.Body.Close()
+	}
+	if err != nil {
+		log.Error("nzbget.call: unexpected error", log.String("client", c.name), log.String("method", method), log.Err(err))
+		return err
+	}
+
+	if reply.Error != nil {
+		err = fmt.Errorf("nzbget: %s: %s", method, reply.Error.Message)
+		log.Error("nzbget.call: request failed", log.String("client", c.name), log.Err(err))
+		return err
+	}
+	return nil
+}
+
+// item converts a queued job to a normalized download item.
+func (g group) item() download.Item {
+	i := download.Item {
+		Id:         strconv.FormatInt(g.NZBID, 10),
+		Name:       g.NZBName,
+		Size:       g.FileSizeMB * bytesPerMB,
+		Downloaded: g.DownloadedSizeMB * bytesPerMB,
+		Path:       g.DestDir,
+		Labels:     labels(g.Category),
+		Eta:        -1,
+	}
+
+	if g.FileSizeMB > 0 {
+		i.Progress = float64(g.FileSizeMB - g.RemainingSizeMB) / float64(g.FileSizeMB)
+	}
+
+	switch g.Status {
+	case "DOWNLOADING", "FETCHING":
+		i.Status = download.Downloading
+	case "PAUSED":
+		i.Status = download.Paused
+	case "QUEUED":
+		i.Status = download.Queued
+	default:
+		// Post-processing: PP_QUEUED, LOADING_PARS, VERIFYING_SOURCES,
+		// REPAIRING, VERIFYING_REPAIRED, RENAMING, UNPACKING, MOVING,
+		// EXECUTING_SCRIPT and PP_FINISHED.
+		i.Status = download.Checking
+	}
+	return i
+}
+
+// item converts a finished job to a normalized download item. History
+// statuses have the form KIND/DETAIL, e.g. SUCCESS/UNPACK or FAILURE/PAR.
+func (h history) item() download.Item {
+	i := download.Item {
+		Id:         strconv.FormatInt(h.NZBID, 10),
+		Name:       h.Name,
+		Size:       h.FileSizeMB * bytesPerMB,
+		Path:       h.FinalDir,
+		Labels:     labels(h.Category),
+		Eta:        -1,
+		Added:      time.Unix(h.HistoryTime, 0),
+	}
+
+	if len(i.Path) == 0 {
+		i.Path = h.DestDir
+	}
+
+	kind, _ := split(h.Status)
+	switch {
+	case h.Status == "WARNING/DAMAGED" || h.Status == "WARNING/PASSWORD":
+		// The download finished but couldn't be repaired or unpacked.
+		i.Status = download.Failed
+		i.Error = h.Status
+	case kind == "SUCCESS" || kind == "WARNING":
+		i.Status = download.Completed
+		i.Progress = 1
+		i.Downloaded = i.Size
+	default:
+		// FAILURE, and DELETED/HEALTH and DELETED/SCAN when nzbget gave up.
+		i.Status = download.Failed
+		i.Error = h.Status
+	}
+	return i
+}
+
+// removed returns true if a job was deleted by a user, or by nzbget as a
+// duplicate, rather than because it failed.
+func (h history) removed() bool {
+	kind, detail := split(h.Status)
+	return kind == "DELETED" && (detail == "MANUAL" || detail == "DUPE" || detail == "GOOD" || detail == "COPY")
+}
+
+// split separates a history status into its kind and detail.
+func split(status string) (string, string) {
+	parts := strings.SplitN(status, "/", 2)
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// labels returns the category as a label list.
+func labels(category string) []string {
+	if len(category) == 0 {
+		return make([]string, 0)
+	}
+	return []string{category}
+}
@@ -0,0 +1,172 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package plextv talks to the plex.tv account service, which Plex apps use
+// to sign users in with a PIN and to find the servers a user can access.
+package plextv
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/clients/rest"
+	"net/url"
+)
+
+const (
+	// Product name shown to users on the Plex sign in page and device list.
+	Product = "MEX"
+)
+
+var (
+	// BaseUri of the plex.tv API. It can be changed to test against a local stand-in.
+	BaseUri = "https://plex.tv"
+
+	// AppUri of the Plex web app where users enter their credentials.
+	AppUri = "https://app.plex.tv"
+
+	// ClientId identifies this MEX installation to Plex. It must not change
+	// between restarts.
+	ClientId string
+)
+
+// Pin is a sign in attempt. The user authorizes it on the Plex web app, after
+// which AuthToken is filled in.
+type Pin struct {
+	Id          int     `json:"id"`
+	Code        string  `json:"code"`
+	AuthToken   string  `json:"authToken"`
+	ExpiresIn   int     `json:"expiresIn"`
+}
+
+// Account is the Plex user who signed in.
+type Account struct {
+	Id          int64   `json:"id"`
+	Uuid        string  `json:"uuid"`
+	Username    string  `json:"username"`
+	Title       string  `json:"title"`
+	Email       string  `json:"email"`
+}
+
+// Resource is a device the user can access, such as a Plex Media Server.
+type Resource struct {
+	Name                string  `json:"name"`
+	Provides            string  `json:"provides"`
+	ClientIdentifier    string  `json:"clientIdentifier"`
+	Owned               bool    `json:"owned"`
+}
+
+// CreatePin starts a sign in attempt.
+func CreatePin() (*Pin, error) {
+	if len(ClientId) == 0 {
+		s := "plextv.CreatePin: ClientId must be set"
+		log.Error(s)
+		return nil, errors.New(s)
+	}
+
+	reply := new(Pin)
+	_, err := newRequest().
+		AddQuery("strong", "true").
+		SetReplyBody(reply).
+		Post(BaseUri + "/api/v2/pins")
+	if err != nil {
+		log.Error("plextv.CreatePin: unexpected error", log.Err(err))
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+// CheckPin returns the current state of a sign in attempt. AuthToken is
+// empty until the user has signed in.
+func CheckPin(id int) (*Pin, error) {
+	reply := new(Pin)
+	_, err := newRequest().
+		SetReplyBody(reply).
+		Get(fmt.Sprintf("%s/api/v2/pins/%d", BaseUri, id))
+	if err != nil {
+		log.Error("plextv.CheckPin: unexpected error", log.Int64("id", int64(id)), log.Err(err))
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+// AuthUrl returns the Plex web app page where the user signs in to authorize the pin.
+func AuthUrl(pin *Pin, forwardUrl string) string {
+	params := url.Values{}
+	params.Set("clientID", ClientId)
+	params.Set("code", pin.Code)
+	params.Set("context[device][product]", Product)
+	if len(forwardUrl) > 0 {
+		params.Set("forwardUrl", forwardUrl)
+	}
+	return AppUri + "/auth#?" + params.Encode()
+}
+
+// GetAccount returns the user the token belongs to.
+func GetAccount(token string) (*Account, error) {
+	reply := new(Account)
+	_, err := newRequest().
+		SetHeader("X-Plex-Token", token).
+		SetReplyBody(reply).
+		Get(BaseUri + "/api/v2/user")
+	if err != nil {
+		log.Error("plextv.GetAccount: unexpected error", log.Err(err))
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+// GetResources returns the devices the user can access, including servers
+// shared with them.
+func GetResources(token string) ([]Resource, error) {
+	reply := make([]Resource, 0)
+	_, err := newRequest().
+		SetHeader("X-Plex-Token", token).
+		SetReplyBody(&reply).
+		Get(BaseUri + "/api/v2/resources")
+	if err != nil {
+		log.Error("plextv.GetResources: unexpected error", log.Err(err))
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+// ServerAccess reports whether the user can access the server with the
+// machine identifier serverId, and whether they own it.
+func ServerAccess(token string, serverId string) (bool, bool, error) {
+	resources, err := GetResources(token)
+	if err != nil {
+		return false, false, err
+	}
+
+	for _, r := range resources {
+		if r.ClientIdentifier == serverId {
+			return true, r.Owned, nil
+		}
+	}
+	return false, false, nil
+}
+
+// newRequest returns a new REST request with the headers plex.tv requires.
+func newRequest() *rest.RestRequest {
+	return rest.NewRequest().
+		SetHeader("X-Plex-Product", Product).
+		SetHeader("X-Plex-Client-Identifier", ClientId)
+}
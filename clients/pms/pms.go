@@ -0,0 +1,269 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package pms talks to a Plex Media Server: its libraries, the titles in
+// them and the scans that find new files. Requests are authenticated with
+// the server owner's X-Plex-Token.
+package pms
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/clients/plextv"
+	"github.com/MediaExchange/mex/clients/rest"
+	"strings"
+)
+
+// Library types.
+const (
+	MovieLibrary = "movie"
+	ShowLibrary  = "show"
+)
+
+var (
+	// ErrNotConfigured is returned when the server address or token isn't set.
+	ErrNotConfigured = errors.New("pms: server url and token must be set")
+
+	// ErrNotFound is returned when the server has no item with a rating key.
+	ErrNotFound = errors.New("pms: item not found")
+)
+
+var (
+	// BaseUri of the Plex Media Server, e.g. http://localhost:32400. Empty
+	// when MEX doesn't talk to a server.
+	BaseUri string
+
+	// Token of the server's owner.
+	Token string
+)
+
+// Providers in Plex GUIDs, for both the current Plex agents (`tmdb://603`)
+// and the legacy agents (`com.plexapp.agents.themoviedb://603?lang=en`),
+// mapped to the providers in MEX IDs.
+var agents = map[string]string {
+	"imdb":                          "imdb",
+	"tmdb":                          "tmdb",
+	"tvdb":                          "tvdb",
+	"com.plexapp.agents.imdb":       "imdb",
+	"com.plexapp.agents.themoviedb": "tmdb",
+	"com.plexapp.agents.thetvdb":    "tvdb",
+}
+
+// Library is a section of the server, such as Movies or TV Shows.
+type Library struct {
+	Key         string      `json:"key"`                    // ID of the library.
+	Type        string      `json:"type"`                   // MovieLibrary, ShowLibrary, or another type MEX doesn't use.
+	Title       string      `json:"title"`                  // Name shown in Plex.
+	Agent       string      `json:"agent"`                  // Agent that finds the titles' metadata.
+	Locations   []Location  `json:"Location"`               // Folders in the library.
+}
+
+// Location is a folder in a library.
+type Location struct {
+	Id          int         `json:"id"`
+	Path        string      `json:"path"`                   // Path as the server sees it.
+}
+
+// Item is a movie, show or episode in a library.
+type Item struct {
+	RatingKey       string  `json:"ratingKey"`              // ID of the item on the server.
+	Guid            string  `json:"guid"`                   // Plex GUID, or a legacy agent GUID.
+	Guids           []Guid  `json:"Guid"`                   // GUIDs of the providers, when the item uses a current agent.
+	Type            string  `json:"type"`                   // movie, show or episode.
+	Title           string  `json:"title"`
+	Year            int     `json:"year"`
+	ParentIndex     int     `json:"parentIndex"`            // Season number of an episode.
+	Index           int     `json:"index"`                  // Episode number of an episode.
+	LeafCount       int     `json:"leafCount"`              // Episodes of a show.
+	ViewedLeafCount int     `json:"viewedLeafCount"`        // Episodes of a show the owner has watched.
+	ViewCount       int     `json:"viewCount"`              // Times the owner has watched a movie or episode.
+	AddedAt         int64   `json:"addedAt"`                // Unix time the item was added.
+}
+
+// Guid is a provider's ID for an item, e.g. `tmdb://603`.
+type Guid struct {
+	Id          string      `json:"id"`
+}
+
+// mediaContainer is the envelope of every server response.
+type mediaContainer struct {
+	MediaContainer struct {
+		Directory   []Library   `json:"Directory"`
+		Metadata    []Item      `json:"Metadata"`
+	} `json:"MediaContainer"`
+}
+
+// Configured returns true if the server address and token are set.
+func Configured() bool {
+	return len(BaseUri) > 0 && len(Token) > 0
+}
+
+// Ping verifies that the server is reachable and accepts the token.
+func Ping() error {
+	if !Configured() {
+		return ErrNotConfigured
+	}
+
+	res, err := newRequest().Get(BaseUri + "/library/sections")
+	if res != nil {
+		_ = res.Body.Close()
+	}
+	if err != nil {
+		log.Error("pms.Ping: unexpected error", log.Err(err))
+		return err
+	}
+	return nil
+}
+
+// Libraries returns the server's libraries.
+func Libraries() ([]Library, error) {
+	if !Configured() {
+		return nil, ErrNotConfigured
+	}
+
+	reply := new(mediaContainer)
+	_, err := newRequest().
+		SetReplyBody(reply).
+		Get(BaseUri + "/library/sections")
+	if err != nil {
+		log.Error("pms.Libraries: unexpected error", log.Err(err))
+		return nil, err
+	}
+
+	libraries := reply.MediaContainer.Directory
+	if libraries == nil {
+		libraries = make([]Library, 0)
+	}
+	return libraries, nil
+}
+
+// Items returns the movies or shows in a library, with their GUIDs.
+func Items(key string) ([]Item, error) {
+	return items("pms.Items", fmt.Sprintf("%s/library/sections/%s/all", BaseUri, key))
+}
+
+// Episodes returns every episode of a show, by the show's rating key.
+func Episodes(ratingKey string) ([]Item, error) {
+	return items("pms.Episodes", fmt.Sprintf("%s/library/metadata/%s/allLeaves", BaseUri, ratingKey))
+}
+
+// Metadata returns a single movie, show, season or episode by its rating key.
+func Metadata(ratingKey string) (*Item, error) {
+	list, err := items("pms.Metadata", fmt.Sprintf("%s/library/metadata/%s", BaseUri, ratingKey))
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	return &list[0], nil
+}
+
+// Refresh asks the server to scan a library for new files. A path limits
+// the scan to that folder, which is much faster than scanning everything.
+func Refresh(key string, path string) error {
+	if !Configured() {
+		return ErrNotConfigured
+	}
+
+	req := newRequest()
+	if len(path) > 0 {
+		req.AddQuery("path", path)
+	}
+	res, err := req.Get(fmt.Sprintf("%s/library/sections/%s/refresh", BaseUri, key))
+	if res != nil {
+		_ = res.Body.Close()
+	}
+	if err != nil {
+		log.Error("pms.Refresh: unexpected error", log.String("key", key), log.String("path", path), log.Err(err))
+		return err
+	}
+
+	log.Info("pms.Refresh", log.String("key", key), log.String("path", path))
+	return nil
+}
+
+// Ids returns the item's IDs in the format `provider:id`, e.g. `tmdb:603`,
+// `tvdb:81189` or `imdb:tt0133093`.
+func (i *Item) Ids() []string {
+	ids := make([]string, 0, len(i.Guids) + 1)
+	for _, g := range i.Guids {
+		if id := parseGuid(g.Id); len(id) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	if id := parseGuid(i.Guid); len(id) > 0 {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// parseGuid converts a GUID to the format `provider:id`, or returns an
+// empty string for providers MEX doesn't know, such as Plex's own.
+func parseGuid(guid string) string {
+	n := strings.Index(guid, "://")
+	if n < 0 {
+		return ""
+	}
+
+	provider, ok := agents[guid[:n]]
+	if !ok {
+		return ""
+	}
+
+	// Legacy episode GUIDs continue with the season and episode, and every
+	// legacy GUID ends with the language.
+	id := guid[n + 3:]
+	if end := strings.IndexAny(id, "/?"); end >= 0 {
+		id = id[:end]
+	}
+	if len(id) == 0 {
+		return ""
+	}
+	return provider + ":" + id
+}
+
+// items returns the items at a URL.
+func items(caller string, url string) ([]Item, error) {
+	if !Configured() {
+		return nil, ErrNotConfigured
+	}
+
+	reply := new(mediaContainer)
+	_, err := newRequest().
+		AddQuery("includeGuids", "1").
+		SetReplyBody(reply).
+		Get(url)
+	if err != nil {
+		log.Error(caller + ": unexpected error", log.Err(err))
+		return nil, err
+	}
+
+	list := reply.MediaContainer.Metadata
+	if list == nil {
+		list = make([]Item, 0)
+	}
+	return list, nil
+}
+
+// newRequest returns a new REST request authenticated with the token.
+func newRequest() *rest.RestRequest {
+	return rest.NewRequest().
+		SetHeader("X-Plex-Token", Token).
+		SetHeader("X-Plex-Product", plextv.Product).
+		SetHeader("X-Plex-Client-Identifier", plextv.ClientId)
+}
@@ -0,0 +1,454 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package qbittorrent is a download client for the qBittorrent v2 Web API.
+// https://github.com/qbittorrent/qBittorrent/wiki/WebUI-API-(qBittorrent-4.1)
+package qbittorrent
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/clients/download"
+	"github.com/MediaExchange/mex/clients/rest"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// qBittorrent reports an unknown ETA as 100 days.
+	infiniteEta = 8640000
+
+	// Share limit value meaning "no limit".
+	noLimit = -1
+
+	// Largest .torrent file MEX fetches.
+	maxTorrentSize = 10 * 1024 * 1024
+
+	// How long fetching a .torrent file may take.
+	fetchTimeout = 30 * time.Second
+
+	// Redirects followed when fetching a .torrent file.
+	maxRedirects = 10
+)
+
+var (
+	// ErrLoginFailed is returned when qBittorrent rejects the username or password.
+	ErrLoginFailed = errors.New("qbittorrent: login failed")
+)
+
+// Client talks to a single qBittorrent instance.
+type Client struct {
+	name     string
+	url      string
+	username string
+	password string
+	jar      http.CookieJar
+	mutex    sync.Mutex
+	loggedIn bool
+}
+
+// torrent is a single entry from torrents/info.
+type torrent struct {
+	Hash        string  `json:"hash"`
+	Name        string  `json:"name"`
+	State       string  `json:"state"`
+	Progress    float64 `json:"progress"`
+	Size        int64   `json:"size"`
+	Downloaded  int64   `json:"downloaded"`
+	DlSpeed     int64   `json:"dlspeed"`
+	UpSpeed     int64   `json:"upspeed"`
+	Eta         int64   `json:"eta"`
+	SavePath    string  `json:"save_path"`
+	Category    string  `json:"category"`
+	AddedOn     int64   `json:"added_on"`
+}
+
+// New returns a client for the qBittorrent Web UI at url, e.g. http://localhost:8080.
+func New(name string, url string, username string, password string) *Client {
+	// cookiejar.New only fails when given options with a bad public suffix list.
+	jar, _ := cookiejar.New(nil)
+	return &Client {
+		name:     name,
+		url:      strings.TrimSuffix(url, "/"),
+		username: username,
+		password: password,
+		jar:      jar,
+	}
+}
+
+// Name returns the configured name of the client.
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Protocol returns download.Torrent.
+func (c *Client) Protocol() download.Protocol {
+	return download.Torrent
+}
+
+// Add adds a torrent by magnet link, URL or .torrent file contents.
+// qBittorrent doesn't return the info hash of a new torrent, so .torrent
+// files are fetched by MEX and hashed before they are sent.
+func (c *Client) Add(request download.AddRequest) (string, error) {
+	content := request.File
+	fileName := request.FileName
+	hash := ""
+
+	form := url.Values{}
+	if len(request.Path) > 0 {
+		form.Set("savepath", request.Path)
+	}
+	if len(request.Labels) > 0 {
+		form.Set("category", request.Labels[0])
+	}
+	if request.Paused {
+		// Renamed from paused to stopped in qBittorrent 5.
+		form.Set("paused", "true")
+		form.Set("stopped", "true")
+	}
+
+	var err error
+	switch {
+	case len(content) > 0:
+		hash, err = download.InfoHash(content)
+	case strings.HasPrefix(request.Url, "magnet:"):
+		hash, err = download.MagnetHash(request.Url)
+		form.Set("urls", request.Url)
+	case len(request.Url) > 0:
+		var magnet string
+		content, magnet, err = fetch(request.Url)
+		switch {
+		case err != nil:
+		case len(magnet) > 0:
+			hash, err = download.MagnetHash(magnet)
+			form.Set("urls", magnet)
+		default:
+			hash, err = download.InfoHash(content)
+		}
+	default:
+		err = errors.New("qbittorrent.Add: a URL or file must be provided")
+	}
+	if err != nil {
+		log.Error("qbittorrent.Add: unable to read torrent", log.String("client", c.name), log.Err(err))
+		return "", err
+	}
+
+	if len(content) > 0 && len(fileName) == 0 {
+		fileName = hash + ".torrent"
+	}
+
+	err = c.send("torrents/add", func(req *rest.RestRequest) *rest.RestRequest {
+		if len(content) > 0 {
+			return req.SetMultipartBody(form, "torrents", fileName, content)
+		}
+		return req.SetMultipartBody(form, "", "", nil)
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+
+	log.Info("qbittorrent.Add", log.String("client", c.name), log.String("hash", hash))
+	return hash, nil
+}
+
+// List returns every torrent.
+func (c *Client) List() ([]download.Item, error) {
+	torrents := make([]torrent, 0)
+	err := c.send("torrents/info", func(req *rest.RestRequest) *rest.RestRequest {
+		return req.SetFormBody(url.Values{})
+	}, &torrents)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]download.Item, 0, len(torrents))
+	for _, t := range torrents {
+		items = append(items, t.item())
+	}
+	return items, nil
+}
+
+// Pause stops a torrent.
+func (c *Client) Pause(id string) error {
+	// qBittorrent 5 replaced pause with stop.
+	err := c.post("torrents/pause", hashes(id))
+	if isNotFound(err) {
+		err = c.post("torrents/stop", hashes(id))
+	}
+	return err
+}
+
+// Resume starts a stopped torrent.
+func (c *Client) Resume(id string) error {
+	// qBittorrent 5 replaced resume with start.
+	err := c.post("torrents/resume", hashes(id))
+	if isNotFound(err) {
+		err = c.post("torrents/start", hashes(id))
+	}
+	return err
+}
+
+// Remove deletes a torrent and optionally its data.
+func (c *Client) Remove(id string, deleteData bool) error {
+	form := hashes(id)
+	form.Set("deleteFiles", strconv.FormatBool(deleteData))
+	return c.post("torrents/delete", form)
+}
+
+// SetLabels sets a torrent's category to the first label, creating the
+// category if needed. An empty list clears the category.
+func (c *Client) SetLabels(id string, labels []string) error {
+	category := ""
+	if len(labels) > 0 {
+		category = labels[0]
+
+		// Creating a category that already exists fails with 409 Conflict.
+		err := c.post("torrents/createCategory", url.Values{"category": {category}})
+		if err != nil && !strings.HasPrefix(err.Error(), strconv.Itoa(http.StatusConflict)) {
+			return err
+		}
+	}
+
+	form := hashes(id)
+	form.Set("category", category)
+	return c.post("torrents/setCategory", form)
+}
+
+// SetPath moves a torrent's data to another directory.
+func (c *Client) SetPath(id string, path string) error {
+	form := hashes(id)
+	form.Set("location", path)
+	return c.post("torrents/setLocation", form)
+}
+
+// SetShareLimits stops seeding a torrent after it reaches the ratio or has
+// seeded for seedTime.
+func (c *Client) SetShareLimits(id string, ratio float64, seedTime time.Duration) error {
+	form := hashes(id)
+
+	if ratio < 0 {
+		form.Set("ratioLimit", strconv.Itoa(noLimit))
+	} else {
+		form.Set("ratioLimit", strconv.FormatFloat(ratio, 'f', 2, 64))
+	}
+
+	if seedTime < 0 {
+		form.Set("seedingTimeLimit", strconv.Itoa(noLimit))
+	} else {
+		form.Set("seedingTimeLimit", strconv.FormatInt(int64(seedTime / time.Minute), 10))
+	}
+
+	// Required since qBittorrent 4.6; older versions ignore it.
+	form.Set("inactiveSeedingTimeLimit", strconv.Itoa(noLimit))
+	return c.post("torrents/setShareLimits", form)
+}
+
+// login signs in and stores the SID cookie in the client's jar. qBittorrent
+// answers 200 with the text "Fails." when the credentials are wrong.
+func (c *Client) login() error {
+	form := url.Values{}
+	form.Set("username", c.username)
+	form.Set("password", c.password)
+
+	res, err := rest.NewRequest().
+		SetCookieJar(c.jar).
+		SetHeader("Referer", c.url).
+		SetFormBody(form).
+		Post(c.url + "/api/v2/auth/login")
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		log.Error("qbittorrent.login: unexpected error", log.String("client", c.name), log.Err(err))
+		return err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(body)) != "Ok." {
+		log.Error("qbittorrent.login: login failed", log.String("client", c.name))
+		return ErrLoginFailed
+	}
+
+	c.loggedIn = true
+	return nil
+}
+
+// post sends form values to an API method that doesn't return anything.
+func (c *Client) post(method string, form url.Values) error {
+	return c.send(method, func(req *rest.RestRequest) *rest.RestRequest {
+		return req.SetFormBody(form)
+	}, nil)
+}
+
+// send calls an API method, logging in first if needed. A 403 Forbidden
+// means the session expired, so the client logs in again and retries once.
+// The build function adds the body, since a body can only be read once.
+func (c *Client) send(method string, build func(*rest.RestRequest) *rest.RestRequest, reply interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if !c.loggedIn {
+			if err := c.login(); err != nil {
+				return err
+			}
+		}
+
+		req := build(rest.NewRequest().SetCookieJar(c.jar).SetHeader("Referer", c.url))
+		if reply != nil {
+			req = req.SetReplyBody(reply)
+		}
+		res, err := req.Post(c.url + "/api/v2/" + method)
+
+		if res != nil {
+			body, _ := ioutil.ReadAll(res.Body)
+			_ = res.Body.Close()
+
+			if res.StatusCode == http.StatusForbidden {
+				c.loggedIn = false
+				continue
+			}
+
+			// torrents/add answers 200 with "Fails." when the torrent is rejected.
+			if err == nil && strings.TrimSpace(string(body)) == "Fails." {
+				err = fmt.Errorf("qbittorrent: %s failed", method)
+			}
+		}
+
+		if err != nil {
+			log.Error("qbittorrent.send: request failed", log.String("client", c.name), log.String("method", method), log.Err(err))
+			return err
+		}
+		return nil
+	}
+
+	return ErrLoginFailed
+}
+
+// fetch downloads a .torrent file. Indexers often redirect to a magnet link
+// instead, which is returned in place of the file.
+func fetch(u string) ([]byte, string, error) {
+	magnet := ""
+	client := &http.Client {
+		Timeout: fetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme == "magnet" {
+				magnet = req.URL.String()
+				return http.ErrUseLastResponse
+			}
+			if len(via) >= maxRedirects {
+				return errors.New("qbittorrent: too many redirects")
+			}
+			return nil
+		},
+	}
+
+	res, err := client.Get(u)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	if len(magnet) > 0 {
+		return nil, magnet, nil
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, "", errors.New(res.Status)
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(res.Body, maxTorrentSize + 1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(content) > maxTorrentSize {
+		return nil, "", download.ErrInvalidTorrent
+	}
+	return content, "", nil
+}
+
+// hashes returns form values selecting a single torrent.
+func hashes(id string) url.Values {
+	return url.Values{"hashes": {id}}
+}
+
+// isNotFound returns true for errors caused by a 404 response, which
+// qBittorrent returns for API methods it doesn't have.
+func isNotFound(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), strconv.Itoa(http.StatusNotFound))
+}
+
+// item converts a torrent to a normalized download item.
+func (t torrent) item() download.Item {
+	i := download.Item {
+		Id:            t.Hash,
+		Name:          t.Name,
+		Progress:      t.Progress,
+		Size:          t.Size,
+		Downloaded:    t.Downloaded,
+		DownloadSpeed: t.DlSpeed,
+		UploadSpeed:   t.UpSpeed,
+		Eta:           t.Eta,
+		Path:          t.SavePath,
+		Labels:        make([]string, 0),
+		Added:         time.Unix(t.AddedOn, 0),
+	}
+
+	if len(t.Category) > 0 {
+		i.Labels = append(i.Labels, t.Category)
+	}
+
+	if i.Eta >= infiniteEta || i.Eta < 0 {
+		i.Eta = -1
+	}
+
+	switch t.State {
+	case "error", "missingFiles":
+		i.Status = download.Failed
+		i.Error = t.State
+	case "uploading", "stalledUP", "forcedUP", "queuedUP":
+		i.Status = download.Seeding
+	case "pausedUP", "stoppedUP":
+		i.Status = download.Completed
+	case "pausedDL", "stoppedDL":
+		i.Status = download.Paused
+	case "queuedDL":
+		i.Status = download.Queued
+	case "checkingUP", "checkingDL", "checkingResumeData":
+		i.Status = download.Checking
+	case "moving":
+		if t.Progress >= 1 {
+			i.Status = download.Seeding
+		} else {
+			i.Status = download.Downloading
+		}
+	default:
+		// downloading, stalledDL, metaDL, forcedDL, forcedMetaDL and allocating.
+		i.Status = download.Downloading
+	}
+
+	return i
+}
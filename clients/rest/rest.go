@@ -22,8 +22,33 @@ import (
 	"github.com/MediaExchange/log"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
+)
+
+// Timeout limits how long a request may take, including reading the reply,
+// so an unresponsive service can't hold up its caller forever.
+const Timeout = 60 * time.Second
+
+var (
+	// Used by requests that don't need their own client.
+	defaultClient = &http.Client{Timeout: Timeout}
+
+	// Query parameters that hold API keys, passkeys or tokens. Their values
+	// are left out of the log.
+	secrets = map[string]bool {
+		"api_key":        true,
+		"apikey":         true,
+		"jackett_apikey": true,
+		"passkey":        true,
+		"password":       true,
+		"r":              true,
+		"token":          true,
+		"x-plex-token":   true,
+	}
 )
 
 type RestRequest struct {
@@ -31,6 +56,7 @@ type RestRequest struct {
 	query url.Values
 	restError error
 	replyBody interface{}
+	client *http.Client
 }
 
 // Client returns a new REST client that can be used to call a RESTful web service.
@@ -83,6 +109,36 @@ func (req *RestRequest) SetBearerAuth(t string) *RestRequest {
 	return req
 }
 
+// SetBasicAuth sets the Authorization header with a username and password.
+// Nothing is set when both are empty, so optional credentials can be passed through.
+func (req *RestRequest) SetBasicAuth(username string, password string) *RestRequest {
+	// Propagate previous errors.
+	if req.restError != nil {
+		return req
+	}
+
+	if len(username) > 0 || len(password) > 0 {
+		req.Request.SetBasicAuth(username, password)
+	}
+	return req
+}
+
+// SetHeader sets a request header, replacing any existing value.
+func (req *RestRequest) SetHeader(key string, value string) *RestRequest {
+	// Propagate previous errors.
+	if req.restError != nil {
+		return req
+	}
+
+	if len(key) == 0 {
+		req.restError = errors.New("rest: header key must be provided")
+		return req
+	}
+
+	req.Header.Set(key, value)
+	return req
+}
+
 // Body sets the request body to a serialized JSON object.
 func (req *RestRequest) SetBody(b interface{}) *RestRequest {
 	// Propagate previous errors.
@@ -101,16 +157,98 @@ func (req *RestRequest) SetBody(b interface{}) *RestRequest {
 		return req
 	}
 
-	req.Body = ioutil.NopCloser(bytes.NewReader(j))
-	req.ContentLength = int64(len(j))
-	req.GetBody = func() (io.ReadCloser, error) {
-		return req.Body, nil
+	req.setBody(j, "application/json")
+	return req
+}
+
+// SetFormBody sets the request body to URL-encoded form values.
+func (req *RestRequest) SetFormBody(values url.Values) *RestRequest {
+	// Propagate previous errors.
+	if req.restError != nil {
+		return req
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	if values == nil {
+		req.restError = errors.New("rest: form values must be provided")
+		return req
+	}
+
+	req.setBody([]byte(values.Encode()), "application/x-www-form-urlencoded")
 	return req
 }
 
+// SetMultipartBody sets the request body to multipart form data made up of
+// the values and, when content is not nil, a file in fileField.
+func (req *RestRequest) SetMultipartBody(values url.Values, fileField string, fileName string, content []byte) *RestRequest {
+	// Propagate previous errors.
+	if req.restError != nil {
+		return req
+	}
+
+	buf := new(bytes.Buffer)
+	w := multipart.NewWriter(buf)
+	for key, list := range values {
+		for _, value := range list {
+			if err := w.WriteField(key, value); err != nil {
+				req.restError = err
+				return req
+			}
+		}
+	}
+
+	if content != nil {
+		if len(fileField) == 0 || len(fileName) == 0 {
+			req.restError = errors.New("rest: file field and name must be provided")
+			return req
+		}
+
+		part, err := w.CreateFormFile(fileField, fileName)
+		if err == nil {
+			_, err = part.Write(content)
+		}
+		if err != nil {
+			req.restError = err
+			return req
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		req.restError = err
+		return req
+	}
+
+	req.setBody(buf.Bytes(), w.FormDataContentType())
+	return req
+}
+
+// SetCookieJar stores cookies set by the server in jar and sends any that
+// apply with the request. Clients that log in with a session cookie share
+// one jar across requests.
+func (req *RestRequest) SetCookieJar(jar http.CookieJar) *RestRequest {
+	// Propagate previous errors.
+	if req.restError != nil {
+		return req
+	}
+
+	if jar == nil {
+		req.restError = errors.New("rest: cookie jar must be provided")
+		return req
+	}
+
+	req.client = &http.Client{Jar: jar, Timeout: Timeout}
+	return req
+}
+
+// setBody replaces the request body with b.
+func (req *RestRequest) setBody(b []byte, contentType string) {
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	req.ContentLength = int64(len(b))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+	req.Header.Set("Content-Type", contentType)
+}
+
 func (req *RestRequest) SetReplyBody(t interface{}) *RestRequest {
 	if t == nil {
 		req.restError = errors.New("rest: reply body must be provided.")
@@ -148,10 +286,19 @@ func (req *RestRequest) do(rawurl string) (*http.Response, error) {
 
 	// Run the request using the built-in http library. This handles all
 	// buffering and 3xx redirect responses.
-	log.Info("Calling REST service", log.String("url", req.URL.String()))
-	res, err :=  http.DefaultClient.Do(req.Request)
+	log.Info("Calling REST service", log.String("url", redact(req.URL)))
+	client := defaultClient
+	if req.client != nil {
+		client = req.client
+	}
+	res, err := client.Do(req.Request)
 
 	if err != nil {
+		// The error repeats the URL, and callers log it too.
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			ue.URL = redact(req.URL)
+		}
 		log.Error("rest.do: Unexpected error", log.Err(err))
 		return nil, err
 	}
@@ -168,3 +315,19 @@ func (req *RestRequest) do(rawurl string) (*http.Response, error) {
 
 	return res, err
 }
+
+// redact returns the URL with the values of secret query parameters replaced,
+// so it can be logged.
+func redact(u *url.URL) string {
+	query := u.Query()
+	for key := range query {
+		if secrets[strings.ToLower(key)] {
+			query.Set(key, "REDACTED")
+		}
+	}
+
+	safe := *u
+	safe.User = nil
+	safe.RawQuery = query.Encode()
+	return safe.String()
+}
@@ -0,0 +1,349 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package sabnzbd is a download client for the SABnzbd JSON API.
+// https://sabnzbd.org/wiki/configuration/4.0/api
+package sabnzbd
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/clients/download"
+	"github.com/MediaExchange/mex/clients/rest"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Priority that adds a job paused.
+	pausedPriority = "-2"
+
+	bytesPerMB = 1024 * 1024
+)
+
+// Client talks to a single SABnzbd instance.
+type Client struct {
+	name   string
+	url    string
+	apiKey string
+}
+
+// reply holds the fields shared by every API response.
+type reply struct {
+	Status  *bool    `json:"status"`
+	Error   string   `json:"error"`
+	NzoIds  []string `json:"nzo_ids"`
+}
+
+// queueSlot is a job that is still downloading.
+type queueSlot struct {
+	NzoId       string  `json:"nzo_id"`
+	Filename    string  `json:"filename"`
+	Status      string  `json:"status"`
+	Percentage  string  `json:"percentage"`
+	Mb          string  `json:"mb"`
+	MbLeft      string  `json:"mbleft"`
+	TimeLeft    string  `json:"timeleft"`
+	Category    string  `json:"cat"`
+}
+
+// historySlot is a job that finished downloading, successfully or not.
+type historySlot struct {
+	NzoId       string  `json:"nzo_id"`
+	Name        string  `json:"name"`
+	Status      string  `json:"status"`
+	FailMessage string  `json:"fail_message"`
+	Bytes       int64   `json:"bytes"`
+	Storage     string  `json:"storage"`
+	Category    string  `json:"category"`
+	Completed   int64   `json:"completed"`
+}
+
+// New returns a client for the SABnzbd instance at url, e.g. http://localhost:8080.
+func New(name string, url string, apiKey string) *Client {
+	return &Client {
+		name:   name,
+		url:    strings.TrimSuffix(url, "/") + "/api",
+		apiKey: apiKey,
+	}
+}
+
+// Name returns the configured name of the client.
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Protocol returns download.Usenet.
+func (c *Client) Protocol() download.Protocol {
+	return download.Usenet
+}
+
+// Add sends an NZB by URL or file contents and returns the job's nzo_id.
+func (c *Client) Add(request download.AddRequest) (string, error) {
+	params := map[string]string{}
+	if len(request.Labels) > 0 {
+		params["cat"] = request.Labels[0]
+	}
+	if request.Paused {
+		params["priority"] = pausedPriority
+	}
+
+	var res reply
+	var err error
+	switch {
+	case len(request.File) > 0:
+		fileName := request.FileName
+		if len(fileName) == 0 {
+			fileName = "mex.nzb"
+		}
+		params["mode"] = "addfile"
+		err = c.call(params, &res, func(req *rest.RestRequest) *rest.RestRequest {
+			return req.SetMultipartBody(nil, "name", fileName, request.File)
+		})
+	case len(request.Url) > 0:
+		params["mode"] = "addurl"
+		params["name"] = request.Url
+		err = c.call(params, &res, nil)
+	default:
+		err = errors.New("sabnzbd.Add: a URL or file must be provided")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if len(res.NzoIds) == 0 {
+		return "", errors.New("sabnzbd.Add: job was not added")
+	}
+
+	log.Info("sabnzbd.Add", log.String("client", c.name), log.String("id", res.NzoIds[0]))
+	return res.NzoIds[0], nil
+}
+
+// List returns the jobs in the queue followed by those in the history.
+func (c *Client) List() ([]download.Item, error) {
+	queue := struct {
+		Queue struct {
+			Slots []queueSlot `json:"slots"`
+			KbPerSec string   `json:"kbpersec"`
+		} `json:"queue"`
+	}{}
+	err := c.call(map[string]string{"mode": "queue"}, &queue, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	history := struct {
+		History struct {
+			Slots []historySlot `json:"slots"`
+		} `json:"history"`
+	}{}
+	err = c.call(map[string]string{"mode": "history"}, &history, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]download.Item, 0, len(queue.Queue.Slots) + len(history.History.Slots))
+	for i, s := range queue.Queue.Slots {
+		item := s.item()
+
+		// SABnzbd downloads one job at a time, so the speed belongs to the first.
+		if i == 0 && item.Status == download.Downloading {
+			kb, _ := strconv.ParseFloat(queue.Queue.KbPerSec, 64)
+			item.DownloadSpeed = int64(kb * 1024)
+		}
+		items = append(items, item)
+	}
+	for _, s := range history.History.Slots {
+		items = append(items, s.item())
+	}
+	return items, nil
+}
+
+// Pause pauses a queued job.
+func (c *Client) Pause(id string) error {
+	return c.call(map[string]string{"mode": "queue", "name": "pause", "value": id}, nil, nil)
+}
+
+// Resume resumes a paused job.
+func (c *Client) Resume(id string) error {
+	return c.call(map[string]string{"mode": "queue", "name": "resume", "value": id}, nil, nil)
+}
+
+// Remove deletes a job from the queue or the history. SABnzbd ignores
+// unknown IDs, so both are tried.
+func (c *Client) Remove(id string, deleteData bool) error {
+	params := map[string]string{"name": "delete", "value": id}
+	if deleteData {
+		params["del_files"] = "1"
+	}
+
+	params["mode"] = "queue"
+	if err := c.call(params, nil, nil); err != nil {
+		return err
+	}
+
+	params["mode"] = "history"
+	return c.call(params, nil, nil)
+}
+
+// SetLabels changes a queued job's category to the first label.
+func (c *Client) SetLabels(id string, labels []string) error {
+	category := "*"
+	if len(labels) > 0 {
+		category = labels[0]
+	}
+	return c.call(map[string]string{"mode": "change_cat", "value": id, "value2": category}, nil, nil)
+}
+
+// SetPath is not supported; SABnzbd places jobs by category.
+func (c *Client) SetPath(id string, path string) error {
+	return download.ErrNotSupported
+}
+
+// call invokes an API mode and decodes the reply into result, which may be
+// nil. Parameters with empty values are left out. The optional build
+// function adds a request body, which makes the call a POST.
+func (c *Client) call(params map[string]string, result interface{}, build func(*rest.RestRequest) *rest.RestRequest) error {
+	var raw json.RawMessage
+	req := rest.NewRequest().
+		AddQuery("apikey", c.apiKey).
+		AddQuery("output", "json")
+	for k, v := range params {
+		if len(v) > 0 {
+			req.AddQuery(k, v)
+		}
+	}
+	req.SetReplyBody(&raw)
+
+	var res *http.Response
+	var err error
+	if build != nil {
+		res, err = build(req).Post(c.url)
+	} else {
+		res, err = req.Get(c.url)
+	}
+	if res != nil {
+		_ = res.Body.Close()
+	}
+	if err != nil {
+		log.Error("sabnzbd.call: unexpected error", log.String("client", c.name), log.String("mode", params["mode"]), log.Err(err))
+		return err
+	}
+
+	// Failures such as a wrong API key are reported with status false.
+	var r reply
+	if json.Unmarshal(raw, &r) == nil && r.Status != nil && !*r.Status {
+		err = errors.New("sabnzbd: " + r.Error)
+		log.Error("sabnzbd.call: request failed", log.String("client", c.name), log.String("mode", params["mode"]), log.Err(err))
+		return err
+	}
+
+	if result != nil {
+		return json.Unmarshal(raw, result)
+	}
+	return nil
+}
+
+// item converts a queue slot to a normalized download item.
+func (s queueSlot) item() download.Item {
+	mb, _ := strconv.ParseFloat(s.Mb, 64)
+	left, _ := strconv.ParseFloat(s.MbLeft, 64)
+	percent, _ := strconv.ParseFloat(s.Percentage, 64)
+
+	i := download.Item {
+		Id:         s.NzoId,
+		Name:       s.Filename,
+		Progress:   percent / 100,
+		Size:       int64(mb * bytesPerMB),
+		Downloaded: int64((mb - left) * bytesPerMB),
+		Eta:        duration(s.TimeLeft),
+		Labels:     labels(s.Category),
+	}
+
+	switch s.Status {
+	case "Downloading", "Fetching", "Grabbing":
+		i.Status = download.Downloading
+	case "Paused":
+		i.Status = download.Paused
+	case "Checking", "QuickCheck", "Verifying", "Repairing":
+		i.Status = download.Checking
+	default:
+		i.Status = download.Queued
+	}
+	return i
+}
+
+// item converts a history slot to a normalized download item.
+func (s historySlot) item() download.Item {
+	i := download.Item {
+		Id:         s.NzoId,
+		Name:       s.Name,
+		Size:       s.Bytes,
+		Path:       s.Storage,
+		Labels:     labels(s.Category),
+		Eta:        -1,
+	}
+
+	if s.Completed > 0 {
+		i.Added = time.Unix(s.Completed, 0)
+	}
+
+	switch s.Status {
+	case "Completed":
+		i.Status = download.Completed
+		i.Progress = 1
+		i.Downloaded = s.Bytes
+	case "Failed":
+		i.Status = download.Failed
+		i.Error = s.FailMessage
+	default:
+		// Post-processing: verifying, repairing, extracting or moving.
+		i.Status = download.Checking
+		i.Progress = 1
+		i.Downloaded = s.Bytes
+	}
+	return i
+}
+
+// labels returns the category as a label list. SABnzbd uses "*" for the default category.
+func labels(category string) []string {
+	if len(category) == 0 || category == "*" {
+		return make([]string, 0)
+	}
+	return []string{category}
+}
+
+// duration converts SABnzbd's [d:]h:mm:ss time left to seconds.
+func duration(s string) int64 {
+	var seconds int64
+	parts := strings.Split(s, ":")
+	multipliers := []int64{1, 60, 3600, 86400}
+	if len(s) == 0 || len(parts) > len(multipliers) {
+		return -1
+	}
+
+	for i := range parts {
+		n, err := strconv.ParseInt(parts[len(parts) - 1 - i], 10, 64)
+		if err != nil {
+			return -1
+		}
+		seconds += n * multipliers[i]
+	}
+	return seconds
+}
@@ -81,11 +81,37 @@ type detailResult struct {
 	VoteAverage         float64 `json:"vote_average"`
 }
 
-// Login retrieves the API key from the environment. There is no actual login
-// like TVDB uses.
+// Login stores the API key used by the other calls. There is no actual login
+// like TVDB uses, so the key is verified by pinging TMDB.
 func Login(apikey string) error {
 	log.Info("tmdb:Login")
+	if len(apikey) == 0 {
+		s := "tmdb.Login: API key must be provided"
+		log.Error(s)
+		return errors.New(s)
+	}
+
 	ApiKey = apikey
+	return Ping()
+}
+
+// Ping verifies that TMDB is reachable and accepts the API key.
+func Ping() error {
+	if len(ApiKey) == 0 {
+		s := "tmdb.Ping: Must login with API key before pinging"
+		log.Error(s)
+		return errors.New(s)
+	}
+
+	res, err := newRequest().Get(BaseUri + "/configuration")
+	if res != nil {
+		_ = res.Body.Close()
+	}
+	if err != nil {
+		log.Error("tmdb.Ping: unexpected error", log.Err(err))
+		return err
+	}
+
 	return nil
 }
 
@@ -192,6 +218,7 @@ func Details(id int) (*models.Details, error) {
 	}
 
 	if len(reply.ImdbId) > 0 {
+		d.ImdbId = reply.ImdbId
 		d.Links = append(d.Links, models.Link {
 			Name: "IMDB",
 			Url:  "https://www.imdb.com/title/" + reply.ImdbId,
@@ -0,0 +1,566 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package torznab searches indexers that implement the Newznab API or its
+// Torznab extension for torrents, such as Jackett, Prowlarr and most usenet
+// indexers. Several indexers can be configured; each one is a Client.
+// https://torznab.github.io/spec-1.3-draft/torznab/Specification-v1.3.html
+package torznab
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/clients/rest"
+	"github.com/MediaExchange/mex/models"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Search types, the `t` parameter of a search.
+const (
+	Search      = "search"
+	TvSearch    = "tvsearch"
+	MovieSearch = "movie"
+)
+
+// Largest response read from an indexer.
+const maxResponse = 16 * 1024 * 1024
+
+// Standard Newznab categories.
+const (
+	CategoryMovies = 2000
+	CategoryTv     = 5000
+)
+
+var (
+	// ErrNotSupported is returned when an indexer can't perform a type of search.
+	ErrNotSupported = errors.New("torznab: indexer does not support this search")
+)
+
+// Client is a single indexer.
+type Client struct {
+	name       string
+	url        string
+	apiKey     string
+	protocol   string
+	categories []int
+	mutex      sync.Mutex
+	caps       *Caps
+}
+
+// Query describes a search. Only the fields the indexer supports are sent;
+// the rest are left out, or folded into the search term if possible.
+type Query struct {
+	Type        string  // Search, TvSearch or MovieSearch.
+	Term        string  // Free text, usually the title.
+	ImdbId      string  // e.g. tt0944947.
+	TvdbId      int
+	TmdbId      int
+	Season      int
+	Episode     int
+	Categories  []int   // Categories to search, or empty for the indexer's defaults.
+	Offset      int     // Number of results to skip, for paging.
+}
+
+// Caps describes what an indexer supports.
+type Caps struct {
+	Limit       int                 `json:"limit"`          // Most results returned by one search.
+	Searches    map[string][]string `json:"searches"`       // Available search types and their supported parameters.
+	Categories  []Category          `json:"categories"`     // Categories the indexer uses.
+}
+
+// Category is a Newznab category.
+type Category struct {
+	Id          int         `json:"id"`
+	Name        string      `json:"name"`
+	Subcats     []Category  `json:"subcats,omitempty"`
+}
+
+// xmlError is returned by an indexer in place of results.
+type xmlError struct {
+	XMLName     xml.Name    `xml:"error"`
+	Code        int         `xml:"code,attr"`
+	Description string      `xml:"description,attr"`
+}
+
+// xmlCaps is the response to t=caps.
+type xmlCaps struct {
+	Limits struct {
+		Max     int         `xml:"max,attr"`
+		Default int         `xml:"default,attr"`
+	}                       `xml:"limits"`
+	Searching struct {
+		Searches []struct {
+			XMLName         xml.Name
+			Available       string  `xml:"available,attr"`
+			SupportedParams string  `xml:"supportedParams,attr"`
+		}           `xml:",any"`
+	}                       `xml:"searching"`
+	Categories []struct {
+		Id      int         `xml:"id,attr"`
+		Name    string      `xml:"name,attr"`
+		Subcats []struct {
+			Id      int     `xml:"id,attr"`
+			Name    string  `xml:"name,attr"`
+		}                   `xml:"subcat"`
+	}                       `xml:"categories>category"`
+}
+
+// xmlRss is the response to a search.
+type xmlRss struct {
+	Items []xmlItem         `xml:"channel>item"`
+}
+
+// xmlItem is a single release.
+type xmlItem struct {
+	Title       string      `xml:"title"`
+	Guid        string      `xml:"guid"`
+	Link        string      `xml:"link"`
+	Comments    string      `xml:"comments"`
+	PubDate     string      `xml:"pubDate"`
+	Size        int64       `xml:"size"`
+	Categories  []string    `xml:"category"`
+	Enclosure   struct {
+		Url     string      `xml:"url,attr"`
+		Length  int64       `xml:"length,attr"`
+	}                       `xml:"enclosure"`
+	Attrs       []struct {
+		Name    string      `xml:"name,attr"`
+		Value   string      `xml:"value,attr"`
+	}                       `xml:"attr"`
+}
+
+// New returns a client for the indexer API at url, e.g.
+// http://localhost:9117/api/v2.0/indexers/all/results/torznab. Protocol is
+// torrent for Torznab indexers and usenet for Newznab indexers. Categories
+// limit searches when a query doesn't set its own; TV and movie searches
+// only use the categories of their type.
+func New(name string, url string, apiKey string, protocol string, categories []int) *Client {
+	url = strings.TrimSuffix(url, "/")
+	if !strings.HasSuffix(url, "/api") {
+		url = url + "/api"
+	}
+
+	return &Client {
+		name:       name,
+		url:        url,
+		apiKey:     apiKey,
+		protocol:   protocol,
+		categories: categories,
+	}
+}
+
+// Name returns the configured name of the indexer.
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Protocol returns torrent or usenet.
+func (c *Client) Protocol() string {
+	return c.protocol
+}
+
+// Caps returns what the indexer supports. The answer is cached after the
+// first successful request.
+func (c *Client) Caps() (*Caps, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.caps != nil {
+		return c.caps, nil
+	}
+
+	var reply xmlCaps
+	if err := c.get(map[string]string{"t": "caps"}, &reply); err != nil {
+		return nil, err
+	}
+
+	caps := &Caps {
+		Limit:      reply.Limits.Max,
+		Searches:   make(map[string][]string),
+		Categories: make([]Category, 0, len(reply.Categories)),
+	}
+
+	for _, s := range reply.Searching.Searches {
+		if s.Available != "yes" {
+			continue
+		}
+
+		// The caps element names don't match the `t` values.
+		t := map[string]string{"search": Search, "tv-search": TvSearch, "movie-search": MovieSearch}[s.XMLName.Local]
+		if len(t) == 0 {
+			continue
+		}
+
+		params := make([]string, 0)
+		for _, p := range strings.Split(s.SupportedParams, ",") {
+			if p = strings.TrimSpace(p); len(p) > 0 {
+				params = append(params, p)
+			}
+		}
+		caps.Searches[t] = params
+	}
+
+	for _, cat := range reply.Categories {
+		category := Category{Id: cat.Id, Name: cat.Name}
+		for _, sub := range cat.Subcats {
+			category.Subcats = append(category.Subcats, Category{Id: sub.Id, Name: sub.Name})
+		}
+		caps.Categories = append(caps.Categories, category)
+	}
+
+	c.caps = caps
+	return caps, nil
+}
+
+// Search runs a query. Parameters the indexer doesn't support are dropped,
+// and a TV or movie search falls back to a plain search with the title and
+// episode in the term if the indexer doesn't have that search type.
+func (c *Client) Search(q Query) ([]models.Release, error) {
+	caps, err := c.Caps()
+	if err != nil {
+		return nil, err
+	}
+
+	categories := q.Categories
+	if len(categories) == 0 {
+		categories = c.defaultCategories(q.Type)
+	}
+
+	supported, ok := caps.Searches[q.Type]
+	if !ok {
+		if _, ok := caps.Searches[Search]; !ok || len(q.Term) == 0 {
+			return nil, ErrNotSupported
+		}
+		q = fallback(q)
+		supported = caps.Searches[Search]
+	}
+
+	params := map[string]string{"t": q.Type, "extended": "1"}
+	supports := func(p string) bool {
+		for _, s := range supported {
+			if s == p {
+				return true
+			}
+		}
+		return false
+	}
+
+	// IDs are more precise than the title, so the title is only sent when
+	// the indexer can't search by any of the IDs.
+	byId := false
+	if len(q.ImdbId) > 0 && supports("imdbid") {
+		params["imdbid"] = strings.TrimPrefix(q.ImdbId, "tt")
+		byId = true
+	}
+	if q.TvdbId > 0 && supports("tvdbid") {
+		params["tvdbid"] = strconv.Itoa(q.TvdbId)
+		byId = true
+	}
+	if q.TmdbId > 0 && supports("tmdbid") {
+		params["tmdbid"] = strconv.Itoa(q.TmdbId)
+		byId = true
+	}
+	if !byId && len(q.Term) > 0 {
+		params["q"] = q.Term
+	}
+	if q.Season > 0 && supports("season") {
+		params["season"] = strconv.Itoa(q.Season)
+	}
+	if q.Episode > 0 && supports("ep") {
+		params["ep"] = strconv.Itoa(q.Episode)
+	}
+
+	if len(categories) > 0 {
+		list := make([]string, 0, len(categories))
+		for _, cat := range categories {
+			list = append(list, strconv.Itoa(cat))
+		}
+		params["cat"] = strings.Join(list, ",")
+	}
+
+	if caps.Limit > 0 {
+		params["limit"] = strconv.Itoa(caps.Limit)
+	}
+	if q.Offset > 0 {
+		params["offset"] = strconv.Itoa(q.Offset)
+	}
+
+	var reply xmlRss
+	if err := c.get(params, &reply); err != nil {
+		return nil, err
+	}
+
+	releases := make([]models.Release, 0, len(reply.Items))
+	for _, item := range reply.Items {
+		releases = append(releases, c.release(item))
+	}
+	return releases, nil
+}
+
+// Recent returns the indexer's newest releases in the configured categories,
+// or the standard movie and TV categories, newest first. This is the
+// indexer's RSS feed.
+func (c *Client) Recent() ([]models.Release, error) {
+	caps, err := c.Caps()
+	if err != nil {
+		return nil, err
+	}
+
+	categories := c.categories
+	if len(categories) == 0 {
+		categories = []int{CategoryMovies, CategoryTv}
+	}
+	list := make([]string, 0, len(categories))
+	for _, cat := range categories {
+		list = append(list, strconv.Itoa(cat))
+	}
+
+	params := map[string]string{"t": Search, "extended": "1", "cat": strings.Join(list, ",")}
+	if caps.Limit > 0 {
+		params["limit"] = strconv.Itoa(caps.Limit)
+	}
+
+	var reply xmlRss
+	if err := c.get(params, &reply); err != nil {
+		return nil, err
+	}
+
+	releases := make([]models.Release, 0, len(reply.Items))
+	for _, item := range reply.Items {
+		releases = append(releases, c.release(item))
+	}
+	sort.SliceStable(releases, func(i, j int) bool {
+		return releases[i].Published.After(releases[j].Published)
+	})
+	return releases, nil
+}
+
+// get calls the API and decodes the XML reply into v. Indexers answer
+// errors with an <error> document and, usually, status 200.
+func (c *Client) get(params map[string]string, v interface{}) error {
+	req := rest.NewRequest().
+		SetHeader("Accept", "application/rss+xml, application/xml, text/xml").
+		AddQuery("apikey", c.apiKey)
+	for k, val := range params {
+		req.AddQuery(k, val)
+	}
+
+	res, err := req.Get(c.url)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		log.Error("torznab.get: unexpected error", log.String("indexer", c.name), log.String("t", params["t"]), log.Err(err))
+		return err
+	}
+
+	// Read the body once so it can be checked for an error before decoding.
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponse))
+	if err != nil {
+		return err
+	}
+
+	var e xmlError
+	if xml.Unmarshal(body, &e) == nil {
+		err = fmt.Errorf("torznab: %s: %s (%d)", c.name, e.Description, e.Code)
+		log.Error("torznab.get: indexer returned an error", log.String("indexer", c.name), log.Err(err))
+		return err
+	}
+
+	if err := xml.Unmarshal(body, v); err != nil {
+		log.Error("torznab.get: invalid response", log.String("indexer", c.name), log.Err(err))
+		return err
+	}
+	return nil
+}
+
+// release converts a search result.
+func (c *Client) release(item xmlItem) models.Release {
+	r := models.Release {
+		Guid:        item.Guid,
+		Title:       strings.TrimSpace(item.Title),
+		Indexer:     c.name,
+		Protocol:    c.protocol,
+		DownloadUrl: item.Enclosure.Url,
+		InfoUrl:     item.Comments,
+		Size:        item.Size,
+		Seeders:     -1,
+		Leechers:    -1,
+		Grabs:       -1,
+		Categories:  make([]int, 0),
+		Published:   parseDate(item.PubDate),
+	}
+
+	if len(r.DownloadUrl) == 0 {
+		r.DownloadUrl = item.Link
+	}
+	if len(r.Guid) == 0 {
+		r.Guid = r.DownloadUrl
+	}
+	if r.Size == 0 {
+		r.Size = item.Enclosure.Length
+	}
+
+	peers := -1
+	for _, a := range item.Attrs {
+		n, _ := strconv.Atoi(a.Value)
+		switch strings.ToLower(a.Name) {
+		case "size":
+			if r.Size == 0 {
+				r.Size, _ = strconv.ParseInt(a.Value, 10, 64)
+			}
+		case "seeders":
+			r.Seeders = n
+		case "leechers":
+			r.Leechers = n
+		case "peers":
+			peers = n
+		case "grabs":
+			r.Grabs = n
+		case "category":
+			r.Categories = append(r.Categories, n)
+		case "infohash":
+			r.InfoHash = strings.ToLower(a.Value)
+		case "magneturl":
+			r.MagnetUrl = a.Value
+		case "imdb", "imdbid":
+			if len(a.Value) > 0 && !strings.HasPrefix(a.Value, "tt") {
+				r.ImdbId = fmt.Sprintf("tt%07d", n)
+			} else {
+				r.ImdbId = a.Value
+			}
+		case "tvdbid":
+			r.TvdbId = n
+		case "season":
+			r.Season, _ = strconv.Atoi(strings.TrimPrefix(strings.ToUpper(a.Value), "S"))
+		case "episode":
+			r.Episode, _ = strconv.Atoi(strings.TrimPrefix(strings.ToUpper(a.Value), "E"))
+		}
+	}
+
+	// Torznab's peers attribute counts seeders too.
+	if r.Leechers < 0 && peers >= 0 && r.Seeders >= 0 {
+		r.Leechers = peers - r.Seeders
+	}
+
+	// Fall back to the <category> elements when there are no attributes.
+	if len(r.Categories) == 0 {
+		for _, cat := range item.Categories {
+			if n, err := strconv.Atoi(strings.TrimSpace(cat)); err == nil {
+				r.Categories = append(r.Categories, n)
+			}
+		}
+	}
+	sort.Ints(r.Categories)
+
+	return r
+}
+
+// defaultCategories returns the categories to search when a query doesn't
+// set any: the configured categories that match the type of search, or the
+// standard category for that type.
+func (c *Client) defaultCategories(searchType string) []int {
+	parent := 0
+	switch searchType {
+	case MovieSearch:
+		parent = CategoryMovies
+	case TvSearch:
+		parent = CategoryTv
+	default:
+		return c.categories
+	}
+
+	list := make([]int, 0)
+	for _, cat := range c.categories {
+		if cat / 1000 * 1000 == parent {
+			list = append(list, cat)
+		}
+	}
+	if len(list) == 0 {
+		list = append(list, parent)
+	}
+	return list
+}
+
+// fallback turns a TV or movie query into a plain search.
+func fallback(q Query) Query {
+	switch {
+	case q.Type == TvSearch && q.Season > 0 && q.Episode > 0:
+		q.Term = fmt.Sprintf("%s S%02dE%02d", q.Term, q.Season, q.Episode)
+	case q.Type == TvSearch && q.Season > 0:
+		q.Term = fmt.Sprintf("%s S%02d", q.Term, q.Season)
+	}
+
+	q.Type = Search
+	q.ImdbId = ""
+	q.TvdbId = 0
+	q.TmdbId = 0
+	q.Season = 0
+	q.Episode = 0
+	return q
+}
+
+// parseDate parses an RSS date. Indexers don't agree on the exact format.
+func parseDate(s string) time.Time {
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123, "Mon, 2 Jan 2006 15:04:05 -0700", time.RFC3339} {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+var (
+	mutex   sync.RWMutex
+	clients = make(map[string]*Client)
+)
+
+// Register adds a configured indexer, replacing any indexer with the same name.
+func Register(c *Client) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	clients[c.Name()] = c
+}
+
+// Get returns the indexer with the name, or nil.
+func Get(name string) *Client {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return clients[name]
+}
+
+// Indexers returns every registered indexer, sorted by name.
+func Indexers() []*Client {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	list := make([]*Client, 0, len(clients))
+	for _, c := range clients {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	return list
+}
@@ -0,0 +1,321 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package transmission is a download client for the Transmission BitTorrent
+// client's JSON-RPC interface.
+// https://github.com/transmission/transmission/blob/main/docs/rpc-spec.md
+package transmission
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/clients/download"
+	"github.com/MediaExchange/mex/clients/rest"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// Header carrying Transmission's CSRF token.
+	sessionHeader = "X-Transmission-Session-Id"
+)
+
+// Transmission status codes from the torrent-get `status` field.
+const (
+	statusStopped = iota
+	statusCheckWait
+	statusCheck
+	statusDownloadWait
+	statusDownload
+	statusSeedWait
+	statusSeed
+)
+
+var (
+	// Fields requested from torrent-get.
+	fields = []string {
+		"hashString", "name", "status", "percentDone", "sizeWhenDone", "downloadedEver",
+		"rateDownload", "rateUpload", "eta", "downloadDir", "labels", "error", "errorString",
+		"addedDate", "isFinished", "leftUntilDone",
+	}
+)
+
+// Client talks to a single Transmission daemon.
+type Client struct {
+	name        string
+	url         string
+	username    string
+	password    string
+	mutex       sync.Mutex
+	sessionId   string
+}
+
+// rpcRequest is the body of every RPC call.
+type rpcRequest struct {
+	Method      string      `json:"method"`
+	Arguments   interface{} `json:"arguments,omitempty"`
+}
+
+// rpcReply is the body of every RPC response. Arguments are decoded into the
+// value supplied by the caller.
+type rpcReply struct {
+	Result      string      `json:"result"`
+	Arguments   interface{} `json:"arguments"`
+}
+
+// torrent is a single entry from torrent-get.
+type torrent struct {
+	HashString      string      `json:"hashString"`
+	Name            string      `json:"name"`
+	Status          int         `json:"status"`
+	PercentDone     float64     `json:"percentDone"`
+	SizeWhenDone    int64       `json:"sizeWhenDone"`
+	DownloadedEver  int64       `json:"downloadedEver"`
+	RateDownload    int64       `json:"rateDownload"`
+	RateUpload      int64       `json:"rateUpload"`
+	Eta             int64       `json:"eta"`
+	DownloadDir     string      `json:"downloadDir"`
+	Labels          []string    `json:"labels"`
+	Error           int         `json:"error"`
+	ErrorString     string      `json:"errorString"`
+	AddedDate       int64       `json:"addedDate"`
+	IsFinished      bool        `json:"isFinished"`
+	LeftUntilDone   int64       `json:"leftUntilDone"`
+}
+
+// torrentRef identifies a torrent returned by torrent-add.
+type torrentRef struct {
+	HashString  string  `json:"hashString"`
+	Name        string  `json:"name"`
+}
+
+// New returns a client for the Transmission RPC endpoint at url, e.g.
+// http://localhost:9091/transmission/rpc. The username and password may be
+// empty if authentication is turned off.
+func New(name string, url string, username string, password string) *Client {
+	return &Client {
+		name:     name,
+		url:      url,
+		username: username,
+		password: password,
+	}
+}
+
+// Name returns the configured name of the client.
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Protocol returns download.Torrent.
+func (c *Client) Protocol() download.Protocol {
+	return download.Torrent
+}
+
+// Add adds a torrent by magnet link, URL or .torrent file contents.
+func (c *Client) Add(request download.AddRequest) (string, error) {
+	args := map[string]interface{} {
+		"paused": request.Paused,
+	}
+
+	switch {
+	case len(request.File) > 0:
+		args["metainfo"] = base64.StdEncoding.EncodeToString(request.File)
+	case len(request.Url) > 0:
+		args["filename"] = request.Url
+	default:
+		return "", errors.New("transmission.Add: a URL or file must be provided")
+	}
+
+	if len(request.Path) > 0 {
+		args["download-dir"] = request.Path
+	}
+	if len(request.Labels) > 0 {
+		args["labels"] = request.Labels
+	}
+
+	reply := struct {
+		Added       *torrentRef `json:"torrent-added"`
+		Duplicate   *torrentRef `json:"torrent-duplicate"`
+	}{}
+	if err := c.call("torrent-add", args, &reply); err != nil {
+		return "", err
+	}
+
+	ref := reply.Added
+	if ref == nil {
+		ref = reply.Duplicate
+	}
+	if ref == nil {
+		return "", errors.New("transmission.Add: torrent was not added")
+	}
+
+	log.Info("transmission.Add", log.String("client", c.name), log.String("name", ref.Name))
+	return ref.HashString, nil
+}
+
+// List returns every torrent.
+func (c *Client) List() ([]download.Item, error) {
+	reply := struct {
+		Torrents []torrent `json:"torrents"`
+	}{}
+	if err := c.call("torrent-get", map[string]interface{}{"fields": fields}, &reply); err != nil {
+		return nil, err
+	}
+
+	items := make([]download.Item, 0, len(reply.Torrents))
+	for _, t := range reply.Torrents {
+		items = append(items, t.item())
+	}
+	return items, nil
+}
+
+// Pause stops a torrent.
+func (c *Client) Pause(id string) error {
+	return c.call("torrent-stop", ids(id), nil)
+}
+
+// Resume starts a stopped torrent.
+func (c *Client) Resume(id string) error {
+	return c.call("torrent-start", ids(id), nil)
+}
+
+// Remove deletes a torrent and optionally its data.
+func (c *Client) Remove(id string, deleteData bool) error {
+	args := ids(id)
+	args["delete-local-data"] = deleteData
+	return c.call("torrent-remove", args, nil)
+}
+
+// SetLabels replaces a torrent's labels. Labels require Transmission 3.0 or later.
+func (c *Client) SetLabels(id string, labels []string) error {
+	args := ids(id)
+	args["labels"] = labels
+	return c.call("torrent-set", args, nil)
+}
+
+// SetPath moves a torrent's data to another directory.
+func (c *Client) SetPath(id string, path string) error {
+	args := ids(id)
+	args["location"] = path
+	args["move"] = true
+	return c.call("torrent-set-location", args, nil)
+}
+
+// call invokes an RPC method. Transmission rejects requests without a current
+// session ID with 409 Conflict and supplies the ID in the response, so the
+// request is retried once with the new ID.
+func (c *Client) call(method string, args interface{}, result interface{}) error {
+	reply := rpcReply{Arguments: result}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		c.mutex.Lock()
+		sessionId := c.sessionId
+		c.mutex.Unlock()
+
+		res, err := rest.NewRequest().
+			SetBasicAuth(c.username, c.password).
+			SetHeader(sessionHeader, sessionId).
+			SetBody(rpcRequest{Method: method, Arguments: args}).
+			SetReplyBody(&reply).
+			Post(c.url)
+		if res != nil {
+			_ = res.Body.Close()
+		}
+
+		if err != nil && res != nil && res.StatusCode == http.StatusConflict {
+			c.mutex.Lock()
+			c.sessionId = res.Header.Get(sessionHeader)
+			c.mutex.Unlock()
+			continue
+		}
+
+		if err != nil {
+			log.Error("transmission.call: unexpected error", log.String("client", c.name), log.String("method", method), log.Err(err))
+			return err
+		}
+
+		if reply.Result != "success" {
+			err = fmt.Errorf("transmission: %s: %s", method, reply.Result)
+			log.Error("transmission.call: request failed", log.String("client", c.name), log.Err(err))
+			return err
+		}
+
+		return nil
+	}
+
+	return errors.New("transmission: unable to obtain a session ID")
+}
+
+// ids returns RPC arguments selecting a single torrent by hash.
+func ids(id string) map[string]interface{} {
+	return map[string]interface{} {
+		"ids": []string{id},
+	}
+}
+
+// item converts a torrent to a normalized download item.
+func (t torrent) item() download.Item {
+	i := download.Item {
+		Id:            t.HashString,
+		Name:          t.Name,
+		Progress:      t.PercentDone,
+		Size:          t.SizeWhenDone,
+		Downloaded:    t.DownloadedEver,
+		DownloadSpeed: t.RateDownload,
+		UploadSpeed:   t.RateUpload,
+		Eta:           t.Eta,
+		Path:          t.DownloadDir,
+		Labels:        t.Labels,
+		Added:         time.Unix(t.AddedDate, 0),
+	}
+
+	if i.Labels == nil {
+		i.Labels = make([]string, 0)
+	}
+
+	// Transmission uses -1 and -2 for "not available" and "unknown".
+	if i.Eta < 0 {
+		i.Eta = -1
+	}
+
+	switch t.Status {
+	case statusStopped:
+		if t.LeftUntilDone == 0 || t.IsFinished {
+			i.Status = download.Completed
+		} else {
+			i.Status = download.Paused
+		}
+	case statusCheckWait, statusCheck:
+		i.Status = download.Checking
+	case statusDownloadWait:
+		i.Status = download.Queued
+	case statusDownload:
+		i.Status = download.Downloading
+	case statusSeedWait, statusSeed:
+		i.Status = download.Seeding
+	}
+
+	// Errors 1 and 2 are tracker warnings and errors; 3 is a local error that stops the torrent.
+	if t.Error == 3 {
+		i.Status = download.Failed
+		i.Error = t.ErrorString
+	}
+
+	return i
+}
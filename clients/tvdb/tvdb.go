@@ -127,6 +127,12 @@ type detailResult struct {
 // Login returns an authentication token used in future API calls.
 func Login(apikey string) error {
 	log.Info("tvdb.Login")
+	if len(apikey) == 0 {
+		s := "tvdb.Login: API key must be provided"
+		log.Error(s)
+		return errors.New(s)
+	}
+
 	reply := new(tokenReply)
 	_, err := rest.NewRequest().
 		SetBody(tokenRequest {
@@ -144,6 +150,12 @@ func Login(apikey string) error {
 	return nil
 }
 
+// Ping verifies that TVDB is reachable by refreshing the auth token, which
+// also keeps the token from expiring.
+func Ping() error {
+	return refresh()
+}
+
 // Search for a show by name.
 func Search(name string, results *[]models.SearchResult) error {
 	log.Info("tvdb.Search", log.String("name", name))
@@ -218,14 +230,15 @@ func Details(id int) (*models.Details, error) {
 		ReleaseDate: reply.Data.FirstAired,
 	}
 
-	// The runtime appears to be minutes stored in a string. Fingers crossed that this works.
+	// The runtime is minutes stored in a string, and may be empty.
 	runtime, err := strconv.Atoi(reply.Data.Runtime)
-	if err != nil {
+	if err == nil {
 		d.Runtime = runtime
 	}
 
 	// IMDB ID converted to a link.
 	if len(reply.Data.ImdbId) > 0 {
+		d.ImdbId = reply.Data.ImdbId
 		d.Links = append(d.Links, models.Link {
 			Name: "IMDB",
 			Url:  "https://www.imdb.com/title/" + reply.Data.ImdbId,
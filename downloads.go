@@ -0,0 +1,142 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/acquire"
+	"github.com/MediaExchange/mex/clients/download"
+	"github.com/MediaExchange/mex/clients/nzbget"
+	"github.com/MediaExchange/mex/clients/qbittorrent"
+	"github.com/MediaExchange/mex/clients/sabnzbd"
+	"github.com/MediaExchange/mex/clients/transmission"
+	"github.com/MediaExchange/mex/downloads"
+	"github.com/MediaExchange/mex/importer"
+	"github.com/MediaExchange/mex/naming"
+	"github.com/MediaExchange/mex/scanner"
+	"github.com/MediaExchange/mex/storage"
+	"strings"
+	"time"
+)
+
+// configureDownloadClients registers each configured download client.
+func configureDownloadClients(conf *MexConfig) error {
+	for _, c := range conf.DownloadClients {
+		if len(c.Name) == 0 || len(c.Url) == 0 {
+			return fmt.Errorf("download client %q: name and url are required", c.Name)
+		}
+
+		var client download.DownloadClient
+		switch strings.ToLower(c.Type) {
+		case "transmission":
+			client = transmission.New(c.Name, c.Url, c.Username, c.Password)
+		case "qbittorrent":
+			client = qbittorrent.New(c.Name, c.Url, c.Username, c.Password)
+		case "sabnzbd":
+			client = sabnzbd.New(c.Name, c.Url, c.ApiKey)
+		case "nzbget":
+			client = nzbget.New(c.Name, c.Url, c.Username, c.Password)
+		default:
+			return fmt.Errorf("download client %q: unknown type %q", c.Name, c.Type)
+		}
+
+		if download.Get(c.Name) != nil {
+			return fmt.Errorf("download client %q: name is already in use", c.Name)
+		}
+		download.Register(client)
+		log.Info("Registered download client", log.String("name", c.Name), log.String("type", c.Type))
+	}
+
+	if len(conf.Downloads.Category) > 0 {
+		downloads.Category = conf.Downloads.Category
+	}
+	if conf.Downloads.KeepDays > 0 {
+		downloads.Retention = time.Duration(conf.Downloads.KeepDays) * 24 * time.Hour
+	}
+	return nil
+}
+
+// configureImport sets where, how and with what names completed downloads
+// are imported.
+func configureImport(conf *MexConfig) error {
+	if len(conf.Import.Mode) > 0 {
+		mode := strings.ToLower(conf.Import.Mode)
+		if !importer.ValidMode(mode) {
+			return fmt.Errorf("import: unknown mode %q", conf.Import.Mode)
+		}
+		importer.Mode = mode
+	}
+
+	format := naming.Default
+	if len(conf.Naming.Movie) > 0 {
+		format.Movie = conf.Naming.Movie
+	}
+	if len(conf.Naming.Episode) > 0 {
+		format.Episode = conf.Naming.Episode
+	}
+	if len(conf.Naming.MultiEpisodeStyle) > 0 {
+		format.MultiEpisodeStyle = strings.ToLower(conf.Naming.MultiEpisodeStyle)
+	}
+	if err := format.Validate(); err != nil {
+		return fmt.Errorf("naming: %v", err)
+	}
+	naming.Current = format
+
+	scanner.Monitor = conf.Scan.Monitor
+	importer.MoviesDir = conf.Import.MoviesDir
+	importer.TvDir = conf.Import.TvDir
+	if len(importer.MoviesDir) == 0 && len(importer.TvDir) == 0 {
+		log.Warn("No import folders are configured; completed downloads won't be imported")
+	}
+	return nil
+}
+
+// scanInterval returns how often the import folders are scanned for media
+// that is already there, or 0 if they're only scanned when asked.
+func scanInterval(conf *MexConfig) time.Duration {
+	switch {
+	case conf.Scan.Interval < 0:
+		return 0
+	case conf.Scan.Interval > 0:
+		return seconds(conf.Scan.Interval)
+	}
+	return 24 * time.Hour
+}
+
+// pollInterval returns how often the download queue is refreshed.
+func pollInterval(conf *MexConfig) time.Duration {
+	if conf.Downloads.PollInterval > 0 {
+		return seconds(conf.Downloads.PollInterval)
+	}
+	return 10 * time.Second
+}
+
+// pollDownloads returns a function for services.NewTicker that refreshes the
+// download queue, blocklists the releases that failed and imports those that
+// finished. Changes to the stored downloads are serialized by the downloads
+// package, so searches and API calls can't overwrite them.
+func pollDownloads(store *storage.Store) func(ctx context.Context) {
+	poll := downloads.Poll(store)
+	failed := acquire.Failed(store)
+	imports := importer.Run(store)
+	return func(ctx context.Context) {
+		poll(ctx)
+		failed(ctx)
+		imports(ctx)
+	}
+}
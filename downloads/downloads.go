@@ -0,0 +1,464 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package downloads keeps track of the transfers in every configured
+// download client. A poller copies the state reported by each client into
+// storage so the API can list downloads without waiting on the clients,
+// and actions are passed through to the client that owns the download.
+package downloads
+
+import (
+	"context"
+	"errors"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/clients/download"
+	"github.com/MediaExchange/mex/events"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/storage"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Removed is the status of a download that its client no longer reports.
+	Removed = "removed"
+)
+
+var (
+	// ErrUnknownClient is returned when a download's client is no longer configured.
+	ErrUnknownClient = errors.New("downloads: download client is not configured")
+
+	// ErrNotRetryable is returned when a download can't be sent to its client again.
+	ErrNotRetryable = errors.New("downloads: only failed or removed downloads with a known source can be retried")
+)
+
+var (
+	// Retention is how long downloads that have left their client are kept.
+	Retention = 7 * 24 * time.Hour
+
+	// Category is the label or category given to releases MEX grabs.
+	Category = "mex"
+
+	// Only one change to the stored downloads is made at a time, so a
+	// refresh doesn't overwrite what was saved since it listed them.
+	mutex sync.Mutex
+
+	// Number of transfers being added to each client by Send. Guarded by mutex.
+	adding = make(map[string]int)
+)
+
+// Filter limits the downloads returned by List. Empty fields match everything.
+type Filter struct {
+	Client  string
+	Status  string
+	MediaId string
+}
+
+// Id returns the storage ID of a client's transfer.
+func Id(client string, downloadId string) string {
+	return client + ":" + downloadId
+}
+
+// Poll returns a function for services.NewTicker that refreshes every
+// download client.
+func Poll(store *storage.Store) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		for _, c := range download.Clients() {
+			if ctx.Err() != nil {
+				return
+			}
+			_ = Refresh(store, c)
+		}
+
+		if err := prune(store.Downloads, time.Now()); err != nil {
+			log.Error("downloads.Poll: unable to remove old downloads", log.Err(err))
+		}
+	}
+}
+
+// Send adds a transfer to a client, then saves the download that record builds
+// for it. The client is called without holding the mutex; until the download
+// is saved, refreshes of the client leave transfers they don't know about
+// alone, so they can't be stored without what MEX knows about them.
+func Send(store *storage.Store, c download.DownloadClient, request download.AddRequest, record func(downloadId string) *models.Download) (*models.Download, error) {
+	mutex.Lock()
+	adding[c.Name()]++
+	mutex.Unlock()
+
+	downloadId, err := c.Add(request)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if adding[c.Name()]--; adding[c.Name()] == 0 {
+		delete(adding, c.Name())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d := record(downloadId)
+	if err := store.Downloads.Save(d); err != nil {
+		log.Error("downloads.Send: unable to save download", log.String("id", d.Id), log.Err(err))
+		return nil, err
+	}
+	return d, nil
+}
+
+// Update changes a stored download. The download is read again while no
+// refresh is running, so the change is made to its latest state and a
+// refresh can't overwrite it.
+func Update(store *storage.Store, id string, change func(d *models.Download)) (*models.Download, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	d, err := store.Downloads.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	change(d)
+	if err := store.Downloads.Save(d); err != nil {
+		log.Error("downloads.Update: unable to save download", log.String("id", id), log.Err(err))
+		return nil, err
+	}
+	events.Publish(events.DownloadProgress, d.Public())
+	return d, nil
+}
+
+// Refresh stores the current state of every transfer in a client. Stored
+// downloads the client no longer reports are marked Removed. If the client
+// can't be reached nothing is changed.
+func Refresh(store *storage.Store, c download.DownloadClient) error {
+	items, err := c.List()
+	if err != nil {
+		log.Warn("downloads.Refresh: unable to list downloads", log.String("client", c.Name()), log.Err(err))
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	return refresh(store, c, items)
+}
+
+// refresh stores the transfers a client reported, as with Refresh. The
+// caller holds the mutex.
+func refresh(store *storage.Store, c download.DownloadClient, items []download.Item) error {
+	stored, err := store.Downloads.List()
+	if err != nil {
+		log.Error("downloads.Refresh: unable to list stored downloads", log.Err(err))
+		return err
+	}
+
+	existing := make(map[string]models.Download)
+	for _, d := range stored {
+		if d.Client == c.Name() {
+			existing[d.Id] = d
+		}
+	}
+
+	now := time.Now()
+	for _, item := range items {
+		id := Id(c.Name(), item.Id)
+		d, ok := existing[id]
+		delete(existing, id)
+		if !ok {
+			// Send saves the transfer itself once the client has accepted it.
+			if adding[c.Name()] > 0 {
+				continue
+			}
+			d = models.Download {
+				Id:         id,
+				Client:     c.Name(),
+				DownloadId: item.Id,
+				Added:      item.Added,
+			}
+		}
+
+		before := d
+		update(&d, c, item, now)
+		if err := store.Downloads.Save(&d); err != nil {
+			log.Error("downloads.Refresh: unable to save download", log.String("id", id), log.Err(err))
+			return err
+		}
+
+		switch {
+		case !ok:
+			events.Publish(events.DownloadAdded, d.Public())
+		case changed(before, d):
+			events.Publish(events.DownloadProgress, d.Public())
+		}
+	}
+
+	// Whatever is left was removed from the client, by MEX or someone else.
+	for _, d := range existing {
+		if d.Status == Removed {
+			continue
+		}
+
+		d.Status = Removed
+		d.DownloadSpeed = 0
+		d.UploadSpeed = 0
+		d.Eta = -1
+		if err := store.Downloads.Save(&d); err != nil {
+			log.Error("downloads.Refresh: unable to save download", log.String("id", d.Id), log.Err(err))
+			return err
+		}
+		events.Publish(events.DownloadProgress, d.Public())
+	}
+
+	return nil
+}
+
+// List returns the stored downloads that match the filter. Active downloads
+// come first, then the rest, most recently updated first.
+func List(repo storage.DownloadRepository, filter Filter) ([]models.Download, error) {
+	all, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.Download, 0, len(all))
+	for _, d := range all {
+		if len(filter.Client) > 0 && d.Client != filter.Client {
+			continue
+		}
+		if len(filter.Status) > 0 && d.Status != filter.Status {
+			continue
+		}
+		if len(filter.MediaId) > 0 && d.MediaId != filter.MediaId {
+			continue
+		}
+		list = append(list, d)
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		ai, aj := Active(list[i].Status), Active(list[j].Status)
+		if ai != aj {
+			return ai
+		}
+		return list[i].Updated.After(list[j].Updated)
+	})
+	return list, nil
+}
+
+// Active returns true for downloads that haven't finished.
+func Active(status string) bool {
+	switch download.Status(status) {
+	case download.Queued, download.Checking, download.Downloading, download.Paused:
+		return true
+	}
+	return false
+}
+
+// ValidStatus returns true if status is a known download status.
+func ValidStatus(status string) bool {
+	switch download.Status(status) {
+	case download.Queued, download.Checking, download.Downloading, download.Paused,
+		download.Seeding, download.Completed, download.Failed:
+		return true
+	}
+	return status == Removed
+}
+
+// Pause pauses a download.
+func Pause(store *storage.Store, id string) (*models.Download, error) {
+	return act(store, id, func(c download.DownloadClient, d *models.Download) error {
+		return c.Pause(d.DownloadId)
+	})
+}
+
+// Resume resumes a paused download.
+func Resume(store *storage.Store, id string) (*models.Download, error) {
+	return act(store, id, func(c download.DownloadClient, d *models.Download) error {
+		return c.Resume(d.DownloadId)
+	})
+}
+
+// Remove deletes a download from its client, and its data if deleteData is
+// true, then forgets it.
+func Remove(store *storage.Store, id string, deleteData bool) error {
+	d, c, err := lookup(store, id)
+	if err != nil {
+		return err
+	}
+
+	if d.Status != Removed {
+		if err := c.Remove(d.DownloadId, deleteData); err != nil {
+			log.Error("downloads.Remove: unable to remove download", log.String("id", id), log.Err(err))
+			return err
+		}
+	}
+
+	log.Info("downloads.Remove", log.String("id", id), log.Bool("deleteData", deleteData))
+	mutex.Lock()
+	defer mutex.Unlock()
+	if err := store.Downloads.Delete(id); err != nil {
+		return err
+	}
+	events.Publish(events.DownloadRemoved, map[string]string{"id": id})
+	return nil
+}
+
+// Retry sends a failed or removed download to its client again. The failed
+// transfer is removed from the client along with its data, and the new
+// transfer replaces it in storage.
+func Retry(store *storage.Store, id string) (*models.Download, error) {
+	d, c, err := lookup(store, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(d.Url) == 0 || (d.Status != string(download.Failed) && d.Status != Removed) {
+		return nil, ErrNotRetryable
+	}
+
+	if d.Status == string(download.Failed) {
+		if err := c.Remove(d.DownloadId, true); err != nil && !errors.Is(err, download.ErrNotFound) {
+			log.Error("downloads.Retry: unable to remove failed download", log.String("id", id), log.Err(err))
+			return nil, err
+		}
+	}
+
+	retried, err := resend(store, c, d)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("downloads.Retry", log.String("id", id), log.String("newId", retried.Id))
+	_ = Refresh(store, c)
+	return store.Downloads.Get(retried.Id)
+}
+
+// resend adds a download to its client again and replaces it in storage.
+func resend(store *storage.Store, c download.DownloadClient, d *models.Download) (*models.Download, error) {
+	retried, err := Send(store, c, download.AddRequest {
+		Url:    d.Url,
+		Labels: []string{Category},
+	}, func(downloadId string) *models.Download {
+		retried := *d
+		retried.Id = Id(c.Name(), downloadId)
+		retried.DownloadId = downloadId
+		retried.Status = string(download.Queued)
+		retried.Progress = 0
+		retried.Downloaded = 0
+		retried.Error = ""
+		retried.Blocklisted = false
+		retried.Imported = false
+		retried.ImportError = ""
+		retried.Added = time.Now()
+		retried.Updated = retried.Added
+		return &retried
+	})
+	if err != nil {
+		log.Error("downloads.Retry: unable to add download", log.String("id", d.Id), log.Err(err))
+		return nil, err
+	}
+
+	if retried.Id != d.Id {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err := store.Downloads.Delete(d.Id); err != nil {
+			return nil, err
+		}
+		events.Publish(events.DownloadRemoved, map[string]string{"id": d.Id})
+	}
+	return retried, nil
+}
+
+// act runs an action against the client that owns a download and returns
+// the refreshed download.
+func act(store *storage.Store, id string, action func(download.DownloadClient, *models.Download) error) (*models.Download, error) {
+	d, c, err := lookup(store, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Status == Removed {
+		return nil, download.ErrNotFound
+	}
+
+	if err := action(c, d); err != nil {
+		log.Error("downloads.act: action failed", log.String("id", id), log.Err(err))
+		return nil, err
+	}
+
+	_ = Refresh(store, c)
+	return store.Downloads.Get(id)
+}
+
+// lookup returns a stored download and the client that owns it.
+func lookup(store *storage.Store, id string) (*models.Download, download.DownloadClient, error) {
+	d, err := store.Downloads.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := download.Get(d.Client)
+	if c == nil {
+		return nil, nil, ErrUnknownClient
+	}
+	return d, c, nil
+}
+
+// update copies the state reported by a client into a stored download.
+func update(d *models.Download, c download.DownloadClient, item download.Item, now time.Time) {
+	d.Protocol = string(c.Protocol())
+	d.Name = item.Name
+	d.Status = string(item.Status)
+	d.Progress = item.Progress
+	d.Size = item.Size
+	d.Downloaded = item.Downloaded
+	d.DownloadSpeed = item.DownloadSpeed
+	d.UploadSpeed = item.UploadSpeed
+	d.Eta = item.Eta
+	d.Path = item.Path
+	d.Error = strings.TrimSpace(item.Error)
+	d.Updated = now
+
+	if d.Added.IsZero() || d.Added.Unix() <= 0 {
+		d.Added = now
+	}
+}
+
+// changed returns true if a refresh changed anything a user would see.
+func changed(before models.Download, after models.Download) bool {
+	return before.Status != after.Status ||
+		before.Progress != after.Progress ||
+		before.DownloadSpeed != after.DownloadSpeed ||
+		before.UploadSpeed != after.UploadSpeed ||
+		before.Eta != after.Eta ||
+		before.Error != after.Error ||
+		before.Path != after.Path
+}
+
+// prune deletes removed downloads that haven't been seen for Retention.
+func prune(repo storage.DownloadRepository, now time.Time) error {
+	all, err := repo.List()
+	if err != nil {
+		return err
+	}
+
+	for _, d := range all {
+		if d.Status == Removed && now.Sub(d.Updated) > Retention {
+			if err := repo.Delete(d.Id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package events is an in-process event bus. Parts of MEX publish typed
+// events when something changes, and subscribers such as the `/api/events`
+// stream receive them. Recent events are kept so a client that reconnects
+// can catch up on what it missed.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	DownloadAdded       = "download.added"
+	DownloadProgress    = "download.progress"
+	DownloadRemoved     = "download.removed"
+	LibraryAdded        = "library.added"
+	LibraryUpdated      = "library.updated"
+	LibraryRemoved      = "library.removed"
+	LibraryScanned      = "library.scanned"
+	RequestSubmitted    = "request.submitted"
+	RequestApproved     = "request.approved"
+	RequestDenied       = "request.denied"
+	RequestAvailable    = "request.available"
+	ProviderStatus      = "provider.status"
+)
+
+const (
+	// Number of recent events kept for clients that reconnect.
+	historySize = 512
+
+	// Events buffered for each subscriber before it is considered too slow.
+	bufferSize = 64
+)
+
+// Event is a single change published on the bus.
+type Event struct {
+	Id      uint64      `json:"id"`     // Increases by one for each event.
+	Type    string      `json:"type"`   // One of the event type constants.
+	Time    time.Time   `json:"time"`   // When the event was published.
+	Data    interface{} `json:"data"`   // The changed object, encoded as JSON for clients.
+}
+
+// Subscription receives events published after it was created.
+type Subscription struct {
+	// Events receives each event. It is closed when the subscription is
+	// cancelled or falls too far behind, in which case the subscriber should
+	// subscribe again from the last event it saw.
+	Events  <-chan Event
+
+	ch      chan Event
+}
+
+var (
+	mutex       sync.Mutex
+	lastId      uint64
+	history     []Event
+	subscribers = make(map[*Subscription]struct{})
+	closed      bool
+)
+
+// Publish sends an event to every subscriber. It never blocks: a
+// subscriber that isn't keeping up is dropped.
+func Publish(eventType string, data interface{}) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	lastId++
+	e := Event{Id: lastId, Type: eventType, Time: time.Now(), Data: data}
+
+	history = append(history, e)
+	if len(history) > historySize {
+		history = history[len(history) - historySize:]
+	}
+
+	for s := range subscribers {
+		select {
+		case s.ch <- e:
+		default:
+			delete(subscribers, s)
+			close(s.ch)
+		}
+	}
+}
+
+// Subscribe returns a subscription along with the events published after
+// since, which is the ID of the last event the caller saw or 0 for none.
+// complete is false if some of those events are no longer kept, meaning the
+// caller should reload its state instead of relying on the replay.
+func Subscribe(since uint64) (sub *Subscription, missed []Event, complete bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	ch := make(chan Event, bufferSize)
+	sub = &Subscription{Events: ch, ch: ch}
+	if closed {
+		close(ch)
+	} else {
+		subscribers[sub] = struct{}{}
+	}
+
+	complete = true
+	if since > 0 {
+		// A client that saw an ID from before a restart can't be caught up.
+		if since > lastId {
+			complete = false
+		}
+
+		for _, e := range history {
+			if e.Id > since {
+				missed = append(missed, e)
+			}
+		}
+
+		if len(history) > 0 && history[0].Id > since + 1 {
+			complete = false
+		}
+	}
+
+	return sub, missed, complete
+}
+
+// Cancel stops the subscription and closes its channel.
+func (s *Subscription) Cancel() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if _, ok := subscribers[s]; ok {
+		delete(subscribers, s)
+		close(s.ch)
+	}
+}
+
+// Close ends every subscription so long-lived streams finish when MEX shuts
+// down. Later subscriptions are closed immediately.
+func Close() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	closed = true
+	for s := range subscribers {
+		delete(subscribers, s)
+		close(s.ch)
+	}
+}
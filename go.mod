@@ -1,9 +1,11 @@
 module github.com/MediaExchange/mex
 
-go 1.14
+go 1.16
 
 require (
 	github.com/MediaExchange/config v1.0.0
 	github.com/MediaExchange/log v1.0.0
 	github.com/MediaExchange/router v1.0.0
+	go.etcd.io/bbolt v1.3.9
+	golang.org/x/crypto v0.14.0
 )
@@ -0,0 +1,173 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package health tracks the state MEX needs to report whether it is ready
+// to serve requests: whether the configuration was loaded and whether each
+// media provider is authenticated and reachable.
+package health
+
+import (
+	"github.com/MediaExchange/mex/events"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProviderStatus describes the last known state of a media provider.
+type ProviderStatus struct {
+	Name            string      `json:"name"`           // Provider name, e.g. "tmdb".
+	Authenticated   bool        `json:"authenticated"`  // True if the last login succeeded.
+	Reachable       bool        `json:"reachable"`      // True if the last check reached the provider.
+	LastCheck       time.Time   `json:"lastCheck"`      // When the provider was last checked.
+	Error           string      `json:"error"`          // Error from the last check, if any.
+}
+
+// Available returns true if the provider can be used.
+func (p ProviderStatus) Available() bool {
+	return p.Authenticated && p.Reachable
+}
+
+var (
+	// Started is when the process started.
+	Started = time.Now()
+
+	mutex        sync.RWMutex
+	configLoaded bool
+	providers    = make(map[string]*ProviderStatus)
+)
+
+// SetConfigLoaded records that the configuration file was read successfully.
+func SetConfigLoaded() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	configLoaded = true
+}
+
+// ConfigLoaded returns true once the configuration file was read successfully.
+func ConfigLoaded() bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return configLoaded
+}
+
+// SetAuthenticated records the result of logging in to a provider. A
+// successful login also means the provider was reachable.
+func SetAuthenticated(name string, err error) {
+	mutex.Lock()
+	p := provider(name)
+	before := *p
+	p.Authenticated = err == nil
+	if err == nil {
+		p.Reachable = true
+	}
+	p.LastCheck = time.Now()
+	p.Error = errorString(err)
+	after := *p
+	mutex.Unlock()
+
+	publishChange(before, after)
+}
+
+// SetReachable records the result of checking that a provider responds.
+func SetReachable(name string, err error) {
+	mutex.Lock()
+	p := provider(name)
+	before := *p
+	p.Reachable = err == nil
+	p.LastCheck = time.Now()
+	p.Error = errorString(err)
+	after := *p
+	mutex.Unlock()
+
+	publishChange(before, after)
+}
+
+// publishChange publishes a provider's status if it changed. Routine checks
+// with the same result only change LastCheck and aren't published.
+func publishChange(before ProviderStatus, after ProviderStatus) {
+	if before.Authenticated != after.Authenticated || before.Reachable != after.Reachable || before.Error != after.Error {
+		events.Publish(events.ProviderStatus, after)
+	}
+}
+
+// Provider returns the status of a single provider.
+func Provider(name string) ProviderStatus {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	if p, ok := providers[name]; ok {
+		return *p
+	}
+	return ProviderStatus{Name: name}
+}
+
+// Providers returns the status of every provider, sorted by name.
+func Providers() []ProviderStatus {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	list := make([]ProviderStatus, 0, len(providers))
+	for _, p := range providers {
+		list = append(list, *p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Ready returns true if the configuration is loaded and at least one
+// provider is available. MEX serves whatever providers are working.
+func Ready() bool {
+	if !ConfigLoaded() {
+		return false
+	}
+
+	for _, p := range Providers() {
+		if p.Available() {
+			return true
+		}
+	}
+	return false
+}
+
+// Degraded returns true if any provider is unavailable.
+func Degraded() bool {
+	for _, p := range Providers() {
+		if !p.Available() {
+			return true
+		}
+	}
+	return false
+}
+
+// provider returns the status for name, creating it if necessary. The mutex must be held.
+func provider(name string) *ProviderStatus {
+	p, ok := providers[name]
+	if !ok {
+		p = &ProviderStatus{Name: name}
+		providers[name] = p
+	}
+	return p
+}
+
+// errorString returns the error message, or an empty string if err is nil.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,54 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"github.com/MediaExchange/config"
+	"github.com/MediaExchange/log"
+	"net/http"
+	"time"
+)
+
+// probe requests path from the server running on this machine and returns
+// an error unless it responds with 200 OK.
+func probe(path string) error {
+	conf := new(MexConfig)
+	if err := config.FromFile(configFile, conf); err != nil {
+		log.Error("Error reading " + configFile, log.Err(err))
+		return err
+	}
+
+	client := http.Client {
+		Timeout: 5 * time.Second,
+	}
+
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", conf.Server.Port, path)
+	res, err := client.Get(url)
+	if err != nil {
+		log.Error("Health check failed", log.String("url", url), log.Err(err))
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("health check returned %s", res.Status)
+		log.Error("Health check failed", log.String("url", url), log.Err(err))
+		return err
+	}
+
+	return nil
+}
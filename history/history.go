@@ -0,0 +1,105 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package history records what MEX did with releases, such as grabbing
+// them, so users can see how each library item was acquired.
+package history
+
+import (
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/storage"
+	"time"
+)
+
+// Filter limits the entries returned by List. Empty fields match everything.
+type Filter struct {
+	MediaId string
+	Type    models.HistoryType
+}
+
+// Record stores a history entry dated now.
+func Record(repo storage.HistoryRepository, entry models.History) (*models.History, error) {
+	entry.Id = 0
+	entry.Date = time.Now()
+	if err := repo.Save(&entry); err != nil {
+		log.Error("history.Record: unable to save entry", log.String("mediaId", entry.MediaId), log.Err(err))
+		return nil, err
+	}
+
+	log.Info("history.Record", log.String("type", string(entry.Type)), log.String("mediaId", entry.MediaId), log.String("release", entry.Release))
+	return &entry, nil
+}
+
+// List returns the entries that match the filter, newest first.
+func List(repo storage.HistoryRepository, filter Filter) ([]models.History, error) {
+	all, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.History, 0, len(all))
+	for i := len(all) - 1; i >= 0; i-- {
+		h := all[i]
+		if len(filter.MediaId) > 0 && h.MediaId != filter.MediaId {
+			continue
+		}
+		if len(filter.Type) > 0 && h.Type != filter.Type {
+			continue
+		}
+		list = append(list, h)
+	}
+	return list, nil
+}
+
+// Episode identifies an episode of a library item. The zero value stands
+// for a movie.
+type Episode struct {
+	Season  int
+	Episode int
+}
+
+// Qualities returns the quality of each copy MEX imported for a library
+// item that hasn't been deleted since, by episode.
+func Qualities(repo storage.HistoryRepository, mediaId string) (map[Episode]string, error) {
+	all, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	qualities := make(map[Episode]string)
+	for _, h := range all {
+		if h.MediaId != mediaId || (h.Type != models.HistoryImported && h.Type != models.HistoryDeleted) {
+			continue
+		}
+
+		keys := []Episode{{}}
+		if len(h.Episodes) > 0 {
+			keys = make([]Episode, 0, len(h.Episodes))
+			for _, n := range h.Episodes {
+				keys = append(keys, Episode{h.Season, n})
+			}
+		}
+		for _, k := range keys {
+			if h.Type == models.HistoryImported {
+				qualities[k] = h.Quality
+			} else {
+				delete(qualities, k)
+			}
+		}
+	}
+	return qualities, nil
+}
@@ -0,0 +1,216 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package importer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Videos smaller than this are samples, whatever they're called.
+const minVideoSize = 40 * 1024 * 1024
+
+// File extensions of the videos Plex plays.
+var videoExtensions = map[string]bool {
+	".avi":  true,
+	".divx": true,
+	".m2ts": true,
+	".m4v":  true,
+	".mkv":  true,
+	".mov":  true,
+	".mp4":  true,
+	".mpeg": true,
+	".mpg":  true,
+	".ts":   true,
+	".webm": true,
+	".wmv":  true,
+}
+
+// Folders that hold extras rather than the movie or episodes. Plex uses the
+// same names for local extras.
+var extrasFolders = map[string]bool {
+	"behind the scenes": true,
+	"bonus":             true,
+	"deleted scenes":    true,
+	"extras":            true,
+	"featurettes":       true,
+	"interviews":        true,
+	"other":             true,
+	"sample":            true,
+	"samples":           true,
+	"scenes":            true,
+	"shorts":            true,
+	"trailers":          true,
+}
+
+// File name suffixes Plex uses for local extras, e.g. Movie-trailer.mkv.
+var extrasSuffixes = []string {
+	"-behindthescenes", "-deleted", "-featurette", "-interview", "-other", "-sample", "-scene", "-short", "-trailer",
+}
+
+// video is a video file found in a download.
+type video struct {
+	path string
+	size int64
+}
+
+// videos returns the video files at path, which is a file or a folder,
+// without samples and extras. The largest come first.
+func videos(path string) ([]video, error) {
+	found := make([]video, 0)
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if p != path && extrasFolders[strings.ToLower(info.Name())] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() && isVideo(info.Name()) && !isExtra(info.Name(), info.Size()) {
+			found = append(found, video{path: p, size: info.Size()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].size > found[j].size
+	})
+	return found, nil
+}
+
+// Videos returns the paths of the video files at path, which is a file or
+// a folder, without samples and extras. The largest come first.
+func Videos(path string) ([]string, error) {
+	found, err := videos(path)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(found))
+	for _, v := range found {
+		paths = append(paths, v.path)
+	}
+	return paths, nil
+}
+
+// isVideo returns true if the file name has a video extension.
+func isVideo(name string) bool {
+	return videoExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// isExtra returns true for samples, trailers and other extras.
+func isExtra(name string, size int64) bool {
+	if size < minVideoSize {
+		return true
+	}
+
+	base := strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+	for _, suffix := range extrasSuffixes {
+		if strings.HasSuffix(base, suffix) {
+			return true
+		}
+	}
+	for _, w := range strings.FieldsFunc(base, func(c rune) bool {
+		return strings.ContainsRune(" ._-[](){}", c)
+	}) {
+		if w == "sample" {
+			return true
+		}
+	}
+	return false
+}
+
+// transfer places the file at src at dst using the import mode, replacing
+// any file already at dst. The file is linked or copied to a temporary name
+// next to dst and renamed over it, so the file already there is only
+// replaced once the new one is complete. Hard links fall back to copying
+// when src and dst are on different file systems, and so do moves.
+func transfer(mode string, src string, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	// The file is already in place, as when a download is imported again.
+	if same(src, dst) {
+		return nil
+	}
+
+	if mode == Move {
+		if err := os.Rename(src, dst); err == nil {
+			return nil
+		}
+	}
+
+	tmp := dst + ".partial"
+	_ = os.Remove(tmp)
+	if mode != Hardlink || os.Link(src, tmp) != nil {
+		if err := copyFile(src, tmp); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if mode == Move {
+		return os.Remove(src)
+	}
+	return nil
+}
+
+// same returns true if src and dst are the same file.
+func same(src string, dst string) bool {
+	a, err := os.Stat(src)
+	if err != nil {
+		return false
+	}
+	b, err := os.Stat(dst)
+	return err == nil && os.SameFile(a, b)
+}
+
+// copyFile copies src to dst. A partial copy is removed if it fails.
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	return nil
+}
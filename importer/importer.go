@@ -0,0 +1,416 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package importer places the videos of completed downloads in the movie
+// and TV folders that Plex watches, named by the naming templates. By
+// default they're named the way Plex expects:
+//
+//     Movies/Title (Year)/Title (Year).mkv
+//     TV/Title (Year)/Season 01/Title (Year) - s01e02 - Episode Name.mkv
+//
+// Samples and extras are left behind. Files are moved, copied or hard
+// linked; hard links let torrents keep seeding without using more space.
+// Plex is then asked to scan the folders the files went into.
+package importer
+
+import (
+	"context"
+	"errors"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/acquire"
+	"github.com/MediaExchange/mex/clients/download"
+	"github.com/MediaExchange/mex/downloads"
+	"github.com/MediaExchange/mex/history"
+	"github.com/MediaExchange/mex/library"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/naming"
+	"github.com/MediaExchange/mex/parser"
+	"github.com/MediaExchange/mex/plex"
+	"github.com/MediaExchange/mex/requests"
+	"github.com/MediaExchange/mex/storage"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Import modes.
+const (
+	Move     = "move"
+	Copy     = "copy"
+	Hardlink = "hardlink"
+)
+
+var (
+	// ErrNotGrabbed is returned when importing a download MEX didn't grab for a library item.
+	ErrNotGrabbed = errors.New("importer: download isn't for a library item")
+
+	// ErrNotComplete is returned when importing a download that hasn't finished.
+	ErrNotComplete = errors.New("importer: download hasn't finished")
+
+	// ErrNoRoot is returned when no folder is configured for the media's type.
+	ErrNoRoot = errors.New("importer: no folder is configured for this type of media")
+
+	// ErrMissing is returned when the download's files can't be found.
+	ErrMissing = errors.New("importer: the download's files can't be found")
+
+	// ErrNoVideo is returned when a download has no video files other than samples and extras.
+	ErrNoVideo = errors.New("importer: no video files were found")
+
+	// ErrNoMatch is returned when none of a download's videos match the show's episodes.
+	ErrNoMatch = errors.New("importer: no video files match the show's episodes")
+)
+
+var (
+	// MoviesDir is the folder movies are imported into.
+	MoviesDir string
+
+	// TvDir is the folder TV shows are imported into.
+	TvDir string
+
+	// Mode is how files are placed in the library: Move, Copy or Hardlink.
+	Mode = Hardlink
+
+	// Only one import runs at a time.
+	mutex sync.Mutex
+)
+
+// ValidMode returns true if mode is one of the import modes.
+func ValidMode(mode string) bool {
+	return mode == Move || mode == Copy || mode == Hardlink
+}
+
+// Run returns a function for services.NewTicker that imports the completed
+// downloads MEX grabbed. Downloads without video files are failed so their
+// releases are blocklisted. Downloads that can't be imported for any other
+// reason keep the error and are skipped until they're imported by hand.
+func Run(store *storage.Store) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		if len(MoviesDir) == 0 && len(TvDir) == 0 {
+			return
+		}
+
+		list, err := store.Downloads.List()
+		if err != nil {
+			log.Error("importer.Run: unable to list downloads", log.Err(err))
+			return
+		}
+
+		for i := range list {
+			if ctx.Err() != nil {
+				return
+			}
+
+			d := &list[i]
+			if len(d.MediaId) == 0 || d.Imported || d.Blocklisted || len(d.ImportError) > 0 || !complete(d) {
+				continue
+			}
+
+			_, err := Import(store, d.Id)
+			switch err {
+			case nil, ErrNoRoot:
+			case ErrNoVideo:
+				if err := acquire.Fail(store, d, "No video files were found"); err != nil {
+					log.Warn("importer.Run: unable to fail download", log.String("id", d.Id), log.Err(err))
+				}
+			default:
+				if err := setError(store, d.Id, err); err != nil {
+					log.Error("importer.Run: unable to save download", log.String("id", d.Id), log.Err(err))
+				}
+			}
+		}
+	}
+}
+
+// Import places the videos of a completed download in the library, marks
+// the movie or episodes as downloaded and records each file in the history.
+func Import(store *storage.Store, id string) ([]models.History, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	d, err := store.Downloads.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.MediaId) == 0 {
+		return nil, ErrNotGrabbed
+	}
+	if !complete(d) {
+		return nil, ErrNotComplete
+	}
+
+	item, err := store.Media.Get(d.MediaId)
+	if err != nil {
+		return nil, err
+	}
+
+	root := MoviesDir
+	if item.Type == models.TvShow {
+		root = TvDir
+	}
+	if len(root) == 0 {
+		return nil, ErrNoRoot
+	}
+
+	files, err := videos(location(d))
+	if err != nil {
+		log.Warn("importer.Import: unable to read download", log.String("id", id), log.String("path", location(d)), log.Err(err))
+		return nil, ErrMissing
+	}
+	if len(files) == 0 {
+		return nil, ErrNoVideo
+	}
+
+	var imported []models.History
+	if item.Type == models.Movie {
+		imported, err = importMovie(store, d, item, root, files[0])
+	} else {
+		imported, err = importEpisodes(store, d, item, root, files)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := downloads.Update(store, id, func(d *models.Download) {
+		d.Imported = true
+		d.ImportError = ""
+	}); err != nil {
+		return nil, err
+	}
+
+	// Plex finds the files sooner when it's told which folders to scan.
+	refreshed := make(map[string]bool)
+	for _, h := range imported {
+		if folder := filepath.Dir(h.Message); !refreshed[folder] {
+			refreshed[folder] = true
+			plex.Refresh(item.Type, folder)
+		}
+	}
+
+	if item, err := store.Media.Get(d.MediaId); err == nil {
+		if err := requests.MarkAvailable(store, item); err != nil {
+			log.Warn("importer.Import: unable to mark requests available", log.String("mediaId", item.Id), log.Err(err))
+		}
+	}
+	return imported, nil
+}
+
+// importMovie places the largest video of a download where the movie
+// template says.
+func importMovie(store *storage.Store, d *models.Download, item *models.MediaItem, root string, file video) ([]models.History, error) {
+	name, err := naming.Current.MoviePath(media(d, item, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	dst := filepath.Join(root, filepath.FromSlash(name) + strings.ToLower(filepath.Ext(file.path)))
+	if err := place(d, file.path, dst); err != nil {
+		return nil, err
+	}
+
+	if _, err := library.SetDownloaded(store.Media, item.Id, 0, nil); err != nil {
+		return nil, err
+	}
+	replace(store, item, root, 0, nil, dst)
+
+	h, err := record(store, d, item, 0, nil, dst)
+	if err != nil {
+		return nil, err
+	}
+	return []models.History{*h}, nil
+}
+
+// importEpisodes places each video of a download that matches episodes of
+// the show where the episode template says. Videos that don't match are
+// skipped.
+func importEpisodes(store *storage.Store, d *models.Download, item *models.MediaItem, root string, files []video) ([]models.History, error) {
+	imported := make([]models.History, 0, len(files))
+	for _, file := range files {
+		season, episodes := library.EpisodesOf(item, parser.Parse(filepath.Base(file.path)))
+
+		// A single video is often named after its folder or nothing useful,
+		// so the release name and what was grabbed are used instead.
+		if len(episodes) == 0 && len(files) == 1 {
+			release := d.Release
+			if len(release) == 0 {
+				release = d.Name
+			}
+			season, episodes = library.EpisodesOf(item, parser.Parse(release))
+			if len(episodes) == 0 && len(d.Episodes) > 0 {
+				season, episodes = d.Season, d.Episodes
+			}
+		}
+
+		if len(episodes) == 0 {
+			log.Warn("importer.importEpisodes: video doesn't match an episode", log.String("id", d.Id), log.String("file", file.path))
+			continue
+		}
+
+		list := make([]models.Episode, 0, len(episodes))
+		for _, n := range episodes {
+			if e := item.FindEpisode(season, n); e != nil {
+				list = append(list, models.Episode {
+					Name:    e.Name,
+					Number:  e.Number,
+					Season:  e.Season,
+					Episode: e.Episode,
+					AirDate: e.AirDate,
+				})
+			}
+		}
+
+		name, err := naming.Current.EpisodePath(media(d, item, list))
+		if err != nil {
+			return nil, err
+		}
+
+		dst := filepath.Join(root, filepath.FromSlash(name) + strings.ToLower(filepath.Ext(file.path)))
+		if err := place(d, file.path, dst); err != nil {
+			return nil, err
+		}
+
+		if _, err := library.SetDownloaded(store.Media, item.Id, season, episodes); err != nil {
+			return nil, err
+		}
+		replace(store, item, root, season, episodes, dst)
+
+		h, err := record(store, d, item, season, episodes, dst)
+		if err != nil {
+			return nil, err
+		}
+		imported = append(imported, *h)
+	}
+
+	if len(imported) == 0 {
+		return nil, ErrNoMatch
+	}
+	return imported, nil
+}
+
+// place transfers a file into the library using the import mode.
+func place(d *models.Download, src string, dst string) error {
+	if err := transfer(Mode, src, dst); err != nil {
+		log.Error("importer.place: unable to import file", log.String("id", d.Id), log.String("from", src), log.String("to", dst), log.Err(err))
+		return err
+	}
+	log.Info("importer.place", log.String("id", d.Id), log.String("from", src), log.String("to", dst), log.String("mode", Mode))
+	return nil
+}
+
+// replace deletes the files imported before for a movie, or for episodes
+// that are all in the new file, now that dst has replaced them, as when a
+// copy is upgraded. Files outside root are left alone.
+func replace(store *storage.Store, item *models.MediaItem, root string, season int, episodes []int, dst string) {
+	imported, err := history.List(store.History, history.Filter{MediaId: item.Id, Type: models.HistoryImported})
+	if err != nil {
+		log.Warn("importer.replace: unable to read the history", log.String("mediaId", item.Id), log.Err(err))
+		return
+	}
+
+	for _, h := range imported {
+		if len(h.Message) == 0 || h.Message == dst || !naming.Inside(h.Message, root) {
+			continue
+		}
+		if item.Type == models.TvShow && (h.Season != season || len(h.Episodes) == 0 || !subset(h.Episodes, episodes)) {
+			continue
+		}
+
+		if err := os.Remove(h.Message); err == nil {
+			log.Info("importer.replace: deleted replaced file", log.String("mediaId", item.Id), log.String("path", h.Message))
+		} else if !os.IsNotExist(err) {
+			log.Warn("importer.replace: unable to delete replaced file", log.String("path", h.Message), log.Err(err))
+		}
+	}
+}
+
+// subset returns true if every number in a is in b.
+func subset(a []int, b []int) bool {
+	for _, n := range a {
+		found := false
+		for _, m := range b {
+			found = found || n == m
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// record adds an imported entry to the history.
+func record(store *storage.Store, d *models.Download, item *models.MediaItem, season int, episodes []int, dst string) (*models.History, error) {
+	release := d.Release
+	if len(release) == 0 {
+		release = d.Name
+	}
+
+	return history.Record(store.History, models.History {
+		Type:       models.HistoryImported,
+		MediaId:    item.Id,
+		Title:      item.Title,
+		Release:    release,
+		Season:     season,
+		Episodes:   episodes,
+		Quality:    d.Quality,
+		Indexer:    d.Indexer,
+		DownloadId: d.Id,
+		Message:    dst,
+	})
+}
+
+// setError remembers why a download couldn't be imported.
+func setError(store *storage.Store, id string, err error) error {
+	log.Warn("importer: unable to import download", log.String("id", id), log.Err(err))
+	_, updateErr := downloads.Update(store, id, func(d *models.Download) {
+		d.ImportError = err.Error()
+	})
+	return updateErr
+}
+
+// complete returns true if a download has finished, whether or not it's
+// still seeding.
+func complete(d *models.Download) bool {
+	return d.Status == string(download.Completed) || d.Status == string(download.Seeding)
+}
+
+// location returns the file or folder holding a download's data. Torrent
+// clients report the folder the torrent was saved in, while usenet clients
+// report the job's own folder.
+func location(d *models.Download) string {
+	if len(d.Name) > 0 {
+		p := filepath.Join(d.Path, d.Name)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return d.Path
+}
+
+// media returns what the names of a download's files are built from.
+func media(d *models.Download, item *models.MediaItem, episodes []models.Episode) *naming.Media {
+	release := d.Release
+	if len(release) == 0 {
+		release = d.Name
+	}
+
+	return &naming.Media {
+		Details:  &item.Details,
+		Year:     item.Year,
+		Episodes: episodes,
+		Release:  release,
+		Quality:  d.Quality,
+	}
+}
@@ -0,0 +1,75 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/clients/download"
+	"github.com/MediaExchange/mex/clients/torznab"
+	"strings"
+	"time"
+)
+
+// configureIndexers registers each configured indexer.
+func configureIndexers(conf *MexConfig) error {
+	for _, i := range conf.Indexers {
+		if len(i.Name) == 0 || len(i.Url) == 0 {
+			return fmt.Errorf("indexer %q: name and url are required", i.Name)
+		}
+
+		var protocol download.Protocol
+		switch strings.ToLower(i.Type) {
+		case "torznab":
+			protocol = download.Torrent
+		case "newznab":
+			protocol = download.Usenet
+		default:
+			return fmt.Errorf("indexer %q: unknown type %q", i.Name, i.Type)
+		}
+
+		if torznab.Get(i.Name) != nil {
+			return fmt.Errorf("indexer %q: name is already in use", i.Name)
+		}
+		torznab.Register(torznab.New(i.Name, i.Url, i.ApiKey, string(protocol), i.Categories))
+		log.Info("Registered indexer", log.String("name", i.Name), log.String("type", i.Type))
+	}
+	return nil
+}
+
+// searchInterval returns how often wanted media is searched for, or 0 if
+// automatic searches are turned off.
+func searchInterval(conf *MexConfig) time.Duration {
+	switch {
+	case conf.Search.Interval < 0:
+		return 0
+	case conf.Search.Interval > 0:
+		return seconds(conf.Search.Interval)
+	}
+	return 6 * time.Hour
+}
+
+// rssInterval returns how often the indexers' RSS feeds are read, or 0 if
+// RSS sync is turned off.
+func rssInterval(conf *MexConfig) time.Duration {
+	switch {
+	case conf.Search.RssInterval < 0:
+		return 0
+	case conf.Search.RssInterval > 0:
+		return seconds(conf.Search.RssInterval)
+	}
+	return 15 * time.Minute
+}
@@ -0,0 +1,436 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package library manages the media MEX monitors: the movies and TV shows a
+// user has asked MEX to acquire, along with the state of each episode.
+package library
+
+import (
+	"errors"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/events"
+	"github.com/MediaExchange/mex/clients/tmdb"
+	"github.com/MediaExchange/mex/clients/tvdb"
+	"github.com/MediaExchange/mex/health"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/parser"
+	"github.com/MediaExchange/mex/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidId is returned when an ID is not in the format `provider:id`.
+	ErrInvalidId = errors.New("library: id must be in the form provider:id")
+
+	// ErrUnknownProvider is returned when an ID names a provider MEX doesn't support.
+	ErrUnknownProvider = errors.New("library: unknown provider")
+
+	// ErrUnavailable is returned when the provider is down or failed to log in.
+	ErrUnavailable = errors.New("library: provider is unavailable")
+
+	// ErrInvalidState is returned when a state is not wanted, downloaded or missing.
+	ErrInvalidState = errors.New("library: state must be wanted, downloaded or missing")
+
+	// ErrExists is returned when adding media that is already in the library.
+	ErrExists = errors.New("library: media is already in the library")
+)
+
+// Filter restricts the items returned by List. Zero values match everything.
+type Filter struct {
+	Type        *models.MediaType   // Only items of this type.
+	Monitored   *bool               // Only monitored or unmonitored items.
+	State       models.MediaState   // Only movies in this state, or TV shows with an episode in this state.
+	Title       string              // Only items whose title contains this text, ignoring case.
+}
+
+// ItemUpdate changes the settings of a library item.
+type ItemUpdate struct {
+	Monitored   *bool               `json:"monitored"`      // Whether MEX should acquire the media.
+	ProfileId   *uint64             `json:"profileId"`      // Quality profile, or 0 for the default profile.
+}
+
+// EpisodeUpdate changes the state of a single episode.
+type EpisodeUpdate struct {
+	Season      int                 `json:"season"`         // Season number.
+	Episode     int                 `json:"episode"`        // Episode number.
+	State       models.MediaState   `json:"state"`          // New state.
+}
+
+// ParseId splits an ID in the format `provider:id` into its parts.
+func ParseId(id string) (string, int, error) {
+	temp := strings.Split(id, ":")
+	if len(temp) != 2 {
+		return "", 0, ErrInvalidId
+	}
+
+	n, err := strconv.Atoi(temp[1])
+	if err != nil {
+		return "", 0, ErrInvalidId
+	}
+
+	return temp[0], n, nil
+}
+
+// Lookup retrieves the details of media from its provider.
+func Lookup(id string) (*models.Details, error) {
+	provider, n, err := ParseId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if provider != "tmdb" && provider != "tvdb" {
+		return nil, ErrUnknownProvider
+	}
+
+	if !health.Provider(provider).Available() {
+		return nil, ErrUnavailable
+	}
+
+	if provider == "tmdb" {
+		return tmdb.Details(n)
+	}
+	return tvdb.Details(n)
+}
+
+// Add looks up media by its `provider:id` and adds it to the library with a
+// quality profile, or 0 for the default profile.
+func Add(repo storage.MediaRepository, id string, monitored bool, profileId uint64) (*models.MediaItem, error) {
+	if _, err := repo.Get(id); err == nil {
+		return nil, ErrExists
+	} else if err != storage.ErrNotFound {
+		return nil, err
+	}
+
+	details, err := Lookup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	item := NewItem(details, monitored)
+	item.ProfileId = profileId
+	if err := repo.Save(item); err != nil {
+		log.Error("library.Add: unable to save item", log.String("id", id), log.Err(err))
+		return nil, err
+	}
+
+	log.Info("library.Add", log.String("id", item.Id), log.String("title", item.Title))
+	events.Publish(events.LibraryAdded, item)
+	return item, nil
+}
+
+// NewItem builds a library item from the provider's details. Movies and
+// episodes start out wanted when the item is monitored, except for specials
+// (season 0), which must be asked for explicitly.
+func NewItem(details *models.Details, monitored bool) *models.MediaItem {
+	now := time.Now()
+	item := &models.MediaItem {
+		Id:        details.Id,
+		Type:      details.Type,
+		Title:     details.Title,
+		Year:      Year(details.ReleaseDate),
+		Monitored: monitored,
+		Added:     now,
+		Updated:   now,
+	}
+
+	initial := models.Missing
+	if monitored {
+		initial = models.Wanted
+	}
+
+	if details.Type == models.Movie {
+		item.State = initial
+	}
+
+	item.Episodes = make([]models.LibraryEpisode, 0, len(details.Episodes))
+	for _, e := range details.Episodes {
+		state := initial
+		if e.Season == 0 {
+			state = models.Missing
+		}
+
+		item.Episodes = append(item.Episodes, models.LibraryEpisode {
+			Name:    e.Name,
+			Number:  e.Number,
+			Season:  e.Season,
+			Episode: e.Episode,
+			AirDate: e.AirDate,
+			State:   state,
+		})
+	}
+
+	// The episodes are tracked above, so they don't need to be stored twice.
+	item.Details = *details
+	item.Details.Episodes = nil
+
+	return item
+}
+
+// Update changes whether MEX should acquire an item and the quality profile
+// used to choose its releases. Fields left nil are unchanged. Monitoring a
+// TV show wants the episodes that aren't downloaded or unwanted, and
+// unmonitoring it stops wanting them.
+func Update(repo storage.MediaRepository, id string, update ItemUpdate) (*models.MediaItem, error) {
+	item, err := repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Monitored != nil {
+		monitored := *update.Monitored
+		if item.Type == models.TvShow && item.Monitored != monitored {
+			monitorEpisodes(item, monitored)
+		}
+		item.Monitored = monitored
+		if item.Type == models.Movie && item.State != models.Downloaded {
+			item.State = models.Missing
+			if monitored {
+				item.State = models.Wanted
+			}
+		}
+	}
+	if update.ProfileId != nil {
+		item.ProfileId = *update.ProfileId
+	}
+	item.Updated = time.Now()
+
+	if err := repo.Save(item); err != nil {
+		log.Error("library.Update: unable to save item", log.String("id", id), log.Err(err))
+		return nil, err
+	}
+	events.Publish(events.LibraryUpdated, item)
+	return item, nil
+}
+
+// monitorEpisodes wants the episodes of a show that is now monitored, as
+// NewItem does, or stops wanting them when it isn't. Downloaded episodes,
+// specials and episodes that were unwanted on purpose are left alone.
+func monitorEpisodes(item *models.MediaItem, monitored bool) {
+	from, to := models.Wanted, models.Missing
+	if monitored {
+		from, to = models.Missing, models.Wanted
+	}
+
+	for i := range item.Episodes {
+		e := &item.Episodes[i]
+		if e.Season != 0 && e.State == from && !e.Unwanted {
+			e.State = to
+		}
+	}
+}
+
+// SetEpisodes changes the state of episodes of a TV show.
+func SetEpisodes(repo storage.MediaRepository, id string, updates []EpisodeUpdate) (*models.MediaItem, error) {
+	item, err := repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range updates {
+		if !ValidState(u.State) {
+			return nil, ErrInvalidState
+		}
+
+		e := item.FindEpisode(u.Season, u.Episode)
+		if e == nil {
+			return nil, storage.ErrNotFound
+		}
+		e.State = u.State
+		e.Unwanted = u.State == models.Missing
+	}
+	item.Updated = time.Now()
+
+	if err := repo.Save(item); err != nil {
+		log.Error("library.SetEpisodes: unable to save item", log.String("id", id), log.Err(err))
+		return nil, err
+	}
+	events.Publish(events.LibraryUpdated, item)
+	return item, nil
+}
+
+// SetDownloaded marks a movie, or episodes of a season of a TV show, as
+// downloaded. Episodes the show doesn't have are ignored.
+func SetDownloaded(repo storage.MediaRepository, id string, season int, episodes []int) (*models.MediaItem, error) {
+	item, err := repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if item.Type == models.Movie {
+		item.State = models.Downloaded
+	}
+	for _, n := range episodes {
+		if e := item.FindEpisode(season, n); e != nil {
+			e.State = models.Downloaded
+			e.Unwanted = false
+		}
+	}
+	item.Updated = time.Now()
+
+	if err := repo.Save(item); err != nil {
+		log.Error("library.SetDownloaded: unable to save item", log.String("id", id), log.Err(err))
+		return nil, err
+	}
+	events.Publish(events.LibraryUpdated, item)
+	return item, nil
+}
+
+// SetMissing marks a movie, or episodes of a season of a TV show, as missing
+// after their files were deleted. Movies are unmonitored as well, or they
+// would be downloaded again, and the episodes stay missing if the show is
+// monitored again. Episodes the show doesn't have are ignored.
+func SetMissing(repo storage.MediaRepository, id string, season int, episodes []int) (*models.MediaItem, error) {
+	item, err := repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if item.Type == models.Movie {
+		item.State = models.Missing
+		item.Monitored = false
+	}
+	for _, n := range episodes {
+		if e := item.FindEpisode(season, n); e != nil {
+			e.State = models.Missing
+			e.Unwanted = true
+		}
+	}
+	item.Updated = time.Now()
+
+	if err := repo.Save(item); err != nil {
+		log.Error("library.SetMissing: unable to save item", log.String("id", id), log.Err(err))
+		return nil, err
+	}
+	events.Publish(events.LibraryUpdated, item)
+	return item, nil
+}
+
+// List returns the items in the library that match the filter.
+func List(repo storage.MediaRepository, filter Filter) ([]models.MediaItem, error) {
+	items, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	title := strings.ToLower(filter.Title)
+	matched := make([]models.MediaItem, 0, len(items))
+	for _, item := range items {
+		if filter.Type != nil && item.Type != *filter.Type {
+			continue
+		}
+		if filter.Monitored != nil && item.Monitored != *filter.Monitored {
+			continue
+		}
+		if len(title) > 0 && !strings.Contains(strings.ToLower(item.Title), title) {
+			continue
+		}
+		if len(filter.State) > 0 && !HasState(&item, filter.State) {
+			continue
+		}
+		matched = append(matched, item)
+	}
+
+	return matched, nil
+}
+
+// HasState returns true if a movie is in the state, or if any episode of a TV show is.
+func HasState(item *models.MediaItem, state models.MediaState) bool {
+	if item.Type == models.Movie {
+		return item.State == state
+	}
+
+	for _, e := range item.Episodes {
+		if e.State == state {
+			return true
+		}
+	}
+	return false
+}
+
+// Available returns true if a movie is downloaded, or if every aired
+// episode of a show that's wanted has been downloaded. Seasons limits a show
+// to those seasons; when it's empty every season counts.
+func Available(item *models.MediaItem, seasons []int) bool {
+	if item.Type == models.Movie {
+		return item.State == models.Downloaded
+	}
+
+	now := time.Now()
+	for _, e := range item.Episodes {
+		if len(seasons) > 0 && !contains(seasons, e.Season) {
+			continue
+		}
+		aired, err := time.Parse("2006-01-02", e.AirDate)
+		if err == nil && !aired.After(now) && e.State == models.Wanted {
+			return false
+		}
+	}
+	return true
+}
+
+// EpisodesOf returns the season and episodes of a show that a video or
+// release contains, matched by season and episode numbers, air date or
+// absolute episode number.
+func EpisodesOf(item *models.MediaItem, parsed parser.Result) (int, []int) {
+	season := 0
+	episodes := make([]int, 0)
+	for _, e := range item.Episodes {
+		numbered := len(parsed.Seasons) == 1 && parsed.Seasons[0] == e.Season && contains(parsed.Episodes, e.Episode)
+		dated := len(parsed.AirDate) > 0 && parsed.AirDate == e.AirDate
+		absolute := e.Number > 0 && contains(parsed.Absolute, e.Number)
+		if !numbered && !dated && !absolute {
+			continue
+		}
+
+		// Multi-episode files only span one season.
+		if len(episodes) > 0 && e.Season != season {
+			continue
+		}
+		season = e.Season
+		episodes = append(episodes, e.Episode)
+	}
+	return season, episodes
+}
+
+// ValidState returns true if state is one of the known media states.
+func ValidState(state models.MediaState) bool {
+	return state == models.Wanted || state == models.Downloaded || state == models.Missing
+}
+
+// Year returns the year from a date in the format YYYY-MM-DD, or 0.
+func Year(date string) int {
+	if len(date) < 4 {
+		return 0
+	}
+
+	y, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return 0
+	}
+	return y
+}
+
+// contains returns true if list has n.
+func contains(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
@@ -16,41 +16,140 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"github.com/MediaExchange/config"
 	"github.com/MediaExchange/log"
-	"github.com/MediaExchange/router"
+	"github.com/MediaExchange/mex/acquire"
 	"github.com/MediaExchange/mex/api"
-	"github.com/MediaExchange/mex/clients/tmdb"
-	"github.com/MediaExchange/mex/clients/tvdb"
+	"github.com/MediaExchange/mex/auth"
+	"github.com/MediaExchange/mex/events"
+	"github.com/MediaExchange/mex/health"
+	"github.com/MediaExchange/mex/plex"
+	"github.com/MediaExchange/mex/quality"
+	"github.com/MediaExchange/mex/scanner"
+	"github.com/MediaExchange/mex/services"
+	"github.com/MediaExchange/mex/storage"
 	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	configFile = "./mex_config.yaml"
 )
 
 func main() {
+	// `mex -healthcheck /healthz` lets the Docker HEALTHCHECK probe the running
+	// server without needing curl or wget in the container.
+	healthcheck := flag.String("healthcheck", "", "probe the local server at this path and exit")
+	flag.Parse()
+
+	if len(*healthcheck) > 0 {
+		if err := probe(*healthcheck); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if err := run(); err != nil {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+// run configures the application, serves HTTP requests until SIGINT or
+// SIGTERM is received, and then shuts everything down. Errors are logged
+// before they are returned.
+func run() error {
 	var err error
 
+	// Stop cleanly when interrupted or when `docker stop` sends SIGTERM.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
 	// Read the main configuration file.
 	conf := new(MexConfig)
-	err = config.FromFile("./mex_config.yaml", conf)
+	err = config.FromFile(configFile, conf)
 	if err != nil {
-		log.Error("Error reading ./mex_config.yaml", log.Err(err))
-		os.Exit(1)
+		log.Error("Error reading " + configFile, log.Err(err))
+		return err
 	}
+	health.SetConfigLoaded()
 
-	// Authenticate with TMDB
-	err = tmdb.Login(conf.Clients.TmdbApiKey)
+	// Open the database holding MEX state. It is closed after the background
+	// services have stopped using it.
+	store, err := storage.Open(conf.Storage.DataDir)
 	if err != nil {
-		log.Error("TMDB authentication error", log.Err(err))
-		os.Exit(1)
+		log.Error("Unable to open the database", log.Err(err))
+		return err
 	}
+	defer store.Close()
+	api.Store = store
 
-	// Authenticate with TVDB
-	err = tvdb.Login(conf.Clients.TvdbApiKey)
+	// Set up user accounts.
+	err = configureAuth(conf, store)
 	if err != nil {
-		log.Error("TVDB authentication error", log.Err(err))
-		os.Exit(1)
+		return err
+	}
+	err = configurePlex(conf, store)
+	if err != nil {
+		return err
+	}
+	_ = services.Register(services.NewTicker("session expiry", time.Hour, expireSessions(store)))
+	err = quality.CreateDefaults(store.Profiles)
+	if err != nil {
+		return err
+	}
+
+	// Authenticate with the media providers. Failures leave MEX running in a
+	// degraded mode without that provider.
+	providers := newProviders(conf)
+	loginProviders(providers)
+
+	err = configureDownloadClients(conf)
+	if err != nil {
+		return err
+	}
+	err = configureIndexers(conf)
+	if err != nil {
+		return err
+	}
+	err = configureImport(conf)
+	if err != nil {
+		return err
+	}
+	if interval := scanInterval(conf); interval > 0 {
+		_ = services.Register(services.NewTicker("library scan", interval, scanner.Run(store)))
+	}
+	_ = services.Register(services.NewTicker("download poller", pollInterval(conf), pollDownloads(store)))
+	_ = services.Register(services.NewTicker("failed download search", time.Minute, acquire.Replace(store)))
+	if interval := searchInterval(conf); interval > 0 {
+		_ = services.Register(services.NewTicker("automatic search", interval, acquire.Run(store)))
+	}
+	if interval := rssInterval(conf); interval > 0 {
+		_ = services.Register(services.NewTicker("rss sync", interval, acquire.Sync(store)))
+	}
+
+	if interval := plexSyncInterval(conf); interval > 0 {
+		_ = services.Register(services.NewTicker("plex sync", interval, plex.Run(store)))
+	}
+	if plex.Cleanup.DeleteMovies || plex.Cleanup.DeleteEpisodes {
+		_ = services.Register(services.NewTicker("plex cleanup", time.Hour, plex.Clean(store)))
+	}
+
+	// Periodically verify that the providers are still reachable.
+	_ = services.Register(services.NewTicker("provider health check", checkInterval(conf), checkProviders(providers)))
+
+	// Background work starts once the configuration is known to be good.
+	err = services.Start()
+	if err != nil {
+		log.Error("Unable to start background services", log.Err(err))
+		return err
 	}
 
 	port := conf.Server.Port
@@ -58,27 +157,49 @@ func main() {
 	log.Info("Starting HTTP server", log.Int16("port", port))
 
 	// Configure the router
-	handler := router.NewRouter().
-		AddRoute("GET", "/api/details", api.GetDetails).
-		AddRoute("GET", "/api/proxy",   api.Proxy).
-		AddRoute("GET", "/api/search",  api.Search).
-		AddRoute("GET", "/.*",          FileServer)
+	handler := api.Cors(conf.Server.CorsOrigins, auth.Authenticate(store, newRouter(conf)))
+
+	server := &http.Server {
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  seconds(conf.Server.ReadTimeout),
+		WriteTimeout: seconds(conf.Server.WriteTimeout),
+		IdleTimeout:  seconds(conf.Server.IdleTimeout),
+	}
+
+	// Event streams end before the write timeout would cut them off, and
+	// when the server shuts down.
+	if conf.Server.WriteTimeout > 0 {
+		api.StreamDuration = seconds(conf.Server.WriteTimeout) * 9 / 10
+	}
+	server.RegisterOnShutdown(events.Close)
 
 	// Start the HTTP server
-	err = http.ListenAndServe(addr, handler)
-	if err != nil {
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
 		log.Error("Fatal HTTP server error", log.Err(err))
-		os.Exit(1)
+	case <-ctx.Done():
+		log.Info("Shutting down")
 	}
 
-	os.Exit(0)
-}
+	// Give in-flight requests and background services a chance to finish.
+	drain, cancelDrain := context.WithTimeout(context.Background(), seconds(conf.Server.ShutdownTimeout))
+	defer cancelDrain()
 
-// FileServer serves static files from a directory.
-func FileServer(writer http.ResponseWriter, request *http.Request) {
-	// http.ServeFile doesn't support the concept of a base path to serve from.
-	path := filepath.Join("ui/dist/mex", request.URL.Path)
+	if shutdownErr := server.Shutdown(drain); shutdownErr != nil {
+		log.Error("HTTP server did not shut down cleanly", log.Err(shutdownErr))
+	}
+	services.Stop(drain)
+
+	return err
+}
 
-	// Serve the file requested.
-	http.ServeFile(writer, request, path)
+// seconds converts a configured number of seconds to a time.Duration.
+func seconds(s int) time.Duration {
+	return time.Duration(s) * time.Second
 }
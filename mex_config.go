@@ -17,10 +17,86 @@ package main
 
 type MexConfig struct {
 	Server struct {
-		Port int16 `env:"PORT"`
+		Port            int16  `env:"PORT"`
+		UiDir           string `json:"ui_dir" env:"MEX_UI_DIR"`
+		ReadTimeout     int    `json:"read_timeout"`      // Seconds allowed to read a request.
+		WriteTimeout    int    `json:"write_timeout"`     // Seconds allowed to write a response.
+		IdleTimeout     int    `json:"idle_timeout"`      // Seconds a keep-alive connection may sit idle.
+		ShutdownTimeout int    `json:"shutdown_timeout"`  // Seconds in-flight requests have to finish on shutdown.
+		CorsOrigins     []string `json:"cors_origins"`    // Other origins allowed to call the API, e.g. the Angular dev server.
+	}
+	Auth struct {
+		SessionDays   int    `json:"session_days"`                             // Days a login lasts.
+		SecureCookies bool   `json:"secure_cookies" env:"MEX_SECURE_COOKIES"`  // Only send the session cookie over HTTPS.
+		AdminUsername string `json:"admin_username" env:"MEX_ADMIN_USERNAME"`  // First admin, created if no users exist.
+		AdminPassword string `json:"admin_password" env:"MEX_ADMIN_PASSWORD"`
+	}
+	Storage struct {
+		DataDir string `json:"data_dir" env:"MEX_DATA_DIR"`
+	}
+	Plex struct {
+		BaseUrl     string `json:"base_url"`                        // plex.tv API, changed only for testing.
+		AppUrl      string `json:"app_url"`                         // Plex web app where users sign in.
+		ServerId    string `json:"server_id" env:"PLEX_SERVER_ID"`  // Machine identifier of the Plex Media Server.
+		DefaultRole string `json:"default_role"`                    // Role given to new Plex users.
+		ServerUrl   string `json:"server_url" env:"PLEX_SERVER_URL"`  // Plex Media Server MEX tells about imports and reads libraries from.
+		Token       string `json:"token" env:"PLEX_TOKEN"`            // X-Plex-Token of the server's owner.
+		SyncInterval int   `json:"sync_interval"`                   // Seconds between reads of the Plex libraries, or -1 to turn them off.
+		WebhookSecret string `json:"webhook_secret" env:"PLEX_WEBHOOK_SECRET"`  // Must be sent as the `secret` query parameter of Plex webhooks.
+		Cleanup struct {
+			DeleteMovies      bool `json:"delete_movies"`        // Delete the files of movies once they're watched.
+			DeleteEpisodes    bool `json:"delete_episodes"`      // Delete the files of episodes once they're watched.
+			WaitForRequesters bool `json:"wait_for_requesters"`  // Wait until everyone who requested the media has watched it.
+			Delay             int  `json:"delay"`                // Seconds after media is watched before its files are deleted.
+		}
+	}
+	DownloadClients []DownloadClientConfig `json:"download_clients"`
+	Indexers []IndexerConfig `json:"indexers"`
+	Downloads struct {
+		PollInterval int    `json:"poll_interval"`  // Seconds between refreshes of the download queue.
+		KeepDays     int    `json:"keep_days"`      // Days to list downloads after they leave their client.
+		Category     string `json:"category"`       // Label or category given to releases MEX grabs.
+	}
+	Import struct {
+		MoviesDir string `json:"movies_dir" env:"MEX_MOVIES_DIR"`  // Folder Plex watches for movies.
+		TvDir     string `json:"tv_dir" env:"MEX_TV_DIR"`          // Folder Plex watches for TV shows.
+		Mode      string `json:"mode"`                             // How videos are placed in the folders: move, copy or hardlink.
+	}
+	Naming struct {
+		Movie             string `json:"movie"`                // Template for the path of a movie, e.g. {Movie TitleYear}/{Movie TitleYear}.
+		Episode           string `json:"episode"`              // Template for the path of an episode.
+		MultiEpisodeStyle string `json:"multi_episode_style"`  // extend, repeat, scene, range or prefixed_range.
+	}
+	Scan struct {
+		Interval int  `json:"interval"`  // Seconds between scans of the import folders, or -1 to only scan when asked.
+		Monitor  bool `json:"monitor"`   // Monitor media the scan adds to the library.
+	}
+	Search struct {
+		Interval    int `json:"interval"`      // Seconds between automatic searches for wanted media, or -1 to turn them off.
+		RssInterval int `json:"rss_interval"`  // Seconds between reads of the indexers' RSS feeds, or -1 to turn them off.
 	}
 	Clients struct {
-		TmdbApiKey string `json:"tmdb_api_key" env:"TMDB_API_KEY"`
-		TvdbApiKey string `json:"tvdb_api_key" env:"TVDB_API_KEY"`
+		TmdbApiKey    string `json:"tmdb_api_key" env:"TMDB_API_KEY"`
+		TvdbApiKey    string `json:"tvdb_api_key" env:"TVDB_API_KEY"`
+		CheckInterval int    `json:"check_interval"`  // Seconds between provider health checks.
 	}
 }
+
+// IndexerConfig describes one Torznab or Newznab indexer.
+type IndexerConfig struct {
+	Name       string `json:"name"`        // Unique name shown in the UI.
+	Type       string `json:"type"`        // torznab for torrents or newznab for usenet.
+	Url        string `json:"url"`         // Address of the indexer's API.
+	ApiKey     string `json:"api_key"`
+	Categories []int  `json:"categories"`  // Newznab categories to search, or empty for the standard movie and TV categories.
+}
+
+// DownloadClientConfig describes one torrent or usenet client.
+type DownloadClientConfig struct {
+	Name     string `json:"name"`      // Unique name shown in the UI.
+	Type     string `json:"type"`      // Client implementation, e.g. transmission.
+	Url      string `json:"url"`       // Address of the client's API.
+	Username string `json:"username"`
+	Password string `json:"password"`
+	ApiKey   string `json:"api_key"`   // For clients that use an API key instead of a password.
+}
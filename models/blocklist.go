@@ -0,0 +1,35 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package models
+
+import "time"
+
+// BlocklistEntry is a release that MEX won't grab again, usually because
+// its download failed or contained no video.
+type BlocklistEntry struct {
+	Id          uint64      `json:"id"`                     // Unique ID of the entry.
+	MediaId     string      `json:"mediaId"`                // ID of the library item the release was grabbed for.
+	Title       string      `json:"title"`                  // Name of the media.
+	Release     string      `json:"release"`                // Name of the release.
+	InfoHash    string      `json:"infoHash,omitempty"`     // Torrent info hash, if known.
+	Indexer     string      `json:"indexer,omitempty"`      // Indexer the release came from.
+	Protocol    string      `json:"protocol"`               // torrent or usenet.
+	Season      int         `json:"season,omitempty"`       // Season of a TV release.
+	Episodes    []int       `json:"episodes,omitempty"`     // Episodes of the season in the release. Empty for movies.
+	Quality     string      `json:"quality,omitempty"`      // Quality of the release, e.g. WEBDL-1080p.
+	Reason      string      `json:"reason"`                 // Why the release was blocklisted.
+	Date        time.Time   `json:"date"`                   // When the release was blocklisted.
+}
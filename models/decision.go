@@ -0,0 +1,35 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package models
+
+import "github.com/MediaExchange/mex/parser"
+
+// Decision is the verdict of a quality profile on one release.
+type Decision struct {
+	Release     Release             `json:"release"`        // Release that was considered.
+	Parsed      parser.Result       `json:"parsed"`         // What was read from the release name.
+	Quality     string              `json:"quality"`        // Quality of the release, e.g. WEBDL-1080p.
+	Score       int                 `json:"score"`          // Total score of the preferred words in the release name.
+	Accepted    bool                `json:"accepted"`       // True if MEX would download the release.
+	Rejections  []string            `json:"rejections"`     // Why the release was rejected, if it was.
+}
+
+// DecisionResponse is the result of searching every indexer and deciding on each release.
+type DecisionResponse struct {
+	Profile     QualityProfile      `json:"profile"`        // Profile the releases were judged by.
+	Decisions   []Decision          `json:"decisions"`      // Accepted releases first, best first.
+	Indexers    []ProviderState     `json:"indexers"`       // Whether each indexer contributed to the results.
+}
@@ -6,6 +6,7 @@ type Details struct {
 	Type        MediaType   `json:"type"`           // Type of media.
 	Adult       bool        `json:"adult"`          // True if the media is for adults.
 	Links       []Link      `json:"links"`          // Links to external information about the media.
+	ImdbId      string      `json:"imdbId"`         // ID of the media in IMDB, e.g. tt0944947, if known.
 	Title       string      `json:"title"`          // Name of the media found.
 	Status      string      `json:"status"`         // Current status of the media (released, in production, etc.)
 	Runtime     int         `json:"runtime"`        // Runtime of the media in minutes.
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Download is a transfer being handled by a download client.
+type Download struct {
+	Id              string      `json:"id"`                    // Unique ID in the format `client:id`.
+	Client          string      `json:"client"`                // Name of the download client handling the transfer.
+	DownloadId      string      `json:"downloadId"`            // ID assigned by the download client.
+	Protocol        string      `json:"protocol"`              // torrent or usenet.
+	MediaId         string      `json:"mediaId"`               // ID of the library item being downloaded, if known.
+	Name            string      `json:"name"`                  // Name of the release being downloaded.
+	Url             string      `json:"url,omitempty"`         // Where the release came from, used to retry it.
+	Season          int         `json:"season,omitempty"`      // Season of a TV release grabbed by MEX.
+	Episodes        []int       `json:"episodes,omitempty"`    // Episodes of the season in the release. Empty for movies and season packs still to be matched.
+	Quality         string      `json:"quality,omitempty"`     // Quality of a release grabbed by MEX, e.g. WEBDL-1080p.
+	Indexer         string      `json:"indexer,omitempty"`     // Indexer the release came from.
+	Release         string      `json:"release,omitempty"`     // Name of a release grabbed by MEX, which the client may change.
+	InfoHash        string      `json:"infoHash,omitempty"`    // Torrent info hash of a release grabbed by MEX, if known.
+	Blocklisted     bool        `json:"blocklisted,omitempty"` // True once a failed release has been blocklisted.
+	Imported        bool        `json:"imported,omitempty"`    // True once the videos have been placed in the library.
+	ImportError     string      `json:"importError,omitempty"` // Why the download couldn't be imported, if it couldn't.
+	Status          string      `json:"status"`                // Normalized state reported by the download client.
+	Progress        float64     `json:"progress"`              // Fraction complete, from 0 to 1.
+	Size            int64       `json:"size"`                  // Total size in bytes.
+	Downloaded      int64       `json:"downloaded"`            // Bytes downloaded so far.
+	DownloadSpeed   int64       `json:"downloadSpeed"`         // Bytes per second.
+	UploadSpeed     int64       `json:"uploadSpeed"`           // Bytes per second.
+	Eta             int64       `json:"eta"`                   // Seconds until complete, or -1 if unknown.
+	Path            string      `json:"path"`                  // Directory the release is downloaded into.
+	Error           string      `json:"error,omitempty"`       // Why the download failed, if it did.
+	Added           time.Time   `json:"added"`                 // When the download was added.
+	Updated         time.Time   `json:"updated"`               // When the download client last reported the download.
+}
+
+// Public returns a copy of the download that can be shown to users. Url often
+// contains an indexer API key and is only needed to send the release again.
+func (d Download) Public() Download {
+	d.Url = ""
+	return d
+}
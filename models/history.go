@@ -0,0 +1,45 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package models
+
+import "time"
+
+// HistoryType is what happened to a release.
+type HistoryType string
+
+// Defines the kinds of history entries.
+const (
+	HistoryGrabbed  HistoryType = "grabbed"     // A release was sent to a download client.
+	HistoryFailed   HistoryType = "failed"      // A download failed and the release was blocklisted.
+	HistoryImported HistoryType = "imported"    // A video from a download was placed in the library.
+	HistoryDeleted  HistoryType = "deleted"     // A watched video was deleted by a cleanup rule.
+)
+
+// History records something MEX did with a release of some media.
+type History struct {
+	Id          uint64      `json:"id"`                     // Unique ID of the entry.
+	Type        HistoryType `json:"type"`                   // What happened.
+	MediaId     string      `json:"mediaId"`                // ID of the library item in the format `provider:id`.
+	Title       string      `json:"title"`                  // Name of the media.
+	Release     string      `json:"release"`                // Name of the release.
+	Season      int         `json:"season,omitempty"`       // Season of a TV release.
+	Episodes    []int       `json:"episodes,omitempty"`     // Episodes of the season in the release. Empty for movies.
+	Quality     string      `json:"quality"`                // Quality of the release, e.g. WEBDL-1080p.
+	Indexer     string      `json:"indexer,omitempty"`      // Indexer the release came from.
+	DownloadId  string      `json:"downloadId,omitempty"`   // ID of the download in the format `client:id`.
+	Message     string      `json:"message,omitempty"`      // More about what happened.
+	Date        time.Time   `json:"date"`                   // When it happened.
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// MediaState describes whether a movie or episode is on disk.
+type MediaState string
+
+// Defines the states of a movie or episode in the library.
+const (
+	Wanted     MediaState = "wanted"        // Not on disk and MEX should acquire it.
+	Downloaded MediaState = "downloaded"    // On disk.
+	Missing    MediaState = "missing"       // Not on disk and MEX is not looking for it.
+)
+
+// MediaItem is a movie or TV show that MEX keeps in its library.
+type MediaItem struct {
+	Id          string              `json:"id"`             // ID of the media in the format `provider:id`.
+	Type        MediaType           `json:"type"`           // Type of media.
+	Title       string              `json:"title"`          // Name of the media.
+	Year        int                 `json:"year"`           // Year the media was released or first aired.
+	Monitored   bool                `json:"monitored"`      // True if MEX should acquire the media.
+	ProfileId   uint64              `json:"profileId"`      // Quality profile used to choose releases, or 0 for the default profile.
+	State       MediaState          `json:"state"`          // State of a movie. Not used for TV shows.
+	Episodes    []LibraryEpisode    `json:"episodes"`       // State of each episode of a TV show.
+	Details     Details             `json:"details"`        // Details from the provider when the item was added, without episodes.
+	Added       time.Time           `json:"added"`          // When the item was added to the library.
+	Updated     time.Time           `json:"updated"`        // When the item was last changed.
+}
+
+// LibraryEpisode tracks a single episode of a TV show in the library.
+type LibraryEpisode struct {
+	Name        string              `json:"name"`               // Episode name.
+	Number      int                 `json:"number"`             // Absolute (overall) episode number across all seasons.
+	Season      int                 `json:"season"`             // Season number.
+	Episode     int                 `json:"episode"`            // Episode number.
+	AirDate     string              `json:"airDate"`            // Date the episode first aired.
+	State       MediaState          `json:"state"`              // Whether the episode is on disk or wanted.
+	Unwanted    bool                `json:"unwanted,omitempty"` // Set missing by a user or cleanup, so monitoring the show doesn't want it again.
+}
+
+// FindEpisode returns the episode with the season and episode number, or nil.
+func (m *MediaItem) FindEpisode(season int, episode int) *LibraryEpisode {
+	for i := range m.Episodes {
+		if m.Episodes[i].Season == season && m.Episodes[i].Episode == episode {
+			return &m.Episodes[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// RequestStatus is the state of a media request.
+type RequestStatus string
+
+// Defines the states a media request moves through.
+const (
+	RequestPending   RequestStatus = "pending"      // Waiting for an admin.
+	RequestApproved  RequestStatus = "approved"     // Added to the library to be acquired.
+	RequestDenied    RequestStatus = "denied"       // Will not be acquired.
+	RequestAvailable RequestStatus = "available"    // Acquired and available in Plex.
+)
+
+// MediaRequest is a request from one or more users for MEX to acquire media.
+type MediaRequest struct {
+	Id          uint64              `json:"id"`             // Unique ID of the request.
+	MediaId     string              `json:"mediaId"`        // ID of the requested media in the format `provider:id`.
+	Type        MediaType           `json:"type"`           // Type of media requested.
+	Title       string              `json:"title"`          // Name of the requested media.
+	PosterUri   string              `json:"posterUri"`      // URI of the poster image to display.
+	Seasons     []int               `json:"seasons"`        // Seasons of a TV show requested. Empty for a movie or a whole series.
+	RequestedBy []string            `json:"requestedBy"`    // Users who asked for the media.
+	Status      RequestStatus       `json:"status"`         // Current state of the request.
+	Comments    []RequestComment    `json:"comments"`       // Notes left when the request was approved or denied.
+	Created     time.Time           `json:"created"`        // When the request was made.
+	Updated     time.Time           `json:"updated"`        // When the request last changed.
+}
+
+// RequestComment is a note left on a request.
+type RequestComment struct {
+	Author      string              `json:"author"`         // User who wrote the comment.
+	Text        string              `json:"text"`           // The comment.
+	Created     time.Time           `json:"created"`        // When the comment was written.
+}
+
+// Open returns true if the request is still waiting to be fulfilled.
+func (r *MediaRequest) Open() bool {
+	return r.Status == RequestPending || r.Status == RequestApproved
+}
@@ -0,0 +1,36 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package models
+
+// QualityProfile decides which releases of a library item MEX accepts and
+// which it prefers.
+type QualityProfile struct {
+	Id          uint64              `json:"id"`             // Unique ID of the profile.
+	Name        string              `json:"name"`           // Unique name shown in the UI.
+	Qualities   []string            `json:"qualities"`      // Allowed qualities, best first.
+	Cutoff      string              `json:"cutoff"`         // Once a copy of this quality or better is downloaded, MEX stops upgrading.
+	Preferred   []PreferredWord     `json:"preferred"`      // Words that make a release more or less attractive.
+	Forbidden   []string            `json:"forbidden"`      // Words that reject a release.
+	MinSize     float64             `json:"minSize"`        // Smallest acceptable size in MB per minute of runtime, or 0 for no limit.
+	MaxSize     float64             `json:"maxSize"`        // Largest acceptable size in MB per minute of runtime, or 0 for no limit.
+}
+
+// PreferredWord adds its score to releases with the word in their name.
+// Negative scores make releases less attractive without rejecting them.
+type PreferredWord struct {
+	Word        string              `json:"word"`           // Word or words to look for, ignoring case.
+	Score       int                 `json:"score"`          // Added to the score of a matching release.
+}
@@ -0,0 +1,46 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package models
+
+import "time"
+
+// Release is a copy of some media offered by an indexer.
+type Release struct {
+	Guid        string      `json:"guid"`           // Unique ID of the release at the indexer.
+	Title       string      `json:"title"`          // Release name, e.g. Show.Name.S01E02.1080p.WEB.h264-GROUP.
+	Indexer     string      `json:"indexer"`        // Name of the indexer that found the release.
+	Protocol    string      `json:"protocol"`       // torrent or usenet.
+	DownloadUrl string      `json:"downloadUrl"`    // URL of the .torrent or .nzb file.
+	MagnetUrl   string      `json:"magnetUrl"`      // Magnet link, for torrents that have one.
+	InfoUrl     string      `json:"infoUrl"`        // Page describing the release at the indexer.
+	InfoHash    string      `json:"infoHash"`       // Torrent info hash, if known.
+	Size        int64       `json:"size"`           // Size in bytes.
+	Seeders     int         `json:"seeders"`        // Peers with the whole torrent, or -1 if unknown.
+	Leechers    int         `json:"leechers"`       // Peers still downloading, or -1 if unknown.
+	Grabs       int         `json:"grabs"`          // Times the release was downloaded, or -1 if unknown.
+	Categories  []int       `json:"categories"`     // Newznab category IDs.
+	ImdbId      string      `json:"imdbId"`         // IMDB ID the indexer matched, if any.
+	TvdbId      int         `json:"tvdbId"`         // TVDB ID the indexer matched, if any.
+	Season      int         `json:"season"`         // Season the indexer matched, if any.
+	Episode     int         `json:"episode"`        // Episode the indexer matched, if any.
+	Published   time.Time   `json:"published"`      // When the release was posted.
+}
+
+// ReleaseResponse is the result of searching every indexer.
+type ReleaseResponse struct {
+	Releases    []Release        `json:"releases"`       // Releases from every indexer that answered.
+	Indexers    []ProviderState  `json:"indexers"`       // Whether each indexer contributed to the results.
+}
@@ -0,0 +1,53 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package models
+
+import "time"
+
+// ScanStatus is how far a scanned folder got to being matched with media.
+type ScanStatus string
+
+// Defines the states of a scanned folder.
+const (
+	ScanMatched ScanStatus = "matched"     // The folder belongs to a library item.
+	ScanPending ScanStatus = "pending"     // No match was certain enough, so someone must choose one.
+	ScanIgnored ScanStatus = "ignored"     // The folder is left out of the library on purpose.
+)
+
+// ScanCandidate is media a scanned folder might hold.
+type ScanCandidate struct {
+	Id          string      `json:"id"`                     // ID of the media in the format `provider:id`.
+	Title       string      `json:"title"`                  // Name of the media.
+	Year        int         `json:"year,omitempty"`         // Year the media was released or first aired.
+	Score       float64     `json:"score"`                  // Confidence in the match, from 0 to 1.
+}
+
+// ScanEntry is a folder, or a single video, found in a library root folder
+// by the scanner.
+type ScanEntry struct {
+	Id          uint64          `json:"id"`                 // Unique ID of the entry.
+	Path        string          `json:"path"`               // Full path of the folder or video.
+	Type        MediaType       `json:"type"`               // Type of media in the root folder.
+	Title       string          `json:"title"`              // Title parsed from the name.
+	Year        int             `json:"year,omitempty"`     // Year parsed from the name.
+	Status      ScanStatus      `json:"status"`             // Whether the folder has been matched.
+	MediaId     string          `json:"mediaId,omitempty"`  // ID of the library item the folder belongs to.
+	Score       float64         `json:"score,omitempty"`    // Confidence in the match. 1 when chosen by hand.
+	Candidates  []ScanCandidate `json:"candidates"`         // Best matches, highest score first, when the folder is pending.
+	Files       int             `json:"files"`              // Number of videos found.
+	Episodes    int             `json:"episodes,omitempty"` // Number of episodes the videos contain.
+	Scanned     time.Time       `json:"scanned"`            // When the folder was last scanned.
+}
@@ -10,3 +10,17 @@ type SearchResult struct {
 	PosterUri   string      `json:"posterUri"`      // URI of an image that can be displayed.
 	ReleaseDate string      `json:"releaseDate"`    // When the media first aired on TV or was released in theaters.
 }
+
+// SearchResponse is returned by the search API. It contains the combined
+// results and the state of each provider that was searched.
+type SearchResponse struct {
+	Results     []SearchResult   `json:"results"`        // Results from every available provider.
+	Providers   []ProviderState  `json:"providers"`      // Whether each provider contributed to the results.
+}
+
+// ProviderState reports whether a provider was used to answer a request.
+type ProviderState struct {
+	Name        string      `json:"name"`           // Provider name, e.g. "tmdb".
+	Available   bool        `json:"available"`      // False if the provider was skipped or failed.
+	Error       string      `json:"error"`          // Why the provider was unavailable.
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Role controls what a user is allowed to do.
+type Role string
+
+// Defines the roles, from least to most privileged.
+const (
+	Viewer    Role = "viewer"       // Can search and browse the library and requests.
+	Requester Role = "requester"    // Can also request media.
+	Admin     Role = "admin"        // Can do everything, including managing users.
+)
+
+// User is a MEX account. Passwords are stored separately and never returned.
+type User struct {
+	Username    string      `json:"username"`       // Unique login name.
+	Role        Role        `json:"role"`           // What the user is allowed to do.
+	PlexId      int64       `json:"plexId"`         // ID of the linked Plex account, or 0.
+	Email       string      `json:"email"`          // Email address, if known.
+	Created     time.Time   `json:"created"`        // When the account was created.
+	LastLogin   time.Time   `json:"lastLogin"`      // When the user last logged in.
+}
+
+// Session is a logged in browser, identified by a cookie.
+type Session struct {
+	Username    string      `json:"username"`       // User who logged in.
+	Created     time.Time   `json:"created"`        // When the user logged in.
+	Expires     time.Time   `json:"expires"`        // When the session stops working.
+}
+
+// ApiToken lets scripts and other applications call the API as a user.
+type ApiToken struct {
+	Id          string      `json:"id"`             // Identifies the token. This is not the token itself.
+	Name        string      `json:"name"`           // Description given when the token was created.
+	Username    string      `json:"username"`       // User the token acts as.
+	Created     time.Time   `json:"created"`        // When the token was created.
+	LastUsed    time.Time   `json:"lastUsed"`       // When the token was last used.
+}
@@ -0,0 +1,41 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package models
+
+import "time"
+
+// WatchAction is what a user did with a movie or episode in Plex.
+type WatchAction string
+
+// Defines the kinds of watch history entries.
+const (
+	WatchStarted  WatchAction = "started"     // The user started playing the media.
+	WatchFinished WatchAction = "finished"    // The user watched the media to the end.
+)
+
+// Watch records a user playing a movie or episode in Plex.
+type Watch struct {
+	Id          uint64      `json:"id"`                     // Unique ID of the entry.
+	Action      WatchAction `json:"action"`                 // What the user did.
+	User        string      `json:"user"`                   // MEX user linked to the Plex account, or the Plex username.
+	PlexUser    string      `json:"plexUser"`               // Name of the Plex account.
+	MediaId     string      `json:"mediaId,omitempty"`      // ID of the library item, if the media is in the library.
+	Title       string      `json:"title"`                  // Name of the movie or show.
+	Season      int         `json:"season,omitempty"`       // Season of an episode.
+	Episode     int         `json:"episode,omitempty"`      // Episode number of an episode.
+	Player      string      `json:"player,omitempty"`       // Device the media was played on.
+	Date        time.Time   `json:"date"`                   // When it happened.
+}
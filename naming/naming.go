@@ -0,0 +1,469 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package naming builds the paths of imported files from templates such as
+//
+//     {Series TitleYear}/Season {season:00}/{Series TitleYear} - s{season:00}e{episode:00} - {Episode Title}
+//
+// Tokens in braces are replaced with details of the media, episode and
+// release. Token names ignore case and spaces. Numbers take a padding
+// format, e.g. {season:00}. Writing a token's words with dots or
+// underscores, e.g. {Series.Title}, puts the same separator between the
+// words of its value. Values are stripped of characters that file systems
+// don't allow, and each `/` in a template starts a folder.
+package naming
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MediaExchange/mex/library"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/parser"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Multi-episode styles, showing how episodes 1 to 3 are written by
+// S{season:00}E{episode:00}.
+const (
+	Extend        = "extend"            // S01E01-02-03
+	Repeat        = "repeat"            // S01E01E02E03
+	Scene         = "scene"             // S01E01-E02-E03
+	Range         = "range"             // S01E01-03
+	PrefixedRange = "prefixed_range"    // S01E01-E03
+)
+
+var (
+	// ErrEmptyTemplate is returned when a template is missing.
+	ErrEmptyTemplate = errors.New("naming: templates must not be empty")
+
+	// ErrUnknownToken is returned when a template uses a token that doesn't exist.
+	ErrUnknownToken = errors.New("naming: unknown token")
+
+	// ErrInvalidToken is returned when a token is badly formed, such as a missing closing brace or bad number format.
+	ErrInvalidToken = errors.New("naming: invalid token")
+
+	// ErrInvalidPath is returned when a template is an absolute path or leaves the library folder.
+	ErrInvalidPath = errors.New("naming: templates must be relative paths inside the library folder")
+
+	// ErrNoEpisode is returned when an episode template doesn't tell episodes apart.
+	ErrNoEpisode = errors.New("naming: episode template must use {episode}, {absolute} or {air date}")
+
+	// ErrInvalidStyle is returned for an unknown multi-episode style.
+	ErrInvalidStyle = errors.New("naming: unknown multi-episode style")
+
+	// ErrEmptyName is returned when a template renders an empty file or folder name.
+	ErrEmptyName = errors.New("naming: template gives an empty file or folder name")
+)
+
+// Format holds the templates used to name imported files. Templates don't
+// include the file extension.
+type Format struct {
+	Movie             string    `json:"movie"`              // Path of a movie, relative to the movies folder.
+	Episode           string    `json:"episode"`            // Path of an episode, relative to the TV folder.
+	MultiEpisodeStyle string    `json:"multiEpisodeStyle"`  // How files with several episodes are numbered.
+}
+
+// Media is what a name is built from.
+type Media struct {
+	Details     *models.Details     // The movie or show.
+	Year        int                 // Year of release, or 0 to use the release date in the details.
+	Episodes    []models.Episode    // Episodes in the file, all from one season. Empty for movies.
+	Release     string              // Name of the release the file came from.
+	Quality     string              // Quality of the release, e.g. WEBDL-1080p.
+}
+
+// Default lays out the library the way Plex recommends.
+var Default = Format {
+	Movie:             "{Movie TitleYear}/{Movie TitleYear}",
+	Episode:           "{Series TitleYear}/Season {season:00}/{Series TitleYear} - s{season:00}e{episode:00} - {Episode Title}",
+	MultiEpisodeStyle: PrefixedRange,
+}
+
+// Current is the format used to import files.
+var Current = Default
+
+// token is a piece of a template: literal text, or a token to replace.
+type token struct {
+	text    string  // Literal text, or the token's name without separators, in lower case.
+	literal bool
+	format  string  // Padding of numbers, e.g. 00.
+	sep     string  // Separator between the words of the value.
+	prefix  string  // Letter before an episode token, repeated by some multi-episode styles.
+}
+
+// value returns the text of a token for some media.
+type value func(m *Media, t *token, style string) string
+
+// Tokens and their values.
+var values = map[string]value {
+	"title":           title,
+	"movietitle":      title,
+	"seriestitle":     title,
+	"titleyear":       titleYear,
+	"movietitleyear":  titleYear,
+	"seriestitleyear": titleYear,
+	"year":            func(m *Media, t *token, style string) string { return number(year(m), t.format) },
+	"season":          season,
+	"episode":         episodes(func(e models.Episode) int { return e.Episode }),
+	"absolute":        episodes(func(e models.Episode) int { return e.Number }),
+	"episodetitle":    episodeTitle,
+	"airdate":         airDate,
+	"quality":         func(m *Media, t *token, style string) string { return m.Quality },
+	"releasetitle":    func(m *Media, t *token, style string) string { return m.Release },
+	"releasegroup":    func(m *Media, t *token, style string) string { return parser.Parse(m.Release).Group },
+	"resolution":      func(m *Media, t *token, style string) string { return parser.Parse(m.Release).Resolution },
+	"source":          func(m *Media, t *token, style string) string { return parser.Parse(m.Release).Source },
+	"codec":           func(m *Media, t *token, style string) string { return parser.Parse(m.Release).Codec },
+	"edition":         func(m *Media, t *token, style string) string { return parser.Parse(m.Release).Edition },
+	"imdbid":          func(m *Media, t *token, style string) string { return m.Details.ImdbId },
+	"tmdbid":          providerId("tmdb"),
+	"tvdbid":          providerId("tvdb"),
+}
+
+// Tokens returns the names of the tokens templates can use.
+func Tokens() []string {
+	return []string {
+		"Title", "Movie Title", "Series Title", "TitleYear", "Movie TitleYear", "Series TitleYear", "Year",
+		"season", "episode", "absolute", "Episode Title", "Air Date",
+		"Quality", "Release Title", "Release Group", "Resolution", "Source", "Codec", "Edition",
+		"IMDb Id", "TMDb Id", "TVDB Id",
+	}
+}
+
+// Styles returns the multi-episode styles.
+func Styles() []string {
+	return []string{Extend, Repeat, Scene, Range, PrefixedRange}
+}
+
+// Validate checks that both templates can be rendered and that the episode
+// template names each episode differently.
+func (f *Format) Validate() error {
+	if len(strings.TrimSpace(f.Movie)) == 0 || len(strings.TrimSpace(f.Episode)) == 0 {
+		return ErrEmptyTemplate
+	}
+	if !validStyle(f.MultiEpisodeStyle) {
+		return ErrInvalidStyle
+	}
+
+	for _, template := range []string{f.Movie, f.Episode} {
+		if strings.HasPrefix(template, "/") || strings.HasPrefix(template, "\\") {
+			return ErrInvalidPath
+		}
+		for _, segment := range strings.Split(template, "/") {
+			if strings.TrimSpace(segment) == ".." {
+				return ErrInvalidPath
+			}
+		}
+		if _, err := parse(template); err != nil {
+			return err
+		}
+	}
+
+	tokens, _ := parse(f.Episode)
+	for _, t := range tokens {
+		if !t.literal && (t.text == "episode" || t.text == "absolute" || t.text == "airdate") {
+			return nil
+		}
+	}
+	return ErrNoEpisode
+}
+
+// MoviePath returns the path of a movie file, relative to the movies
+// folder and without an extension.
+func (f *Format) MoviePath(m *Media) (string, error) {
+	return render(f.Movie, f.MultiEpisodeStyle, m)
+}
+
+// EpisodePath returns the path of a file with one or more episodes,
+// relative to the TV folder and without an extension.
+func (f *Format) EpisodePath(m *Media) (string, error) {
+	return render(f.Episode, f.MultiEpisodeStyle, m)
+}
+
+// Clean removes characters that aren't allowed in file names on Windows,
+// macOS or Linux, so the library can be shared with any Plex server.
+func Clean(name string) string {
+	name = strings.ReplaceAll(name, ": ", " - ")
+	name = strings.Map(func(c rune) rune {
+		switch {
+		case c < 32:
+			return -1
+		case strings.ContainsRune(`<>"/\|?*`, c):
+			return -1
+		case c == ':':
+			return '-'
+		}
+		return c
+	}, name)
+
+	// Windows doesn't allow names ending with a dot or space.
+	return strings.TrimRight(strings.Join(strings.Fields(name), " "), ". ")
+}
+
+// Inside returns true if path is in the folder or one of its subfolders.
+// Files outside the library folders must never be replaced or deleted.
+func Inside(path string, folder string) bool {
+	rel, err := filepath.Rel(filepath.Clean(folder), filepath.Clean(path))
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".." + string(filepath.Separator))
+}
+
+// render fills in a template and tidies each file and folder name.
+func render(template string, style string, m *Media) (string, error) {
+	tokens, err := parse(template)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i := range tokens {
+		t := &tokens[i]
+		if t.literal {
+			b.WriteString(t.text)
+			continue
+		}
+
+		v := Clean(values[t.text](m, t, style))
+		if t.sep != " " {
+			words := make([]string, 0)
+			for _, w := range strings.Fields(v) {
+				if w != "-" {
+					words = append(words, w)
+				}
+			}
+			v = strings.Join(words, t.sep)
+		}
+		b.WriteString(v)
+	}
+
+	segments := strings.Split(b.String(), "/")
+	for i, s := range segments {
+		s = tidy(s)
+		if len(s) == 0 || s == "." || s == ".." {
+			return "", ErrEmptyName
+		}
+		segments[i] = s
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+var (
+	emptyBracketsRE = regexp.MustCompile(`\(\s*\)|\[\s*\]`)
+	repeatedDashRE  = regexp.MustCompile(`\s+-(\s+-)+\s+`)
+)
+
+// tidy removes what's left of tokens without a value, such as empty
+// brackets and dangling dashes, from a file or folder name.
+func tidy(s string) string {
+	s = emptyBracketsRE.ReplaceAllString(s, "")
+	s = strings.Join(strings.Fields(s), " ")
+	s = repeatedDashRE.ReplaceAllString(s, " - ")
+	return strings.TrimRight(strings.Trim(s, " -_"), ". ")
+}
+
+// parse splits a template into literal text and tokens.
+func parse(template string) ([]token, error) {
+	tokens := make([]token, 0)
+	for len(template) > 0 {
+		open := strings.IndexByte(template, '{')
+		if open < 0 {
+			if strings.IndexByte(template, '}') >= 0 {
+				return nil, ErrInvalidToken
+			}
+			tokens = append(tokens, token{text: template, literal: true})
+			break
+		}
+
+		if open > 0 {
+			if strings.IndexByte(template[:open], '}') >= 0 {
+				return nil, ErrInvalidToken
+			}
+			tokens = append(tokens, token{text: template[:open], literal: true})
+		}
+
+		end := strings.IndexByte(template[open:], '}')
+		if end < 0 {
+			return nil, ErrInvalidToken
+		}
+
+		t, err := parseToken(template[open + 1:open + end])
+		if err != nil {
+			return nil, err
+		}
+
+		// The letter before an episode number, as in S01E01 or 1x01.
+		if open > 0 {
+			if c := template[open - 1]; (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+				t.prefix = string(c)
+			}
+		}
+
+		tokens = append(tokens, *t)
+		template = template[open + end + 1:]
+	}
+	return tokens, nil
+}
+
+// parseToken reads the text between a pair of braces.
+func parseToken(s string) (*token, error) {
+	t := &token{sep: " "}
+
+	name := s
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		name, t.format = s[:i], s[i + 1:]
+		if len(t.format) == 0 || strings.Trim(t.format, "0") != "" {
+			return nil, fmt.Errorf("%w: {%s} must be padded with zeros, e.g. {%s:00}", ErrInvalidToken, s, name)
+		}
+	}
+
+	switch {
+	case strings.Contains(name, "."):
+		t.sep = "."
+	case strings.Contains(name, "_"):
+		t.sep = "_"
+	}
+
+	t.text = strings.ToLower(strings.NewReplacer(" ", "", ".", "", "_", "", "-", "").Replace(name))
+	if _, ok := values[t.text]; !ok {
+		return nil, fmt.Errorf("%w: {%s}", ErrUnknownToken, name)
+	}
+	return t, nil
+}
+
+// validStyle returns true if style is a multi-episode style.
+func validStyle(style string) bool {
+	for _, s := range Styles() {
+		if s == style {
+			return true
+		}
+	}
+	return false
+}
+
+// number formats n with the padding of a format such as 00, or returns an
+// empty string if n is 0 or less.
+func number(n int, format string) string {
+	if n <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%0*d", len(format), n)
+}
+
+// year returns the year of the media, or 0 if it isn't known.
+func year(m *Media) int {
+	if m.Year > 0 {
+		return m.Year
+	}
+	return library.Year(m.Details.ReleaseDate)
+}
+
+// title returns the name of the movie or show.
+func title(m *Media, t *token, style string) string {
+	return m.Details.Title
+}
+
+// titleYear returns the name of the movie or show followed by its year,
+// unless the name already ends with it, as in "Doctor Who (2005)".
+func titleYear(m *Media, t *token, style string) string {
+	y := year(m)
+	if y == 0 || strings.HasSuffix(m.Details.Title, fmt.Sprintf("(%d)", y)) {
+		return m.Details.Title
+	}
+	return fmt.Sprintf("%s (%d)", m.Details.Title, y)
+}
+
+// season returns the season number of the episodes.
+func season(m *Media, t *token, style string) string {
+	if len(m.Episodes) == 0 {
+		return ""
+	}
+	// Specials are season 0, which number leaves out.
+	return fmt.Sprintf("%0*d", len(t.format), m.Episodes[0].Season)
+}
+
+// episodes returns a value that writes the numbers of the episodes in the
+// multi-episode style.
+func episodes(n func(models.Episode) int) value {
+	return func(m *Media, t *token, style string) string {
+		list := make([]string, 0, len(m.Episodes))
+		for _, e := range m.Episodes {
+			if s := number(n(e), t.format); len(s) > 0 {
+				list = append(list, s)
+			}
+		}
+		if len(list) <= 1 {
+			return strings.Join(list, "")
+		}
+
+		first, last := list[0], list[len(list) - 1]
+		prefix := t.prefix
+		switch style {
+		case Extend:
+			return strings.Join(list, "-")
+		case Repeat:
+			if len(prefix) == 0 {
+				prefix = "-"
+			}
+			return strings.Join(list, prefix)
+		case Scene:
+			return strings.Join(list, "-" + prefix)
+		case Range:
+			return first + "-" + last
+		}
+		return first + "-" + prefix + last
+	}
+}
+
+// episodeTitle returns the names of the episodes. Parts of one story, such
+// as "Finale (1)" and "Finale (2)", are named once.
+func episodeTitle(m *Media, t *token, style string) string {
+	names := make([]string, 0, len(m.Episodes))
+	for _, e := range m.Episodes {
+		name := strings.TrimSpace(partRE.ReplaceAllString(e.Name, ""))
+		if len(name) > 0 && (len(names) == 0 || names[len(names) - 1] != name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 1 && len(m.Episodes) == 1 {
+		return m.Episodes[0].Name
+	}
+	return strings.Join(names, " + ")
+}
+
+// Part numbers at the end of episode names.
+var partRE = regexp.MustCompile(`\s*\((\d+|part \d+)\)$`)
+
+// airDate returns when the first episode aired.
+func airDate(m *Media, t *token, style string) string {
+	if len(m.Episodes) == 0 {
+		return ""
+	}
+	return m.Episodes[0].AirDate
+}
+
+// providerId returns a value that gives the media's ID at a provider, if
+// the media came from it.
+func providerId(provider string) value {
+	return func(m *Media, t *token, style string) string {
+		p, id, err := library.ParseId(m.Details.Id)
+		if err != nil || p != provider {
+			return ""
+		}
+		return strconv.Itoa(id)
+	}
+}
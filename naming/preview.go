@@ -0,0 +1,96 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package naming
+
+import (
+	"github.com/MediaExchange/mex/models"
+)
+
+// Examples are paths rendered from made up media, to check a format before
+// using it.
+type Examples struct {
+	Movie           string  `json:"movie"`          // A movie.
+	Episode         string  `json:"episode"`        // A single episode.
+	MultiEpisode    string  `json:"multiEpisode"`   // A file with three episodes.
+	DailyEpisode    string  `json:"dailyEpisode"`   // An episode of a show named by air date.
+	AnimeEpisode    string  `json:"animeEpisode"`   // An episode with an absolute number.
+	Special         string  `json:"special"`        // An episode of season 0.
+}
+
+// Extension of the example files.
+const exampleExtension = ".mkv"
+
+var (
+	exampleMovie = models.Details {
+		Id:          "tmdb:299534",
+		Type:        models.Movie,
+		ImdbId:      "tt4154796",
+		Title:       "The Movie Title: Part II",
+		ReleaseDate: "2019-04-24",
+	}
+
+	exampleShow = models.Details {
+		Id:          "tvdb:121361",
+		Type:        models.TvShow,
+		ImdbId:      "tt0944947",
+		Title:       "The Series Title's!",
+		ReleaseDate: "2010-04-17",
+	}
+
+	exampleEpisodes = []models.Episode {
+		{Name: "Episode Title (1)", Number: 1, Season: 1, Episode: 1, AirDate: "2010-04-17"},
+		{Name: "Episode Title (2)", Number: 2, Season: 1, Episode: 2, AirDate: "2010-04-24"},
+		{Name: "Another Title", Number: 3, Season: 1, Episode: 3, AirDate: "2010-05-01"},
+	}
+)
+
+// Preview renders the format for each kind of media.
+func (f *Format) Preview() (*Examples, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	examples := make([]string, 0, 6)
+	for _, m := range []Media {
+		{Details: &exampleMovie, Release: "The.Movie.Title.Part.II.2019.EXTENDED.1080p.BluRay.x264-RlsGrp", Quality: "Bluray-1080p"},
+		{Details: &exampleShow, Episodes: exampleEpisodes[:1], Release: "The.Series.Titles.S01E01.1080p.WEB-DL.DDP5.1.H.264-RlsGrp", Quality: "WEBDL-1080p"},
+		{Details: &exampleShow, Episodes: exampleEpisodes, Release: "The.Series.Titles.S01E01-E03.1080p.WEB-DL.DDP5.1.H.264-RlsGrp", Quality: "WEBDL-1080p"},
+		{Details: &exampleShow, Episodes: []models.Episode{{Name: "Guest Name", Season: 2013, Episode: 131, AirDate: "2013-10-30"}}, Release: "The.Series.Titles.2013.10.30.Guest.Name.720p.HDTV.x264-RlsGrp", Quality: "HDTV-720p"},
+		{Details: &exampleShow, Episodes: []models.Episode{{Name: "Episode Title", Number: 101, Season: 4, Episode: 12, AirDate: "2014-03-02"}}, Release: "[RlsGrp] The Series Titles - 101 [1080p]", Quality: "WEBDL-1080p"},
+		{Details: &exampleShow, Episodes: []models.Episode{{Name: "Behind the Scenes", Season: 0, Episode: 1, AirDate: "2010-04-10"}}, Release: "The.Series.Titles.S00E01.720p.WEB.h264-RlsGrp", Quality: "WEBDL-720p"},
+	} {
+		m := m
+		render := f.EpisodePath
+		if m.Details.Type == models.Movie {
+			render = f.MoviePath
+		}
+
+		path, err := render(&m)
+		if err != nil {
+			return nil, err
+		}
+		examples = append(examples, path + exampleExtension)
+	}
+
+	return &Examples {
+		Movie:        examples[0],
+		Episode:      examples[1],
+		MultiEpisode: examples[2],
+		DailyEpisode: examples[3],
+		AnimeEpisode: examples[4],
+		Special:      examples[5],
+	}, nil
+}
@@ -0,0 +1,558 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package parser reads the information packed into release names such as
+// "Show.Name.S02E05.1080p.WEB-DL.DDP5.1.H.264-GROUP" so MEX can tell which
+// media a release contains and how good a copy it is.
+package parser
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Normalized sources.
+const (
+	SourceBluRay    = "bluray"
+	SourceWebDL     = "webdl"
+	SourceWebRip    = "webrip"
+	SourceHDTV      = "hdtv"
+	SourceSDTV      = "sdtv"
+	SourceDVD       = "dvd"
+	SourceScreener  = "screener"
+	SourceTelesync  = "telesync"
+	SourceCam       = "cam"
+)
+
+// Normalized video codecs.
+const (
+	CodecH264   = "h264"
+	CodecH265   = "h265"
+	CodecAV1    = "av1"
+	CodecXviD   = "xvid"
+	CodecVC1    = "vc1"
+	CodecMPEG2  = "mpeg2"
+)
+
+// Result is everything that could be read from a release name. Fields that
+// weren't found are left empty.
+type Result struct {
+	Title       string      `json:"title"`          // Name of the movie or show, with separators replaced by spaces.
+	Year        int         `json:"year"`           // Release year, mostly for movies.
+	Seasons     []int       `json:"seasons"`        // Seasons in the release. Usually one; more for multi-season packs.
+	Episodes    []int       `json:"episodes"`       // Episodes of the first season, more than one for multi-episode releases.
+	FullSeason  bool        `json:"fullSeason"`     // True for season packs, which have seasons but no episodes.
+	AirDate     string      `json:"airDate"`        // YYYY-MM-DD for daily shows named by date.
+	Absolute    []int       `json:"absolute"`       // Absolute episode numbers, mostly used by anime.
+	Resolution  string      `json:"resolution"`     // 2160p, 1080p, 720p, 576p or 480p.
+	Source      string      `json:"source"`         // One of the Source constants.
+	Remux       bool        `json:"remux"`          // True for untouched copies of a disc's streams.
+	Codec       string      `json:"codec"`          // One of the Codec constants.
+	Audio       string      `json:"audio"`          // aac, ac3, eac3, dts, dts-hd ma, dts:x, truehd, flac, opus, mp3 or pcm.
+	Channels    string      `json:"channels"`       // Audio channels, e.g. 5.1.
+	Atmos       bool        `json:"atmos"`          // True if the audio has Dolby Atmos.
+	Hdr         []string    `json:"hdr"`            // dv, hdr10+, hdr10, hdr and hlg.
+	Edition     string      `json:"edition"`        // e.g. Extended or Director's Cut.
+	Proper      bool        `json:"proper"`         // Fixes a problem with an earlier release by another group.
+	Repack      bool        `json:"repack"`         // Fixes a problem with the group's own earlier release.
+	Version     int         `json:"version"`        // Release version, e.g. 2 for anime "v2" releases, or 0.
+	Group       string      `json:"group"`          // Release group.
+}
+
+// pattern pairs a regular expression with the value it stands for.
+type pattern struct {
+	re    *regexp.Regexp
+	value string
+}
+
+const (
+	// Characters that separate words in release names.
+	sep = `[\s._\-\[\]()]`
+	// Start and end of a word.
+	before = `(?:^|` + sep + `)`
+	after  = `(?:$|` + sep + `)`
+)
+
+var (
+	extensionRE = regexp.MustCompile(`(?i)\.(mkv|mp4|avi|m4v|ts|wmv|nzb|torrent)$`)
+	crcRE       = regexp.MustCompile(`\s*\[[0-9A-Fa-f]{8}\]`)
+	leadGroupRE = regexp.MustCompile(`^\[([^\]]+)\]\s*`)
+	tagsRE      = regexp.MustCompile(`(\s*\[[^\]]*\])+$`)
+	groupRE     = regexp.MustCompile(`\S-([A-Za-z0-9][A-Za-z0-9_]*)$`)
+
+	seasonEpisodeRE = regexp.MustCompile(`(?i)` + before + `S(\d{1,3})[\s._-]?E(\d{1,4})`)
+	crossRE         = regexp.MustCompile(`(?i)` + before + `(\d{1,2})x(\d{2,3})(?:-(?:\d{1,2}x)?(\d{2,3}))?` + after)
+	seasonRE        = regexp.MustCompile(`(?i)` + before + `S(\d{1,2})(?:-S?(\d{1,2}))?` + after)
+	seasonWordRE    = regexp.MustCompile(`(?i)` + before + `Season[\s._]?(\d{1,2})(?:[\s._]?(?:-|to)[\s._]?(?:Season[\s._]?)?(\d{1,2}))?` + after)
+	dailyRE         = regexp.MustCompile(before + `((?:19|20)\d{2})[\s._-](\d{2})[\s._-](\d{2})` + after)
+	absoluteRE      = regexp.MustCompile(`(?i)\s-\s(\d{1,4})(?:-(\d{1,4}))?(?:v(\d))?(?:$|[\s\[(])`)
+	episodeOnlyRE   = regexp.MustCompile(`(?i)` + before + `E(?:P)?(\d{2,4})(?:v(\d))?` + after)
+	yearRE          = regexp.MustCompile(before + `[\[(]?((?:19|20)\d{2})[\])]?` + after)
+	versionRE       = regexp.MustCompile(`(?i)` + before + `v([2-9])` + after)
+
+	resolutions = []pattern {
+		{word(`2160p|4k|uhd`), "2160p"},
+		{word(`1080[pi]|1920x1080`), "1080p"},
+		{word(`720p|1280x720`), "720p"},
+		{word(`576[pi]`), "576p"},
+		{word(`480[pi]|640x480|848x480`), "480p"},
+	}
+
+	// Checked in order, so more specific names come first.
+	sources = []pattern {
+		{word(`blu[\s._-]?ray|bd[\s._-]?rip|br[\s._-]?rip|bd[\s._-]?remux|bd25|bd50|uhd[\s._-]?bluray`), SourceBluRay},
+		{word(`web[\s._-]?dl|webhd|amzn|nf|dsnp|hmax|atvp|pcok|hulu`), SourceWebDL},
+		{word(`web[\s._-]?rip|webmux|hdrip`), SourceWebRip},
+		{word(`web`), SourceWebDL},
+		{word(`hdtv|hdtvrip|ahdtv|uhdtv`), SourceHDTV},
+		{word(`pdtv|sdtv|dsr|dsrip|tvrip`), SourceSDTV},
+		{word(`dvd[\s._-]?scr|screener|scr`), SourceScreener},
+		{word(`dvd[\s._-]?rip|dvdr|dvd5|dvd9|dvd|ntsc|pal`), SourceDVD},
+		{word(`telesync|hdts|hd[\s._-]?ts|pdvd`), SourceTelesync},
+		{word(`cam|camrip|hdcam|hd[\s._-]?cam`), SourceCam},
+	}
+
+	codecs = []pattern {
+		{word(`x264|h[\s._]?264|avc`), CodecH264},
+		{word(`x265|h[\s._]?265|hevc`), CodecH265},
+		{word(`av1`), CodecAV1},
+		{word(`xvid|divx`), CodecXviD},
+		{word(`vc[\s._-]?1`), CodecVC1},
+		{word(`mpeg[\s._-]?2`), CodecMPEG2},
+	}
+
+	// Audio names often run into their channel count, e.g. DDP5.1, so they
+	// only need a separator before them.
+	audios = []pattern {
+		{prefix(`truehd`), "truehd"},
+		{prefix(`dts[\s._-]?hd[\s._-]?ma|dts[\s._-]?ma`), "dts-hd ma"},
+		{prefix(`dts[\s._:-]?x` + after), "dts:x"},
+		{prefix(`dts[\s._-]?hd|dts`), "dts"},
+		{prefix(`ddp|dd\+|e[\s._-]?ac[\s._-]?3`), "eac3"},
+		{prefix(`dd(?:[\s._]?[1-7][\s._][01])|ac[\s._-]?3|dolby[\s._-]?digital`), "ac3"},
+		{prefix(`aac`), "aac"},
+		{prefix(`flac`), "flac"},
+		{prefix(`opus`), "opus"},
+		{prefix(`mp3`), "mp3"},
+		{prefix(`l?pcm`), "pcm"},
+	}
+	channelsRE = regexp.MustCompile(`(?i)^.{0,16}?\D([1-8])[\s._]([01])(?:ch)?` + after)
+	atmosRE    = word(`atmos`)
+
+	hdrs = []pattern {
+		{word(`dv|dovi|dolby[\s._-]?vision`), "dv"},
+		{word(`hdr10\+|hdr10plus|hdr10p`), "hdr10+"},
+		{word(`hdr10`), "hdr10"},
+		{word(`hdr`), "hdr"},
+		{word(`hlg`), "hlg"},
+	}
+
+	editions = []pattern {
+		{word(`director'?s[\s._-]?cut|directors`), "Director's Cut"},
+		{word(`extended(?:[\s._-]?(?:cut|edition))?`), "Extended"},
+		{word(`theatrical(?:[\s._-]?(?:cut|edition))?`), "Theatrical"},
+		{word(`unrated`), "Unrated"},
+		{word(`uncut`), "Uncut"},
+		{word(`imax`), "IMAX"},
+		{word(`remastered`), "Remastered"},
+		{word(`criterion(?:[\s._-]?collection)?`), "Criterion"},
+		{word(`final[\s._-]?cut`), "Final Cut"},
+		{word(`ultimate[\s._-]?(?:cut|edition)`), "Ultimate Edition"},
+		{word(`special[\s._-]?edition`), "Special Edition"},
+		{word(`\d{2}th[\s._-]?anniversary(?:[\s._-]?edition)?|anniversary[\s._-]?edition`), "Anniversary Edition"},
+	}
+
+	remuxRE  = word(`remux|bdremux`)
+	properRE = word(`proper`)
+	repackRE = word(`repack\d?|rerip`)
+
+	// Words that look like a group after a dash but are part of a tag.
+	notGroups = map[string]bool {
+		"dl": true, "rip": true, "hd": true, "ma": true, "x": true, "ray": true,
+		"web": true, "dts": true, "audio": true, "sub": true, "subs": true,
+		"1080p": true, "720p": true, "2160p": true, "x264": true, "x265": true,
+	}
+)
+
+// Parse reads a release name. Names that can't be understood give a Result
+// with only the title set.
+func Parse(name string) Result {
+	var r Result
+
+	name = strings.TrimSpace(name)
+	name = extensionRE.ReplaceAllString(path.Base(strings.ReplaceAll(name, "\\", "/")), "")
+	name = crcRE.ReplaceAllString(name, "")
+
+	// Anime releases start with the group in brackets.
+	anime := false
+	if m := leadGroupRE.FindStringSubmatch(name); m != nil {
+		r.Group = strings.TrimSpace(m[1])
+		name = name[len(m[0]):]
+		anime = true
+	}
+
+	// Scene releases end with -GROUP, sometimes followed by tags such as
+	// [rarbg], which are kept. A dash with spaces around it separates the
+	// parts of a file name like Show - S01E01 - Title [1080p] instead.
+	if len(r.Group) == 0 {
+		trimmed := tagsRE.ReplaceAllString(name, "")
+		if m := groupRE.FindStringSubmatchIndex(trimmed); m != nil {
+			group := trimmed[m[2]:m[3]]
+			if !notGroups[strings.ToLower(group)] && !isYear(group) {
+				r.Group = group
+				name = trimmed[:m[2] - 1] + name[len(trimmed):]
+			}
+		}
+	}
+
+	titleEnd := r.numbering(name, anime)
+
+	// The year is the last one before the episode numbers, so titles that
+	// start with or contain a year, like 2001 A Space Odyssey, keep it.
+	limit := titleEnd
+	if limit < 0 {
+		limit = len(name)
+	}
+	for _, m := range findAll(yearRE, name) {
+		if m[2] >= limit || len(strings.Trim(name[:m[2]], " ._-[(")) == 0 {
+			continue
+		}
+		r.Year, _ = strconv.Atoi(name[m[2]:m[3]])
+		titleEnd = start(name, m[0])
+	}
+
+	// Everything after the title is tags. Without numbering or a year, the
+	// title ends at the first tag.
+	rest := name
+	if titleEnd >= 0 {
+		rest = name[titleEnd:]
+	}
+	tagStart := r.tags(rest)
+	if titleEnd < 0 {
+		titleEnd = tagStart
+		if titleEnd < 0 {
+			titleEnd = len(name)
+		}
+	}
+
+	r.Title = cleanTitle(name[:titleEnd])
+	return r
+}
+
+// numbering finds the season and episode numbers, air date or absolute
+// episode numbers and returns where they start, or -1 if there are none.
+func (r *Result) numbering(name string, anime bool) int {
+	if m := seasonEpisodeRE.FindStringSubmatchIndex(name); m != nil {
+		season, _ := strconv.Atoi(name[m[2]:m[3]])
+		first, _ := strconv.Atoi(name[m[4]:m[5]])
+		r.Seasons = []int{season}
+		r.Episodes = moreEpisodes(name[m[1]:], first)
+		return start(name, m[0])
+	}
+
+	if m := crossRE.FindStringSubmatchIndex(name); m != nil {
+		season, _ := strconv.Atoi(name[m[2]:m[3]])
+		first, _ := strconv.Atoi(name[m[4]:m[5]])
+		r.Seasons = []int{season}
+		r.Episodes = []int{first}
+		if m[6] >= 0 {
+			last, _ := strconv.Atoi(name[m[6]:m[7]])
+			r.Episodes = episodeRange(first, last)
+		}
+		return start(name, m[0])
+	}
+
+	if m := dailyRE.FindStringSubmatchIndex(name); m != nil {
+		month, _ := strconv.Atoi(name[m[4]:m[5]])
+		day, _ := strconv.Atoi(name[m[6]:m[7]])
+		if month >= 1 && month <= 12 && day >= 1 && day <= 31 {
+			r.AirDate = name[m[2]:m[3]] + "-" + name[m[4]:m[5]] + "-" + name[m[6]:m[7]]
+			return start(name, m[0])
+		}
+	}
+
+	for _, re := range []*regexp.Regexp{seasonRE, seasonWordRE} {
+		if m := re.FindStringSubmatchIndex(name); m != nil && m[0] > 0 {
+			first, _ := strconv.Atoi(name[m[2]:m[3]])
+			last := first
+			if m[4] >= 0 {
+				last, _ = strconv.Atoi(name[m[4]:m[5]])
+			}
+			r.Seasons = episodeRange(first, last)
+			r.FullSeason = true
+			return start(name, m[0])
+		}
+	}
+
+	if anime {
+		if m := absoluteRE.FindStringSubmatchIndex(name); m != nil {
+			first, _ := strconv.Atoi(name[m[2]:m[3]])
+			r.Absolute = []int{first}
+			if m[4] >= 0 {
+				last, _ := strconv.Atoi(name[m[4]:m[5]])
+				r.Absolute = episodeRange(first, last)
+			}
+			if m[6] >= 0 {
+				r.Version, _ = strconv.Atoi(name[m[6]:m[7]])
+			}
+			return m[0]
+		}
+	}
+
+	if m := episodeOnlyRE.FindStringSubmatchIndex(name); m != nil && m[0] > 0 {
+		n, _ := strconv.Atoi(name[m[2]:m[3]])
+		r.Absolute = []int{n}
+		if m[4] >= 0 {
+			r.Version, _ = strconv.Atoi(name[m[4]:m[5]])
+		}
+		return start(name, m[0])
+	}
+
+	return -1
+}
+
+// tags reads the quality and other tags from the part of the name after
+// the title and returns where the first one starts, or -1.
+func (r *Result) tags(s string) int {
+	first := -1
+	found := func(m []int) {
+		if m != nil && (first < 0 || m[0] < first) {
+			first = start(s, m[0])
+		}
+	}
+
+	r.Resolution = match(s, resolutions, found)
+	r.Source = match(s, sources, found)
+	r.Codec = match(s, codecs, found)
+	r.Edition = match(s, editions, found)
+
+	if m := remuxRE.FindStringIndex(s); m != nil {
+		r.Remux = true
+		if len(r.Source) == 0 {
+			r.Source = SourceBluRay
+		}
+		found(m)
+	}
+	if m := properRE.FindStringIndex(s); m != nil {
+		r.Proper = true
+		found(m)
+	}
+	if m := repackRE.FindStringIndex(s); m != nil {
+		r.Repack = true
+		found(m)
+	}
+	if m := versionRE.FindStringSubmatchIndex(s); m != nil && r.Version == 0 {
+		r.Version, _ = strconv.Atoi(s[m[2]:m[3]])
+	}
+
+	for _, p := range audios {
+		if m := p.re.FindStringIndex(s); m != nil {
+			r.Audio = p.value
+			found(m)
+			if c := channelsRE.FindStringSubmatch(s[start(s, m[0]):]); c != nil {
+				r.Channels = c[1] + "." + c[2]
+			}
+			break
+		}
+	}
+	if m := atmosRE.FindStringIndex(s); m != nil {
+		r.Atmos = true
+		found(m)
+	}
+
+	for _, p := range hdrs {
+		if m := p.re.FindStringIndex(s); m != nil {
+			// HDR10 and HDR10+ imply plain HDR, so it isn't listed twice.
+			if p.value == "hdr" && (contains(r.Hdr, "hdr10") || contains(r.Hdr, "hdr10+")) {
+				continue
+			}
+			if p.value == "hdr10" && contains(r.Hdr, "hdr10+") {
+				continue
+			}
+			r.Hdr = append(r.Hdr, p.value)
+			found(m)
+		}
+	}
+
+	return first
+}
+
+// Normalize reduces a title to lowercase letters and digits so titles from
+// release names and providers can be compared, e.g. "Marvel's Agents of
+// S.H.I.E.L.D." and "Marvels Agents of S H I E L D" both become
+// "marvelsagentsofshield".
+func Normalize(title string) string {
+	title = strings.ReplaceAll(strings.ToLower(title), "&", "and")
+
+	var b strings.Builder
+	for _, c := range title {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// match returns the value of the first pattern found in s.
+func match(s string, patterns []pattern, found func([]int)) string {
+	for _, p := range patterns {
+		if m := p.re.FindStringIndex(s); m != nil {
+			found(m)
+			return p.value
+		}
+	}
+	return ""
+}
+
+// moreEpisodes reads the episodes that follow the first in names such as
+// S01E01E02, S01E01-E03 and S01E01-03. A dash means a range.
+func moreEpisodes(s string, first int) []int {
+	episodes := []int{first}
+	last := first
+	for {
+		rangeOf := false
+		i := 0
+		switch {
+		case strings.HasPrefix(s, "-E") || strings.HasPrefix(s, "-e"):
+			rangeOf, i = true, 2
+		case strings.HasPrefix(s, "-"):
+			rangeOf, i = true, 1
+		case strings.HasPrefix(s, "E") || strings.HasPrefix(s, "e"):
+			i = 1
+		case strings.HasPrefix(s, ".E") || strings.HasPrefix(s, ".e"):
+			i = 2
+		default:
+			return episodes
+		}
+
+		j := i
+		for j < len(s) && j - i < 3 && s[j] >= '0' && s[j] <= '9' {
+			j++
+		}
+		// Not an episode if there are no digits, or if the digits are
+		// really a resolution such as 1080p.
+		if j == i || (j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == 'p' || s[j] == 'P' || s[j] == 'i')) {
+			return episodes
+		}
+
+		n, _ := strconv.Atoi(s[i:j])
+		if n <= last {
+			return episodes
+		}
+		if rangeOf {
+			episodes = append(episodes[:len(episodes) - 1], episodeRange(last, n)...)
+		} else {
+			episodes = append(episodes, n)
+		}
+		last = n
+		s = s[j:]
+	}
+}
+
+// episodeRange returns the numbers from first to last. Implausible ranges
+// give just the first number.
+func episodeRange(first int, last int) []int {
+	if last < first || last - first > 100 {
+		return []int{first}
+	}
+	list := make([]int, 0, last - first + 1)
+	for n := first; n <= last; n++ {
+		list = append(list, n)
+	}
+	return list
+}
+
+// findAll returns the submatch indexes of every match of re in s. Unlike
+// FindAllStringSubmatchIndex, matches may share the separator between them.
+func findAll(re *regexp.Regexp, s string) [][]int {
+	var all [][]int
+	offset := 0
+	for offset < len(s) {
+		m := re.FindStringSubmatchIndex(s[offset:])
+		if m == nil {
+			break
+		}
+		for i := range m {
+			if m[i] >= 0 {
+				m[i] += offset
+			}
+		}
+		all = append(all, m)
+		offset = m[3]
+	}
+	return all
+}
+
+// cleanTitle replaces separators with spaces. Acronyms such as S.H.I.E.L.D
+// keep their dots.
+func cleanTitle(s string) string {
+	s = strings.ReplaceAll(s, "_", " ")
+	if !strings.Contains(strings.TrimSpace(s), " ") {
+		words := strings.Split(s, ".")
+		var b strings.Builder
+		for i, w := range words {
+			if i > 0 {
+				if len(w) == 1 && len(words[i - 1]) == 1 {
+					b.WriteString(".")
+				} else {
+					b.WriteString(" ")
+				}
+			}
+			b.WriteString(w)
+		}
+		s = b.String()
+	}
+
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.Trim(s, " -([")
+}
+
+// start moves a match that began with a separator to the next character.
+func start(s string, i int) int {
+	if i < len(s) && strings.ContainsRune(" ._-[]()", rune(s[i])) {
+		return i + 1
+	}
+	return i
+}
+
+// word compiles a case-insensitive pattern that must be a whole word.
+func word(expr string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)` + before + `(?:` + expr + `)` + after)
+}
+
+// prefix compiles a case-insensitive pattern that must start a word.
+func prefix(expr string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)` + before + `(?:` + expr + `)`)
+}
+
+// isYear returns true for four digit years.
+func isYear(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && len(s) == 4 && n >= 1900 && n < 2100
+}
+
+// contains returns true if list has s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
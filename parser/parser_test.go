@@ -0,0 +1,796 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		want Result
+	}{
+		{"Show.Name.S01E01E02E03.720p.HDTV.x264-GRP", Result {
+			Title:      "Show Name",
+			Seasons:    []int{1},
+			Episodes:   []int{1, 2, 3},
+			Resolution: "720p",
+			Source:     SourceHDTV,
+			Codec:      CodecH264,
+			Group:      "GRP",
+		}},
+		{"Show.Name.1x01-1x03.HDTV.XviD-GRP", Result {
+			Title:    "Show Name",
+			Seasons:  []int{1},
+			Episodes: []int{1, 2, 3},
+			Source:   SourceHDTV,
+			Codec:    CodecXviD,
+			Group:    "GRP",
+		}},
+		{"[Judas] Vinland Saga - 01-12 [1080p][HEVC x265 10bit].mkv", Result {
+			Title:      "Vinland Saga",
+			Absolute:   []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+			Resolution: "1080p",
+			Codec:      CodecH265,
+			Group:      "Judas",
+		}},
+		{"Show.Name.S02E03.1080p.BluRay.REMUX.AVC.DTS-HD.MA.5.1-GRP", Result {
+			Title:      "Show Name",
+			Seasons:    []int{2},
+			Episodes:   []int{3},
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Remux:      true,
+			Codec:      CodecH264,
+			Audio:      "dts-hd ma",
+			Channels:   "5.1",
+			Group:      "GRP",
+		}},
+		{"Movie.2020.IMAX.2160p.WEB-DL.DDP5.1.HDR.HEVC-GRP", Result {
+			Title:      "Movie",
+			Year:       2020,
+			Resolution: "2160p",
+			Source:     SourceWebDL,
+			Codec:      CodecH265,
+			Audio:      "eac3",
+			Channels:   "5.1",
+			Hdr:        []string{"hdr"},
+			Edition:    "IMAX",
+			Group:      "GRP",
+		}},
+		{"Planet.Earth.II.S01E01.2160p.HLG.BluRay.x265-GRP", Result {
+			Title:      "Planet Earth II",
+			Seasons:    []int{1},
+			Episodes:   []int{1},
+			Resolution: "2160p",
+			Source:     SourceBluRay,
+			Codec:      CodecH265,
+			Hdr:        []string{"hlg"},
+			Group:      "GRP",
+		}},
+		{"Movie.2004.UNRATED.720p.BluRay.x264-GRP", Result {
+			Title:      "Movie",
+			Year:       2004,
+			Resolution: "720p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Edition:    "Unrated",
+			Group:      "GRP",
+		}},
+		{"Movie.2004.Theatrical.Cut.1080p.BluRay.x264-GRP", Result {
+			Title:      "Movie",
+			Year:       2004,
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Edition:    "Theatrical",
+			Group:      "GRP",
+		}},
+		{"Movie.1982.Criterion.Collection.1080p.BluRay.FLAC.1.0.x264-GRP", Result {
+			Title:      "Movie",
+			Year:       1982,
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Audio:      "flac",
+			Channels:   "1.0",
+			Edition:    "Criterion",
+			Group:      "GRP",
+		}},
+		{"Movie.2018.PROPER.REPACK.1080p.WEB.H264-GRP", Result {
+			Title:      "Movie",
+			Year:       2018,
+			Resolution: "1080p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Proper:     true,
+			Repack:     true,
+			Group:      "GRP",
+		}},
+		{"Movie.2017.1080p.BluRay.x264.Opus.2.0-GRP", Result {
+			Title:      "Movie",
+			Year:       2017,
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Audio:      "opus",
+			Channels:   "2.0",
+			Group:      "GRP",
+		}},
+		{"Movie.2001.576p.DVDRip.MP3-GRP", Result {
+			Title:      "Movie",
+			Year:       2001,
+			Resolution: "576p",
+			Source:     SourceDVD,
+			Audio:      "mp3",
+			Group:      "GRP",
+		}},
+		{"Movie.2005.480p.HDTV.x264-GRP", Result {
+			Title:      "Movie",
+			Year:       2005,
+			Resolution: "480p",
+			Source:     SourceHDTV,
+			Codec:      CodecH264,
+			Group:      "GRP",
+		}},
+		{"Movie.2016.2160p.UHD.BluRay.AV1.LPCM.2.0-GRP", Result {
+			Title:      "Movie",
+			Year:       2016,
+			Resolution: "2160p",
+			Source:     SourceBluRay,
+			Codec:      CodecAV1,
+			Audio:      "pcm",
+			Channels:   "2.0",
+			Group:      "GRP",
+		}},
+		{"Movie.2006.VC-1.1080p.BluRay.DD5.1-GRP", Result {
+			Title:      "Movie",
+			Year:       2006,
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecVC1,
+			Audio:      "ac3",
+			Channels:   "5.1",
+			Group:      "GRP",
+		}},
+		{"Movie.2019.HDTS.x264-GRP", Result {
+			Title:  "Movie",
+			Year:   2019,
+			Source: SourceTelesync,
+			Codec:  CodecH264,
+			Group:  "GRP",
+		}},
+		{"Movie.2019.TELESYNC.x264-GRP", Result {
+			Title:  "Movie",
+			Year:   2019,
+			Source: SourceTelesync,
+			Codec:  CodecH264,
+			Group:  "GRP",
+		}},
+		{"The.Late.Show.2024-02-05.720p.WEB.H264-GRP", Result {
+			Title:      "The Late Show",
+			AirDate:    "2024-02-05",
+			Resolution: "720p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Group:      "GRP",
+		}},
+		{"Show.Name.S10E100.1080p.WEB.H264-GRP", Result {
+			Title:      "Show Name",
+			Seasons:    []int{10},
+			Episodes:   []int{100},
+			Resolution: "1080p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Group:      "GRP",
+		}},
+		{"C:\\Downloads\\Show.Name.S01E02.720p.HDTV.x264-GRP.mkv", Result {
+			Title:      "Show Name",
+			Seasons:    []int{1},
+			Episodes:   []int{2},
+			Resolution: "720p",
+			Source:     SourceHDTV,
+			Codec:      CodecH264,
+			Group:      "GRP",
+		}},
+		{"Movie.2019.1080p.WEB-DL.E-AC-3.5.1.H.264-GRP", Result {
+			Title:      "Movie",
+			Year:       2019,
+			Resolution: "1080p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Audio:      "eac3",
+			Channels:   "5.1",
+			Group:      "GRP",
+		}},
+		{"Show.Name.Season.1-3.1080p.BluRay.x264-GRP", Result {
+			Title:      "Show Name",
+			Seasons:    []int{1, 2, 3},
+			FullSeason: true,
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Group:      "GRP",
+		}},
+		{"Movie.2014.EXTENDED.CUT.2160p.HDR10+.DTS-X.7.1-GRP", Result {
+			Title:      "Movie",
+			Year:       2014,
+			Resolution: "2160p",
+			Audio:      "dts:x",
+			Channels:   "7.1",
+			Hdr:        []string{"hdr10+"},
+			Edition:    "Extended",
+			Group:      "GRP",
+		}},
+		{"[Group] Show Name - 05 (1080p).mkv", Result {
+			Title:      "Show Name",
+			Absolute:   []int{5},
+			Resolution: "1080p",
+			Group:      "Group",
+		}},
+		{"Show.Name.S01.E05.720p.HDTV.x264-GRP", Result {
+			Title:      "Show Name",
+			Seasons:    []int{1},
+			Episodes:   []int{5},
+			Resolution: "720p",
+			Source:     SourceHDTV,
+			Codec:      CodecH264,
+			Group:      "GRP",
+		}},
+		{"Show.Name.S01E05E06-E08.720p.HDTV.x264-GRP", Result {
+			Title:      "Show Name",
+			Seasons:    []int{1},
+			Episodes:   []int{5, 6, 7, 8},
+			Resolution: "720p",
+			Source:     SourceHDTV,
+			Codec:      CodecH264,
+			Group:      "GRP",
+		}},
+		{"Show.Name.EP12v2.1080p.WEB.x264-GRP", Result {
+			Title:      "Show Name",
+			Absolute:   []int{12},
+			Resolution: "1080p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Version:    2,
+			Group:      "GRP",
+		}},
+		{"Movie.1999.Special.Edition.DVD9-GRP", Result {
+			Title:   "Movie",
+			Year:    1999,
+			Source:  SourceDVD,
+			Edition: "Special Edition",
+			Group:   "GRP",
+		}},
+		{"Movie.1975.25th.Anniversary.Edition.1080p.BluRay.x264-GRP", Result {
+			Title:      "Movie",
+			Year:       1975,
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Edition:    "Anniversary Edition",
+			Group:      "GRP",
+		}},
+		{"Movie (1999) 1080p DDP 5.1 Dolby Vision HEVC", Result {
+			Title:      "Movie",
+			Year:       1999,
+			Resolution: "1080p",
+			Codec:      CodecH265,
+			Audio:      "eac3",
+			Channels:   "5.1",
+			Hdr:        []string{"dv"},
+		}},
+		{"Show.Name.S02E05.1080p.WEB-DL.DDP5.1.H.264-GROUP", Result {
+			Title:      "Show Name",
+			Seasons:    []int{2},
+			Episodes:   []int{5},
+			Resolution: "1080p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Audio:      "eac3",
+			Channels:   "5.1",
+			Group:      "GROUP",
+		}},
+		{"The.Mandalorian.S01E01.Chapter.One.2160p.DSNP.WEB-DL.DDP5.1.Atmos.DV.HDR.H.265-FLUX", Result {
+			Title:      "The Mandalorian",
+			Seasons:    []int{1},
+			Episodes:   []int{1},
+			Resolution: "2160p",
+			Source:     SourceWebDL,
+			Codec:      CodecH265,
+			Audio:      "eac3",
+			Channels:   "5.1",
+			Atmos:      true,
+			Hdr:        []string{"dv", "hdr"},
+			Group:      "FLUX",
+		}},
+		{"Game.of.Thrones.S08E01E02.720p.HDTV.x264-AVS[eztv]", Result {
+			Title:      "Game of Thrones",
+			Seasons:    []int{8},
+			Episodes:   []int{1, 2},
+			Resolution: "720p",
+			Source:     SourceHDTV,
+			Codec:      CodecH264,
+			Group:      "AVS",
+		}},
+		{"Breaking.Bad.S05E01-E03.1080p.BluRay.x264-ROVERS", Result {
+			Title:      "Breaking Bad",
+			Seasons:    []int{5},
+			Episodes:   []int{1, 2, 3},
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Group:      "ROVERS",
+		}},
+		{"Friends.S01E01-03.DVDRip.XviD-GRP", Result {
+			Title:    "Friends",
+			Seasons:  []int{1},
+			Episodes: []int{1, 2, 3},
+			Source:   SourceDVD,
+			Codec:    CodecXviD,
+			Group:    "GRP",
+		}},
+		{"Doctor.Who.2005.S13E01.1080p.WEB.h264-GOSSIP", Result {
+			Title:      "Doctor Who",
+			Year:       2005,
+			Seasons:    []int{13},
+			Episodes:   []int{1},
+			Resolution: "1080p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Group:      "GOSSIP",
+		}},
+		{"Seinfeld.9x22.The.Finale.DVDRip.XviD-SiNK", Result {
+			Title:    "Seinfeld",
+			Seasons:  []int{9},
+			Episodes: []int{22},
+			Source:   SourceDVD,
+			Codec:    CodecXviD,
+			Group:    "SiNK",
+		}},
+		{"The.Daily.Show.2023.05.14.720p.WEB.h264-EDITH", Result {
+			Title:      "The Daily Show",
+			AirDate:    "2023-05-14",
+			Resolution: "720p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Group:      "EDITH",
+		}},
+		{"Marvels.Agents.of.S.H.I.E.L.D.S01E01.720p.HDTV.X264-DIMENSION", Result {
+			Title:      "Marvels Agents of S.H.I.E.L.D",
+			Seasons:    []int{1},
+			Episodes:   []int{1},
+			Resolution: "720p",
+			Source:     SourceHDTV,
+			Codec:      CodecH264,
+			Group:      "DIMENSION",
+		}},
+		{"Stranger.Things.S04.2160p.NF.WEB-DL.DDP5.1.Atmos.DV.HDR10.HEVC-FLUX", Result {
+			Title:      "Stranger Things",
+			Seasons:    []int{4},
+			FullSeason: true,
+			Resolution: "2160p",
+			Source:     SourceWebDL,
+			Codec:      CodecH265,
+			Audio:      "eac3",
+			Channels:   "5.1",
+			Atmos:      true,
+			Hdr:        []string{"dv", "hdr10"},
+			Group:      "FLUX",
+		}},
+		{"The.Wire.Season.1.1080p.BluRay.x265-RARBG", Result {
+			Title:      "The Wire",
+			Seasons:    []int{1},
+			FullSeason: true,
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecH265,
+			Group:      "RARBG",
+		}},
+		{"Blade.Runner.2049.2017.2160p.UHD.BluRay.REMUX.HDR.HEVC.TrueHD.Atmos.7.1-FGT", Result {
+			Title:      "Blade Runner 2049",
+			Year:       2017,
+			Resolution: "2160p",
+			Source:     SourceBluRay,
+			Remux:      true,
+			Codec:      CodecH265,
+			Audio:      "truehd",
+			Channels:   "7.1",
+			Atmos:      true,
+			Hdr:        []string{"hdr"},
+			Group:      "FGT",
+		}},
+		{"2001.A.Space.Odyssey.1968.1080p.BluRay.x264-AMIABLE", Result {
+			Title:      "2001 A Space Odyssey",
+			Year:       1968,
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Group:      "AMIABLE",
+		}},
+		{"1917.2019.1080p.WEB-DL.DD5.1.H264-FGT", Result {
+			Title:      "1917",
+			Year:       2019,
+			Resolution: "1080p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Audio:      "ac3",
+			Channels:   "5.1",
+			Group:      "FGT",
+		}},
+		{"Charlottes.Web.2006.1080p.BluRay.x264-HANDJOB", Result {
+			Title:      "Charlottes Web",
+			Year:       2006,
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Group:      "HANDJOB",
+		}},
+		{"The.Lord.of.the.Rings.The.Fellowship.of.the.Ring.2001.EXTENDED.1080p.BluRay.x264-FSiHD", Result {
+			Title:      "The Lord of the Rings The Fellowship of the Ring",
+			Year:       2001,
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Edition:    "Extended",
+			Group:      "FSiHD",
+		}},
+		{"Apocalypse.Now.1979.Final.Cut.2160p.UHD.BluRay.x265.10bit.HDR.DTS-HD.MA.5.1-SWTYBLZ", Result {
+			Title:      "Apocalypse Now",
+			Year:       1979,
+			Resolution: "2160p",
+			Source:     SourceBluRay,
+			Codec:      CodecH265,
+			Audio:      "dts-hd ma",
+			Channels:   "5.1",
+			Hdr:        []string{"hdr"},
+			Edition:    "Final Cut",
+			Group:      "SWTYBLZ",
+		}},
+		{"Movie Title (2019) [1080p] [BluRay] [5.1] [YTS.MX]", Result {
+			Title:      "Movie Title",
+			Year:       2019,
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+		}},
+		{"[SubsPlease] Jujutsu Kaisen - 24 (1080p) [ABCD1234].mkv", Result {
+			Title:      "Jujutsu Kaisen",
+			Absolute:   []int{24},
+			Resolution: "1080p",
+			Group:      "SubsPlease",
+		}},
+		{"[Erai-raws] One Piece - 1000 [1080p][Multiple Subtitle].mkv", Result {
+			Title:      "One Piece",
+			Absolute:   []int{1000},
+			Resolution: "1080p",
+			Group:      "Erai-raws",
+		}},
+		{"[HorribleSubs] Boku no Hero Academia - 88v2 [720p].mkv", Result {
+			Title:      "Boku no Hero Academia",
+			Absolute:   []int{88},
+			Resolution: "720p",
+			Version:    2,
+			Group:      "HorribleSubs",
+		}},
+		{"One.Piece.E1000.1080p.WEB.H264-SKYANiME", Result {
+			Title:      "One Piece",
+			Absolute:   []int{1000},
+			Resolution: "1080p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Group:      "SKYANiME",
+		}},
+		{"Show.Name.S01E05.PROPER.720p.HDTV.x264-GRP", Result {
+			Title:      "Show Name",
+			Seasons:    []int{1},
+			Episodes:   []int{5},
+			Resolution: "720p",
+			Source:     SourceHDTV,
+			Codec:      CodecH264,
+			Proper:     true,
+			Group:      "GRP",
+		}},
+		{"Show.Name.S01E05.REPACK.1080p.AMZN.WEB-DL.DDP2.0.H.264-NTb", Result {
+			Title:      "Show Name",
+			Seasons:    []int{1},
+			Episodes:   []int{5},
+			Resolution: "1080p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Audio:      "eac3",
+			Channels:   "2.0",
+			Repack:     true,
+			Group:      "NTb",
+		}},
+		{"Star.Wars.Episode.IV.A.New.Hope.1977.Remastered.1080p.BluRay.DTS.x264-GRP", Result {
+			Title:      "Star Wars Episode IV A New Hope",
+			Year:       1977,
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Audio:      "dts",
+			Edition:    "Remastered",
+			Group:      "GRP",
+		}},
+		{"Dune.Part.Two.2024.2160p.WEB-DL.DDP5.1.Atmos.DV.HDR10Plus.H.265-FLUX", Result {
+			Title:      "Dune Part Two",
+			Year:       2024,
+			Resolution: "2160p",
+			Source:     SourceWebDL,
+			Codec:      CodecH265,
+			Audio:      "eac3",
+			Channels:   "5.1",
+			Atmos:      true,
+			Hdr:        []string{"dv", "hdr10+"},
+			Group:      "FLUX",
+		}},
+		{"The.Office.US.S01-S09.COMPLETE.1080p.WEB-DL.AAC2.0.x264", Result {
+			Title:      "The Office US",
+			Seasons:    []int{1, 2, 3, 4, 5, 6, 7, 8, 9},
+			FullSeason: true,
+			Resolution: "1080p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Audio:      "aac",
+			Channels:   "2.0",
+		}},
+		{"Show Name - S01E01 - Pilot [WEBDL-1080p][AAC 2.0][x264]-Group", Result {
+			Title:      "Show Name",
+			Seasons:    []int{1},
+			Episodes:   []int{1},
+			Resolution: "1080p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Audio:      "aac",
+			Channels:   "2.0",
+			Group:      "Group",
+		}},
+		{"Movie.2010.DVDSCR.XviD-AMIABLE", Result {
+			Title:  "Movie",
+			Year:   2010,
+			Source: SourceScreener,
+			Codec:  CodecXviD,
+			Group:  "AMIABLE",
+		}},
+		{"Movie.2010.CAM.XviD-NOGRP", Result {
+			Title:  "Movie",
+			Year:   2010,
+			Source: SourceCam,
+			Codec:  CodecXviD,
+			Group:  "NOGRP",
+		}},
+		{"The.Simpsons.S34E01.720p.HDTV.x264-SYNCOPY[rarbg]", Result {
+			Title:      "The Simpsons",
+			Seasons:    []int{34},
+			Episodes:   []int{1},
+			Resolution: "720p",
+			Source:     SourceHDTV,
+			Codec:      CodecH264,
+			Group:      "SYNCOPY",
+		}},
+		{"Show Name - S01E01 - Episode Title [1080p].mkv", Result {
+			Title:      "Show Name",
+			Seasons:    []int{1},
+			Episodes:   []int{1},
+			Resolution: "1080p",
+		}},
+		{"Show.Name.S01E02.x264-GRP[1080p]", Result {
+			Title:      "Show Name",
+			Seasons:    []int{1},
+			Episodes:   []int{2},
+			Resolution: "1080p",
+			Codec:      CodecH264,
+			Group:      "GRP",
+		}},
+		{"Mr. Robot S01E01 1080p WEB-DL DD5.1 H.264-BS", Result {
+			Title:      "Mr. Robot",
+			Seasons:    []int{1},
+			Episodes:   []int{1},
+			Resolution: "1080p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Audio:      "ac3",
+			Channels:   "5.1",
+			Group:      "BS",
+		}},
+		{"Sherlock.S04.Special.720p.HDTV", Result {
+			Title:      "Sherlock",
+			Seasons:    []int{4},
+			FullSeason: true,
+			Resolution: "720p",
+			Source:     SourceHDTV,
+		}},
+		{"Top.Gear.22x01.HDTV.x264-FoV", Result {
+			Title:    "Top Gear",
+			Seasons:  []int{22},
+			Episodes: []int{1},
+			Source:   SourceHDTV,
+			Codec:    CodecH264,
+			Group:    "FoV",
+		}},
+		{"Movie.Name.2015.1080i.HDTV.MPEG2.DD5.1-CtrlHD", Result {
+			Title:      "Movie Name",
+			Year:       2015,
+			Resolution: "1080p",
+			Source:     SourceHDTV,
+			Codec:      CodecMPEG2,
+			Audio:      "ac3",
+			Channels:   "5.1",
+			Group:      "CtrlHD",
+		}},
+		{"Avatar.2009.Extended.Collectors.Edition.1080p.BluRay.DTS-X.7.1.x264", Result {
+			Title:      "Avatar",
+			Year:       2009,
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Audio:      "dts:x",
+			Channels:   "7.1",
+			Edition:    "Extended",
+		}},
+		{"Movie.2022.1080p.WEBRip.x265.10bit.AAC5.1-RARBG", Result {
+			Title:      "Movie",
+			Year:       2022,
+			Resolution: "1080p",
+			Source:     SourceWebRip,
+			Codec:      CodecH265,
+			Audio:      "aac",
+			Channels:   "5.1",
+			Group:      "RARBG",
+		}},
+		{"show.name.s03e10.hdtv.x264-lol.mp4", Result {
+			Title:    "show name",
+			Seasons:  []int{3},
+			Episodes: []int{10},
+			Source:   SourceHDTV,
+			Codec:    CodecH264,
+			Group:    "lol",
+		}},
+		{"Movie.2021.HDR10.2160p.WEB.h265-GRP", Result {
+			Title:      "Movie",
+			Year:       2021,
+			Resolution: "2160p",
+			Source:     SourceWebDL,
+			Codec:      CodecH265,
+			Hdr:        []string{"hdr10"},
+			Group:      "GRP",
+		}},
+		{"Some.Movie.1999.PAL.DVDR-GRP", Result {
+			Title:  "Some Movie",
+			Year:   1999,
+			Source: SourceDVD,
+			Group:  "GRP",
+		}},
+		{"Westworld.S03E08.Crisis.Theory.1080p.AMZN.WEB-DL.DDP5.1.H.264-NTb", Result {
+			Title:      "Westworld",
+			Seasons:    []int{3},
+			Episodes:   []int{8},
+			Resolution: "1080p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Audio:      "eac3",
+			Channels:   "5.1",
+			Group:      "NTb",
+		}},
+		{"Show.2019.S02E01.1080p.WEB.H264-GRP", Result {
+			Title:      "Show",
+			Year:       2019,
+			Seasons:    []int{2},
+			Episodes:   []int{1},
+			Resolution: "1080p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Group:      "GRP",
+		}},
+		{"The.Tonight.Show.Starring.Jimmy.Fallon.2022.01.31.Guest.720p.WEB.h264-KOGI", Result {
+			Title:      "The Tonight Show Starring Jimmy Fallon",
+			AirDate:    "2022-01-31",
+			Resolution: "720p",
+			Source:     SourceWebDL,
+			Codec:      CodecH264,
+			Group:      "KOGI",
+		}},
+		{"Movie.Title.2020.MULTi.1080p.BluRay.x264.AC3-GRP", Result {
+			Title:      "Movie Title",
+			Year:       2020,
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Audio:      "ac3",
+			Group:      "GRP",
+		}},
+		{"Movie.Title.1080p.BluRay.x264-GRP", Result {
+			Title:      "Movie Title",
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Group:      "GRP",
+		}},
+		{"Show.S01E01.Part.1.720p.HDTV", Result {
+			Title:      "Show",
+			Seasons:    []int{1},
+			Episodes:   []int{1},
+			Resolution: "720p",
+			Source:     SourceHDTV,
+		}},
+		{"24.S01E01.720p.BluRay.x264-GRP", Result {
+			Title:      "24",
+			Seasons:    []int{1},
+			Episodes:   []int{1},
+			Resolution: "720p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Group:      "GRP",
+		}},
+		{"Taken.2.2012.1080p.BluRay.x264-GRP", Result {
+			Title:      "Taken 2",
+			Year:       2012,
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Group:      "GRP",
+		}},
+		{"The.Matrix.1999.Directors.Cut.REPACK2.1080p.BluRay.x264-GRP", Result {
+			Title:      "The Matrix",
+			Year:       1999,
+			Resolution: "1080p",
+			Source:     SourceBluRay,
+			Codec:      CodecH264,
+			Edition:    "Director's Cut",
+			Repack:     true,
+			Group:      "GRP",
+		}},
+		{"Movie.2019.HC.HDRip.x264.AAC-EVO", Result {
+			Title:  "Movie",
+			Year:   2019,
+			Source: SourceWebRip,
+			Codec:  CodecH264,
+			Audio:  "aac",
+			Group:  "EVO",
+		}},
+	}
+
+	for _, test := range tests {
+		got := Parse(test.name)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q)\n got: %+v\nwant: %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Marvel's Agents of S.H.I.E.L.D.", "marvelsagentsofshield"},
+		{"Marvels Agents of S H I E L D", "marvelsagentsofshield"},
+		{"Law & Order: Special Victims Unit", "lawandorderspecialvictimsunit"},
+		{"Law and Order Special Victims Unit", "lawandorderspecialvictimsunit"},
+		{"2001: A Space Odyssey", "2001aspaceodyssey"},
+		{"Amélie", "amélie"},
+		{"The Office (US)", "theofficeus"},
+		{"  ", ""},
+	}
+
+	for _, test := range tests {
+		if got := Normalize(test.title); got != test.want {
+			t.Errorf("Normalize(%q) = %q, want %q", test.title, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package plex
+
+import (
+	"context"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/history"
+	"github.com/MediaExchange/mex/library"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/naming"
+	"github.com/MediaExchange/mex/storage"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CleanupRules choose what happens to media once it has been watched.
+type CleanupRules struct {
+	DeleteMovies        bool            // Delete the files of watched movies.
+	DeleteEpisodes      bool            // Delete the files of watched episodes.
+	WaitForRequesters   bool            // Wait until everyone who requested the media has watched it.
+	Delay               time.Duration   // How long after media is watched its files are deleted.
+	MoviesDir           string          // Only movie files in this folder are deleted.
+	TvDir               string          // Only episode files in this folder are deleted.
+}
+
+var (
+	// Cleanup is off unless configured.
+	Cleanup CleanupRules
+)
+
+// Clean returns a function for services.NewTicker that runs the cleanup
+// rules for the media in the watch history. Files are only deleted once the
+// delay has passed, since Plex reports media as watched before it ends.
+func Clean(store *storage.Store) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		if !Cleanup.DeleteMovies && !Cleanup.DeleteEpisodes {
+			return
+		}
+
+		watches, err := store.Watches.List()
+		if err != nil {
+			log.Error("plex.Clean: unable to list the watch history", log.Err(err))
+			return
+		}
+
+		before := time.Now().Add(-Cleanup.Delay)
+		cleaned := make(map[string]bool)
+		for _, w := range watches {
+			if ctx.Err() != nil {
+				return
+			}
+			if w.Action != models.WatchFinished || len(w.MediaId) == 0 || cleaned[w.MediaId] {
+				continue
+			}
+
+			cleaned[w.MediaId] = true
+			if err := clean(store, w.MediaId, watches, before); err != nil && err != storage.ErrNotFound {
+				log.Warn("plex.Clean: unable to clean up media", log.String("mediaId", w.MediaId), log.Err(err))
+			}
+		}
+	}
+}
+
+// clean deletes the files MEX imported for a movie or episodes that were
+// watched before the given time, if the cleanup rules say so. Files of
+// several episodes are only deleted once all of them have been watched. The
+// movie or episodes are marked as missing, so they aren't downloaded again,
+// and Plex is asked to scan the folder.
+func clean(store *storage.Store, mediaId string, watches []models.Watch, before time.Time) error {
+	item, err := store.Media.Get(mediaId)
+	if err != nil {
+		return err
+	}
+
+	root := Cleanup.MoviesDir
+	if item.Type == models.TvShow {
+		root = Cleanup.TvDir
+	}
+	if (item.Type == models.Movie && !Cleanup.DeleteMovies) || (item.Type == models.TvShow && !Cleanup.DeleteEpisodes) || len(root) == 0 {
+		return nil
+	}
+
+	waitFor, err := requesters(store, item.Id)
+	if err != nil {
+		return err
+	}
+
+	imported, err := history.List(store.History, history.Filter{MediaId: item.Id, Type: models.HistoryImported})
+	if err != nil {
+		return err
+	}
+
+	for _, h := range imported {
+		if len(h.Message) == 0 {
+			continue
+		}
+
+		// Only watches since the file was imported count, and only if
+		// everyone it's waiting for has finished.
+		ready := func(season int, episode int) bool {
+			for _, user := range waitFor {
+				if !finished(watches, item.Id, season, episode, user, h.Date, before) {
+					return false
+				}
+			}
+			return true
+		}
+
+		done := ready(0, 0)
+		if item.Type == models.TvShow {
+			done = len(h.Episodes) > 0
+			for _, n := range h.Episodes {
+				done = done && ready(h.Season, n)
+			}
+		}
+		if !done {
+			continue
+		}
+
+		if !naming.Inside(h.Message, root) {
+			log.Warn("plex.clean: file is outside the library folder", log.String("mediaId", item.Id), log.String("path", h.Message))
+			continue
+		}
+		if _, err := os.Stat(h.Message); os.IsNotExist(err) {
+			continue
+		}
+
+		if err := os.Remove(h.Message); err != nil && !os.IsNotExist(err) {
+			log.Error("plex.clean: unable to delete file", log.String("path", h.Message), log.Err(err))
+			return err
+		}
+		log.Info("plex.clean: deleted watched file", log.String("mediaId", item.Id), log.String("path", h.Message))
+
+		if _, err := library.SetMissing(store.Media, item.Id, h.Season, h.Episodes); err != nil {
+			return err
+		}
+		if _, err := history.Record(store.History, models.History {
+			Type:     models.HistoryDeleted,
+			MediaId:  item.Id,
+			Title:    item.Title,
+			Release:  h.Release,
+			Season:   h.Season,
+			Episodes: h.Episodes,
+			Quality:  h.Quality,
+			Message:  h.Message,
+		}); err != nil {
+			return err
+		}
+		Refresh(item.Type, filepath.Dir(h.Message))
+	}
+	return nil
+}
+
+// requesters returns the users who must watch media before it is deleted:
+// everyone who requested it when WaitForRequesters is set, and otherwise
+// anyone, represented by an empty name.
+func requesters(store *storage.Store, mediaId string) ([]string, error) {
+	anyone := []string{""}
+	if !Cleanup.WaitForRequesters {
+		return anyone, nil
+	}
+
+	list, err := store.Requests.List()
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]string, 0)
+	for _, r := range list {
+		if r.MediaId == mediaId && r.Status != models.RequestDenied {
+			users = append(users, r.RequestedBy...)
+		}
+	}
+	if len(users) == 0 {
+		return anyone, nil
+	}
+	return users, nil
+}
+
+// finished returns true if the user, or anyone if user is empty, watched
+// the movie or episode to the end between after and before.
+func finished(watches []models.Watch, mediaId string, season int, episode int, user string, after time.Time, before time.Time) bool {
+	for _, w := range watches {
+		if w.Action != models.WatchFinished || w.MediaId != mediaId || w.Season != season || w.Episode != episode {
+			continue
+		}
+		if (len(user) == 0 || w.User == user) && w.Date.After(after) && w.Date.Before(before) {
+			return true
+		}
+	}
+	return false
+}
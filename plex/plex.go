@@ -0,0 +1,230 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package plex keeps MEX in step with the Plex Media Server. Plex is asked
+// to scan each folder MEX imports into, so new media shows up at once, and
+// the server's libraries are read to find the movies and episodes that are
+// already there. Plex webhooks report new media as it arrives and what
+// users watch, which can trigger rules that delete watched media. Titles
+// are matched by the IMDb, TMDB and TVDB IDs in their Plex GUIDs.
+package plex
+
+import (
+	"context"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/clients/pms"
+	"github.com/MediaExchange/mex/library"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/requests"
+	"github.com/MediaExchange/mex/storage"
+	"path/filepath"
+	"strings"
+)
+
+// Summary counts what a sync found.
+type Summary struct {
+	Titles      int     `json:"titles"`     // Movies and shows in the Plex libraries.
+	Matched     int     `json:"matched"`    // Library items found in Plex.
+	Updated     int     `json:"updated"`    // Library items with movies or episodes newly marked as downloaded.
+}
+
+// Run returns a function for services.NewTicker that syncs with Plex.
+func Run(store *storage.Store) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		if !pms.Configured() {
+			return
+		}
+		if _, err := Sync(ctx, store); err != nil {
+			log.Error("plex.Run: sync failed", log.Err(err))
+		}
+	}
+}
+
+// Sync reads the Plex libraries and marks the library's movies and
+// episodes that Plex has as downloaded. Approved requests for titles that
+// are then complete become available.
+func Sync(ctx context.Context, store *storage.Store) (*Summary, error) {
+	libraries, err := pms.Libraries()
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &Summary{}
+	index := make(map[string]*pms.Item)
+	for _, l := range libraries {
+		if l.Type != pms.MovieLibrary && l.Type != pms.ShowLibrary {
+			continue
+		}
+
+		items, err := pms.Items(l.Key)
+		if err != nil {
+			return nil, err
+		}
+		summary.Titles += len(items)
+		for i := range items {
+			for _, id := range items[i].Ids() {
+				index[id] = &items[i]
+			}
+		}
+	}
+
+	list, err := store.Media.List()
+	if err != nil {
+		return nil, err
+	}
+	approved, err := requests.List(store.Requests, models.RequestApproved)
+	if err != nil {
+		return nil, err
+	}
+	requested := make(map[string]bool, len(approved))
+	for _, r := range approved {
+		requested[r.MediaId] = true
+	}
+
+	for i := range list {
+		if ctx.Err() != nil {
+			return summary, ctx.Err()
+		}
+
+		item := &list[i]
+		found := find(index, item)
+		if found == nil {
+			continue
+		}
+		summary.Matched++
+
+		updated, err := present(store, item, found)
+		if err != nil {
+			log.Warn("plex.Sync: unable to update library item", log.String("id", item.Id), log.Err(err))
+			continue
+		}
+		if updated != nil {
+			summary.Updated++
+			item = updated
+		}
+
+		if requested[item.Id] {
+			if err := requests.MarkAvailable(store, item); err != nil {
+				log.Warn("plex.Sync: unable to mark requests available", log.String("id", item.Id), log.Err(err))
+			}
+		}
+	}
+
+	log.Info("plex.Sync", log.Int64("titles", int64(summary.Titles)), log.Int64("matched", int64(summary.Matched)), log.Int64("updated", int64(summary.Updated)))
+	return summary, nil
+}
+
+// Refresh asks Plex to scan a folder MEX just imported media into. The
+// folder is scanned on its own if a library of the media's type contains
+// it. Otherwise, such as when Plex runs in a container that sees other
+// paths, every library of that type is scanned.
+func Refresh(typ models.MediaType, folder string) {
+	if !pms.Configured() {
+		return
+	}
+
+	libraries, err := pms.Libraries()
+	if err != nil {
+		log.Warn("plex.Refresh: unable to list libraries", log.Err(err))
+		return
+	}
+
+	want := pms.MovieLibrary
+	if typ == models.TvShow {
+		want = pms.ShowLibrary
+	}
+
+	matched := make([]pms.Library, 0)
+	for _, l := range libraries {
+		if l.Type != want {
+			continue
+		}
+		for _, loc := range l.Locations {
+			if within(folder, loc.Path) {
+				if err := pms.Refresh(l.Key, folder); err != nil {
+					log.Warn("plex.Refresh: unable to refresh folder", log.String("library", l.Title), log.String("path", folder), log.Err(err))
+				}
+				return
+			}
+		}
+		matched = append(matched, l)
+	}
+
+	log.Info("plex.Refresh: no library contains the folder, refreshing every library", log.String("path", folder), log.String("type", want))
+	for _, l := range matched {
+		if err := pms.Refresh(l.Key, ""); err != nil {
+			log.Warn("plex.Refresh: unable to refresh library", log.String("library", l.Title), log.Err(err))
+		}
+	}
+}
+
+// find returns the Plex title with the library item's ID or IMDb ID, or nil.
+func find(index map[string]*pms.Item, item *models.MediaItem) *pms.Item {
+	if found, ok := index[item.Id]; ok {
+		return found
+	}
+	if len(item.Details.ImdbId) > 0 {
+		if found, ok := index["imdb:" + item.Details.ImdbId]; ok {
+			return found
+		}
+	}
+	return nil
+}
+
+// present marks a movie, or the episodes of a show that Plex has, as
+// downloaded. It returns the updated item, or nil if nothing changed.
+func present(store *storage.Store, item *models.MediaItem, found *pms.Item) (*models.MediaItem, error) {
+	if item.Type == models.Movie {
+		if item.State == models.Downloaded {
+			return nil, nil
+		}
+		return library.SetDownloaded(store.Media, item.Id, 0, nil)
+	}
+
+	// Shows with every episode downloaded don't need their episodes read.
+	if !library.HasState(item, models.Wanted) && !library.HasState(item, models.Missing) {
+		return nil, nil
+	}
+
+	episodes, err := pms.Episodes(found.RatingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Episodes not yet marked as downloaded, by season.
+	missing := make(map[int][]int)
+	for _, e := range episodes {
+		if le := item.FindEpisode(e.ParentIndex, e.Index); le != nil && le.State != models.Downloaded {
+			missing[e.ParentIndex] = append(missing[e.ParentIndex], e.Index)
+		}
+	}
+
+	var updated *models.MediaItem
+	for season, numbers := range missing {
+		if updated, err = library.SetDownloaded(store.Media, item.Id, season, numbers); err != nil {
+			return nil, err
+		}
+	}
+	return updated, nil
+}
+
+// within returns true if path is folder or inside it. Plex on Windows
+// reports paths with backslashes.
+func within(path string, folder string) bool {
+	path = filepath.ToSlash(path)
+	folder = strings.TrimRight(strings.ReplaceAll(folder, "\\", "/"), "/")
+	return len(folder) > 0 && (path == folder || strings.HasPrefix(path, folder + "/"))
+}
@@ -0,0 +1,266 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package plex
+
+import (
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/clients/pms"
+	"github.com/MediaExchange/mex/library"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/requests"
+	"github.com/MediaExchange/mex/storage"
+	"strings"
+	"time"
+)
+
+// Webhook events MEX acts on.
+const (
+	EventLibraryNew = "library.new"       // Media was added to a library.
+	EventPlay       = "media.play"        // A user started playing media.
+	EventScrobble   = "media.scrobble"    // A user watched most of the media.
+)
+
+var (
+	// WebhookSecret must be sent as the `secret` query parameter of each
+	// webhook. Webhooks are refused while it is empty.
+	WebhookSecret string
+)
+
+// Payload is the JSON part of a Plex webhook.
+type Payload struct {
+	Event       string      `json:"event"`          // One of the Event constants, or another event MEX ignores.
+	Owner       bool        `json:"owner"`          // True if the server's owner caused the event.
+	Account     Account     `json:"Account"`        // Plex user who caused the event.
+	Player      Player      `json:"Player"`         // Device that played the media.
+	Metadata    Metadata    `json:"Metadata"`       // The movie, show, season or episode.
+}
+
+// Account is the Plex user in a webhook.
+type Account struct {
+	Id          int64       `json:"id"`
+	Title       string      `json:"title"`          // Plex username.
+}
+
+// Player is the device in a webhook.
+type Player struct {
+	Title       string      `json:"title"`
+	Uuid        string      `json:"uuid"`
+}
+
+// Metadata is the media in a webhook.
+type Metadata struct {
+	pms.Item
+	LibrarySectionType   string `json:"librarySectionType"`     // movie or show.
+	ParentRatingKey      string `json:"parentRatingKey"`        // Season of an episode, or show of a season.
+	GrandparentRatingKey string `json:"grandparentRatingKey"`   // Show of an episode.
+	GrandparentTitle     string `json:"grandparentTitle"`       // Name of the show of an episode.
+}
+
+// WatchFilter limits the entries returned by ListWatches. Empty fields match
+// everything.
+type WatchFilter struct {
+	User    string
+	MediaId string
+}
+
+// Handle acts on a webhook. New movies and episodes are marked as
+// downloaded, and plays and scrobbles are recorded in the watch history for
+// Clean. Other events are ignored.
+func Handle(store *storage.Store, p *Payload) error {
+	switch p.Event {
+	case EventLibraryNew:
+		return added(store, &p.Metadata)
+
+	case EventPlay:
+		_, err := watched(store, p, models.WatchStarted)
+		return err
+
+	case EventScrobble:
+		_, err := watched(store, p, models.WatchFinished)
+		return err
+	}
+	return nil
+}
+
+// added marks new media in Plex as downloaded.
+func added(store *storage.Store, m *Metadata) error {
+	item, err := resolve(store, m)
+	if err != nil || item == nil {
+		return err
+	}
+
+	var updated *models.MediaItem
+	switch m.Type {
+	case "movie":
+		updated, err = present(store, item, &m.Item)
+
+	case "episode":
+		if e := item.FindEpisode(m.ParentIndex, m.Index); e != nil && e.State != models.Downloaded {
+			updated, err = library.SetDownloaded(store.Media, item.Id, m.ParentIndex, []int{m.Index})
+		}
+
+	case "show", "season":
+		// Plex sends one event for a show or season when many episodes
+		// arrive at once, so the episodes are read from the server.
+		key := m.RatingKey
+		if m.Type == "season" {
+			key = m.ParentRatingKey
+		}
+		if pms.Configured() {
+			updated, err = present(store, item, &pms.Item{RatingKey: key})
+		}
+	}
+	if err != nil || updated == nil {
+		return err
+	}
+
+	log.Info("plex.added", log.String("mediaId", item.Id), log.String("type", m.Type), log.String("title", m.Title))
+	return requests.MarkAvailable(store, updated)
+}
+
+// watched records a play or scrobble in the watch history. The media
+// doesn't have to be in the library.
+func watched(store *storage.Store, p *Payload, action models.WatchAction) (*models.Watch, error) {
+	item, err := resolve(store, &p.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &p.Metadata
+	w := &models.Watch {
+		Action:   action,
+		User:     username(store.Users, p.Account),
+		PlexUser: p.Account.Title,
+		Title:    m.Title,
+		Player:   p.Player.Title,
+		Date:     time.Now(),
+	}
+	if m.Type == "episode" {
+		w.Title = m.GrandparentTitle
+		w.Season = m.ParentIndex
+		w.Episode = m.Index
+	}
+	if item != nil {
+		w.MediaId = item.Id
+		w.Title = item.Title
+	}
+
+	if err := store.Watches.Save(w); err != nil {
+		log.Error("plex.watched: unable to save entry", log.String("user", w.User), log.Err(err))
+		return nil, err
+	}
+	log.Info("plex.watched", log.String("action", string(action)), log.String("user", w.User), log.String("title", w.Title))
+	return w, nil
+}
+
+// ListWatches returns the watch history entries that match the filter,
+// newest first.
+func ListWatches(repo storage.WatchRepository, filter WatchFilter) ([]models.Watch, error) {
+	all, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.Watch, 0, len(all))
+	for i := len(all) - 1; i >= 0; i-- {
+		w := all[i]
+		if len(filter.User) > 0 && w.User != filter.User {
+			continue
+		}
+		if len(filter.MediaId) > 0 && w.MediaId != filter.MediaId {
+			continue
+		}
+		list = append(list, w)
+	}
+	return list, nil
+}
+
+// resolve returns the library item of a movie, show, season or episode, or
+// nil if it isn't in the library. The GUIDs of episodes from the current
+// Plex agents are the episode's own, so the show is read from the server
+// to find its IDs. Legacy GUIDs start with the show's ID.
+func resolve(store *storage.Store, m *Metadata) (*models.MediaItem, error) {
+	var ids []string
+	switch m.Type {
+	case "movie", "show":
+		ids = m.Ids()
+
+	case "season", "episode":
+		ids = (&pms.Item{Guid: m.Guid}).Ids()
+		key := m.GrandparentRatingKey
+		if m.Type == "season" {
+			key = m.ParentRatingKey
+		}
+		if len(ids) == 0 && len(key) > 0 && pms.Configured() {
+			show, err := pms.Metadata(key)
+			if err != nil {
+				return nil, err
+			}
+			ids = show.Ids()
+		}
+	}
+	return lookup(store.Media, ids)
+}
+
+// lookup returns the library item with any of the IDs, or nil.
+func lookup(repo storage.MediaRepository, ids []string) (*models.MediaItem, error) {
+	var list []models.MediaItem
+	for _, id := range ids {
+		if !strings.HasPrefix(id, "imdb:") {
+			item, err := repo.Get(id)
+			if err == nil {
+				return item, nil
+			}
+			if err != storage.ErrNotFound {
+				return nil, err
+			}
+			continue
+		}
+
+		// Library items are keyed by their TMDB or TVDB ID.
+		if list == nil {
+			var err error
+			if list, err = repo.List(); err != nil {
+				return nil, err
+			}
+		}
+		for i := range list {
+			if list[i].Details.ImdbId == strings.TrimPrefix(id, "imdb:") {
+				return &list[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// username returns the MEX user linked to a Plex account, or the Plex
+// username if there isn't one.
+func username(repo storage.UserRepository, a Account) string {
+	if users, err := repo.List(); err == nil {
+		for _, u := range users {
+			if u.PlexId > 0 && u.PlexId == a.Id {
+				return u.Username
+			}
+		}
+	}
+
+	// Webhooks give the server owner's account ID as 1, so users who signed
+	// in with Plex are also matched by name.
+	if u, err := repo.Get(a.Title); err == nil && u.PlexId > 0 {
+		return u.Username
+	}
+	return a.Title
+}
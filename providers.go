@@ -0,0 +1,136 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/clients/tmdb"
+	"github.com/MediaExchange/mex/clients/tvdb"
+	"github.com/MediaExchange/mex/health"
+	"github.com/MediaExchange/mex/services"
+	"sync"
+	"time"
+)
+
+const (
+	// Used when clients.check_interval is not configured.
+	defaultCheckInterval = 5 * time.Minute
+
+	// Wait between failed login attempts.
+	minLoginBackoff = 10 * time.Second
+	maxLoginBackoff = 10 * time.Minute
+)
+
+// provider is a media provider that MEX searches.
+type provider struct {
+	name  string        // Name used in IDs, e.g. "tmdb" in "tmdb:299534".
+	login func() error  // Authenticates with the provider.
+	ping  func() error  // Verifies the provider is reachable.
+}
+
+var (
+	// The login retry of each provider that has needed one. Each provider
+	// has one, which is started again after every outage.
+	retryMutex sync.Mutex
+	retries    = make(map[string]*services.Retry)
+)
+
+// newProviders returns every media provider MEX knows about.
+func newProviders(conf *MexConfig) []provider {
+	return []provider {
+		{
+			name:  "tmdb",
+			login: func() error { return tmdb.Login(conf.Clients.TmdbApiKey) },
+			ping:  tmdb.Ping,
+		},
+		{
+			name:  "tvdb",
+			login: func() error { return tvdb.Login(conf.Clients.TvdbApiKey) },
+			ping:  tvdb.Ping,
+		},
+	}
+}
+
+// loginProviders authenticates with each provider. A provider that can't be
+// logged in to is marked unavailable and retried in the background, so MEX
+// keeps serving whatever providers are working.
+func loginProviders(list []provider) {
+	for _, p := range list {
+		if err := login(p); err != nil {
+			retryLogin(p, err)
+		}
+	}
+}
+
+// retryLogin keeps trying to log in to a provider in the background until it
+// succeeds. Only one retry runs per provider.
+func retryLogin(p provider, err error) {
+	retryMutex.Lock()
+	defer retryMutex.Unlock()
+
+	log.Warn("Provider unavailable, retrying in the background", log.String("provider", p.name), log.Err(err))
+	if r, ok := retries[p.name]; ok {
+		_ = r.Start()
+		return
+	}
+
+	r := services.NewRetry(p.name + " login", minLoginBackoff, maxLoginBackoff, func(ctx context.Context) error {
+		return login(p)
+	})
+	retries[p.name] = r
+	_ = services.Register(r)
+}
+
+// login authenticates with a single provider and records the result.
+func login(p provider) error {
+	err := p.login()
+	health.SetAuthenticated(p.name, err)
+	if err == nil {
+		log.Info("Provider available", log.String("provider", p.name))
+	}
+	return err
+}
+
+// checkInterval returns how often the providers should be checked.
+func checkInterval(conf *MexConfig) time.Duration {
+	if conf.Clients.CheckInterval <= 0 {
+		return defaultCheckInterval
+	}
+	return seconds(conf.Clients.CheckInterval)
+}
+
+// checkProviders returns a function that records whether each provider is
+// currently reachable. Providers that aren't logged in are left to their
+// login retry.
+func checkProviders(list []provider) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		for _, p := range list {
+			if !health.Provider(p.name).Authenticated {
+				continue
+			}
+
+			err := p.ping()
+			health.SetReachable(p.name, err)
+			if err != nil {
+				// An expired token looks the same as an outage. Logging in again fixes the former.
+				if err := login(p); err != nil {
+					retryLogin(p, err)
+				}
+			}
+		}
+	}
+}
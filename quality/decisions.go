@@ -0,0 +1,307 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package quality
+
+import (
+	"fmt"
+	"github.com/MediaExchange/mex/clients/download"
+	"github.com/MediaExchange/mex/library"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/parser"
+	"sort"
+	"strings"
+)
+
+// Decide judges each release of the media against the profile and returns
+// the decisions with the accepted releases first, best first. Season and
+// episode are what was searched for, as with releases.Search. Current is
+// the quality of the copy already downloaded, or empty if there isn't one;
+// only upgrades of it are accepted.
+func Decide(profile *models.QualityProfile, details *models.Details, season int, episode int, current string, releases []models.Release) []models.Decision {
+	decisions := make([]models.Decision, 0, len(releases))
+	for _, r := range releases {
+		decisions = append(decisions, Evaluate(profile, details, season, episode, current, r))
+	}
+
+	sort.SliceStable(decisions, func(i, j int) bool {
+		return better(profile, &decisions[i], &decisions[j])
+	})
+	return decisions
+}
+
+// Evaluate judges a single release against the profile, as with Decide.
+func Evaluate(profile *models.QualityProfile, details *models.Details, season int, episode int, current string, r models.Release) models.Decision {
+	d := models.Decision {
+		Release:    r,
+		Parsed:     parser.Parse(r.Title),
+		Rejections: make([]string, 0),
+	}
+	d.Quality = Of(d.Parsed)
+
+	reject := func(format string, args ...interface{}) {
+		d.Rejections = append(d.Rejections, fmt.Sprintf(format, args...))
+	}
+
+	if !SameMedia(details, &r, &d.Parsed) {
+		reject("Title %q doesn't match %q", d.Parsed.Title, details.Title)
+	}
+
+	if details.Type == models.Movie {
+		year := library.Year(details.ReleaseDate)
+		if d.Parsed.Year > 0 && year > 0 && (d.Parsed.Year < year - 1 || d.Parsed.Year > year + 1) {
+			reject("Year %d doesn't match %d", d.Parsed.Year, year)
+		}
+		if len(d.Parsed.Seasons) > 0 || len(d.Parsed.AirDate) > 0 || len(d.Parsed.Absolute) > 0 {
+			reject("Is a TV release, not a movie")
+		}
+	} else if reason := numbering(details, season, episode, &d.Parsed); len(reason) > 0 {
+		reject("%s", reason)
+	}
+
+	if index(profile.Qualities, d.Quality) < 0 {
+		if d.Quality == Unknown {
+			reject("Quality is unknown and the %s profile doesn't allow it", profile.Name)
+		} else {
+			reject("%s isn't allowed by the %s profile", d.Quality, profile.Name)
+		}
+	}
+
+	if len(current) > 0 {
+		if Met(profile, current) {
+			reject("%s is already downloaded, which meets the %s cutoff", current, profile.Cutoff)
+		} else if !Upgrade(profile, current, d.Quality) {
+			reject("%s isn't an upgrade of %s", d.Quality, current)
+		}
+	}
+
+	for _, w := range profile.Forbidden {
+		if hasWord(r.Title, w) {
+			reject("Contains the forbidden word %q", w)
+		}
+	}
+
+	for _, p := range profile.Preferred {
+		if hasWord(r.Title, p.Word) {
+			d.Score += p.Score
+		}
+	}
+
+	if minutes := runtime(details, &d.Parsed); minutes > 0 && r.Size > 0 {
+		mb := float64(r.Size) / (1024 * 1024)
+		if profile.MinSize > 0 && mb < profile.MinSize * float64(minutes) {
+			reject("%s is smaller than the minimum of %s for %d minutes", size(mb), size(profile.MinSize * float64(minutes)), minutes)
+		}
+		if profile.MaxSize > 0 && mb > profile.MaxSize * float64(minutes) {
+			reject("%s is larger than the maximum of %s for %d minutes", size(mb), size(profile.MaxSize * float64(minutes)), minutes)
+		}
+	}
+
+	if r.Protocol == string(download.Torrent) && r.Seeders == 0 {
+		reject("Torrent has no seeders")
+	}
+
+	d.Accepted = len(d.Rejections) == 0
+	return d
+}
+
+// Met returns true if a copy of quality q is good enough that the profile
+// doesn't want upgrades.
+func Met(profile *models.QualityProfile, q string) bool {
+	i := index(profile.Qualities, q)
+	return i >= 0 && i <= index(profile.Qualities, profile.Cutoff)
+}
+
+// Upgrade returns true if the profile prefers quality q to the current
+// quality. Any allowed quality is better than one the profile doesn't allow.
+func Upgrade(profile *models.QualityProfile, current string, q string) bool {
+	i := index(profile.Qualities, q)
+	c := index(profile.Qualities, current)
+	return i >= 0 && (c < 0 || i < c)
+}
+
+// better returns true if decision a should be chosen over b.
+func better(profile *models.QualityProfile, a *models.Decision, b *models.Decision) bool {
+	if a.Accepted != b.Accepted {
+		return a.Accepted
+	}
+
+	// Qualities the profile doesn't allow sort after those it does.
+	qa, qb := index(profile.Qualities, a.Quality), index(profile.Qualities, b.Quality)
+	if qa < 0 {
+		qa = len(profile.Qualities)
+	}
+	if qb < 0 {
+		qb = len(profile.Qualities)
+	}
+	if qa != qb {
+		return qa < qb
+	}
+
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+
+	// Fixed releases are better than the ones they replace.
+	fa, fb := a.Parsed.Proper || a.Parsed.Repack, b.Parsed.Proper || b.Parsed.Repack
+	if fa != fb {
+		return fa
+	}
+	if a.Parsed.Version != b.Parsed.Version {
+		return a.Parsed.Version > b.Parsed.Version
+	}
+
+	// Well seeded torrents finish sooner.
+	if a.Release.Seeders != b.Release.Seeders {
+		return a.Release.Seeders > b.Release.Seeders
+	}
+	return a.Release.Published.After(b.Release.Published)
+}
+
+// SameMedia returns true if the release is of the media. Matching IDs from
+// the indexer are trusted, otherwise the titles must match.
+func SameMedia(details *models.Details, r *models.Release, parsed *parser.Result) bool {
+	if len(r.ImdbId) > 0 && r.ImdbId == details.ImdbId {
+		return true
+	}
+	if provider, id, err := library.ParseId(details.Id); err == nil && provider == "tvdb" && r.TvdbId == id {
+		return true
+	}
+
+	title := parser.Normalize(parsed.Title)
+	if len(title) == 0 {
+		return false
+	}
+
+	// Titles such as "Doctor Who (2005)" include the year, which release
+	// names keep separate.
+	want := parser.Normalize(details.Title)
+	if title == want {
+		return true
+	}
+	year := library.Year(details.ReleaseDate)
+	return year > 0 && want == title + fmt.Sprint(year)
+}
+
+// numbering returns why a TV release doesn't contain what was searched for,
+// or an empty string if it does.
+func numbering(details *models.Details, season int, episode int, parsed *parser.Result) string {
+	switch {
+	case season > 0 && episode > 0:
+		if parsed.FullSeason {
+			return "Is a season pack, not a single episode"
+		}
+		if hasInt(parsed.Seasons, season) && hasInt(parsed.Episodes, episode) {
+			return ""
+		}
+
+		// Daily and anime releases are matched through the episode's air
+		// date or absolute number.
+		for _, e := range details.Episodes {
+			if e.Season == season && e.Episode == episode {
+				if len(parsed.AirDate) > 0 && parsed.AirDate == e.AirDate {
+					return ""
+				}
+				if e.Number > 0 && hasInt(parsed.Absolute, e.Number) {
+					return ""
+				}
+			}
+		}
+		return fmt.Sprintf("Doesn't contain S%02dE%02d", season, episode)
+
+	case season > 0:
+		if parsed.FullSeason && hasInt(parsed.Seasons, season) {
+			return ""
+		}
+		return fmt.Sprintf("Isn't a season %d pack", season)
+
+	default:
+		if len(parsed.Seasons) > 0 || len(parsed.AirDate) > 0 || len(parsed.Absolute) > 0 {
+			return ""
+		}
+		return "Has no season or episode numbers"
+	}
+}
+
+// runtime returns the minutes of video expected in the release, or 0 if
+// the runtime isn't known.
+func runtime(details *models.Details, parsed *parser.Result) int {
+	if details.Runtime <= 0 {
+		return 0
+	}
+	if details.Type == models.Movie {
+		return details.Runtime
+	}
+
+	count := len(parsed.Episodes)
+	if len(parsed.Absolute) > 0 {
+		count = len(parsed.Absolute)
+	}
+	if len(parsed.AirDate) > 0 {
+		count = 1
+	}
+	if parsed.FullSeason {
+		count = 0
+		for _, e := range details.Episodes {
+			if hasInt(parsed.Seasons, e.Season) {
+				count++
+			}
+		}
+	}
+	return count * details.Runtime
+}
+
+// hasWord returns true if the release name contains the word or words,
+// ignoring case and the separators between words.
+func hasWord(title string, word string) bool {
+	return strings.Contains(words(title), words(word))
+}
+
+// words lowercases s and replaces separators with single spaces, with a
+// space at each end so only whole words match.
+func words(s string) string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(c rune) bool {
+		return strings.ContainsRune(" ._-[](){}", c)
+	})
+	return " " + strings.Join(fields, " ") + " "
+}
+
+// size formats a number of megabytes.
+func size(mb float64) string {
+	if mb >= 1024 {
+		return fmt.Sprintf("%.1f GB", mb / 1024)
+	}
+	return fmt.Sprintf("%.0f MB", mb)
+}
+
+// index returns the position of s in list, or -1.
+func index(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasInt returns true if list has n.
+func hasInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,229 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package quality
+
+import (
+	"errors"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/storage"
+	"strings"
+)
+
+var (
+	// ErrInvalidProfile is returned when a profile is missing a name or qualities.
+	ErrInvalidProfile = errors.New("quality: profile must have a name and at least one quality")
+
+	// ErrUnknownQuality is returned when a profile lists a quality MEX doesn't recognize.
+	ErrUnknownQuality = errors.New("quality: unknown quality")
+
+	// ErrInvalidCutoff is returned when the cutoff isn't one of the profile's qualities.
+	ErrInvalidCutoff = errors.New("quality: cutoff must be one of the profile's qualities")
+
+	// ErrInvalidSize is returned when the size limits are negative or the wrong way around.
+	ErrInvalidSize = errors.New("quality: minimum and maximum sizes must be positive, and the minimum no larger than the maximum")
+
+	// ErrInvalidWord is returned when a preferred or forbidden word is empty.
+	ErrInvalidWord = errors.New("quality: preferred and forbidden words must not be empty")
+
+	// ErrProfileExists is returned when a profile's name is taken.
+	ErrProfileExists = errors.New("quality: profile name is already taken")
+
+	// ErrProfileInUse is returned when deleting a profile library items still use.
+	ErrProfileInUse = errors.New("quality: profile is used by library items")
+
+	// ErrLastProfile is returned when deleting the only profile.
+	ErrLastProfile = errors.New("quality: the last profile can't be deleted")
+)
+
+// Profiles created the first time MEX starts. The first becomes the default.
+var defaults = []models.QualityProfile {
+	{
+		Name:      "HD",
+		Qualities: []string{"Bluray-1080p", "WEBDL-1080p", "WEBRip-1080p", "HDTV-1080p", "Bluray-720p", "WEBDL-720p", "WEBRip-720p", "HDTV-720p"},
+		Cutoff:    "WEBDL-1080p",
+	},
+	{
+		Name:      "Ultra HD",
+		Qualities: []string{"Remux-2160p", "Bluray-2160p", "WEBDL-2160p", "WEBRip-2160p", "HDTV-2160p"},
+		Cutoff:    "WEBDL-2160p",
+	},
+	{
+		Name:      "Any",
+		Qualities: []string{
+			"Remux-2160p", "Bluray-2160p", "WEBDL-2160p", "WEBRip-2160p", "HDTV-2160p",
+			"Remux-1080p", "Bluray-1080p", "WEBDL-1080p", "WEBRip-1080p", "HDTV-1080p",
+			"Bluray-720p", "WEBDL-720p", "WEBRip-720p", "HDTV-720p",
+			"Bluray-576p", "Bluray-480p", "WEBDL-480p", "WEBRip-480p", "DVD", "SDTV",
+		},
+		Cutoff:    "WEBDL-720p",
+	},
+}
+
+// CreateDefaults adds the default profiles when there are none.
+func CreateDefaults(repo storage.ProfileRepository) error {
+	list, err := repo.List()
+	if err != nil {
+		log.Error("quality.CreateDefaults: unable to list profiles", log.Err(err))
+		return err
+	}
+	if len(list) > 0 {
+		return nil
+	}
+
+	for _, p := range defaults {
+		p := p
+		p.Preferred = make([]models.PreferredWord, 0)
+		p.Forbidden = make([]string, 0)
+		if err := repo.Save(&p); err != nil {
+			log.Error("quality.CreateDefaults: unable to save profile", log.String("name", p.Name), log.Err(err))
+			return err
+		}
+		log.Info("quality.CreateDefaults: created profile", log.String("name", p.Name))
+	}
+	return nil
+}
+
+// Profile returns the profile with the ID, or the default profile when id is
+// 0. The default is the oldest profile.
+func Profile(repo storage.ProfileRepository, id uint64) (*models.QualityProfile, error) {
+	if id != 0 {
+		return repo.Get(id)
+	}
+
+	list, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	return &list[0], nil
+}
+
+// Save validates and stores a profile. Profiles without an ID are created.
+func Save(repo storage.ProfileRepository, p *models.QualityProfile) error {
+	if err := validate(p); err != nil {
+		return err
+	}
+
+	if p.Id != 0 {
+		if _, err := repo.Get(p.Id); err != nil {
+			return err
+		}
+	}
+
+	list, err := repo.List()
+	if err != nil {
+		return err
+	}
+	for _, other := range list {
+		if other.Id != p.Id && strings.EqualFold(other.Name, p.Name) {
+			return ErrProfileExists
+		}
+	}
+
+	if err := repo.Save(p); err != nil {
+		log.Error("quality.Save: unable to save profile", log.String("name", p.Name), log.Err(err))
+		return err
+	}
+	log.Info("quality.Save", log.Int64("id", int64(p.Id)), log.String("name", p.Name))
+	return nil
+}
+
+// Delete removes a profile that no library item uses. Items using the
+// default profile keep working, because the next oldest becomes the default.
+func Delete(store *storage.Store, id uint64) error {
+	if _, err := store.Profiles.Get(id); err != nil {
+		return err
+	}
+
+	list, err := store.Profiles.List()
+	if err != nil {
+		return err
+	}
+	if len(list) == 1 {
+		return ErrLastProfile
+	}
+
+	items, err := store.Media.List()
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if item.ProfileId == id {
+			return ErrProfileInUse
+		}
+	}
+
+	if err := store.Profiles.Delete(id); err != nil {
+		log.Error("quality.Delete: unable to delete profile", log.Int64("id", int64(id)), log.Err(err))
+		return err
+	}
+	log.Info("quality.Delete", log.Int64("id", int64(id)))
+	return nil
+}
+
+// validate checks a profile and tidies up its lists.
+func validate(p *models.QualityProfile) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if len(p.Name) == 0 || len(p.Qualities) == 0 {
+		return ErrInvalidProfile
+	}
+
+	seen := make(map[string]bool)
+	unique := make([]string, 0, len(p.Qualities))
+	for _, q := range p.Qualities {
+		if !Valid(q) {
+			return ErrUnknownQuality
+		}
+		if !seen[q] {
+			seen[q] = true
+			unique = append(unique, q)
+		}
+	}
+	p.Qualities = unique
+
+	if !seen[p.Cutoff] {
+		return ErrInvalidCutoff
+	}
+
+	if p.MinSize < 0 || p.MaxSize < 0 || (p.MaxSize > 0 && p.MinSize > p.MaxSize) {
+		return ErrInvalidSize
+	}
+
+	if p.Preferred == nil {
+		p.Preferred = make([]models.PreferredWord, 0)
+	}
+	for i := range p.Preferred {
+		p.Preferred[i].Word = strings.TrimSpace(p.Preferred[i].Word)
+		if len(p.Preferred[i].Word) == 0 {
+			return ErrInvalidWord
+		}
+	}
+
+	if p.Forbidden == nil {
+		p.Forbidden = make([]string, 0)
+	}
+	for i := range p.Forbidden {
+		p.Forbidden[i] = strings.TrimSpace(p.Forbidden[i])
+		if len(p.Forbidden[i]) == 0 {
+			return ErrInvalidWord
+		}
+	}
+
+	return nil
+}
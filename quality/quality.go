@@ -0,0 +1,136 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package quality judges releases against quality profiles. Each release
+// name is parsed to find its quality, such as WEBDL-1080p, and the profile
+// of the library item decides whether that quality is wanted, which of the
+// acceptable releases is best and why the others were rejected.
+package quality
+
+import (
+	"github.com/MediaExchange/mex/parser"
+)
+
+// Unknown is the quality of releases whose names don't say.
+const Unknown = "Unknown"
+
+// Every quality MEX recognizes, worst first.
+var qualities = []string {
+	Unknown,
+	"CAM",
+	"TELESYNC",
+	"SCREENER",
+	"SDTV",
+	"DVD",
+	"WEBRip-480p",
+	"WEBDL-480p",
+	"Bluray-480p",
+	"Bluray-576p",
+	"HDTV-720p",
+	"WEBRip-720p",
+	"WEBDL-720p",
+	"Bluray-720p",
+	"HDTV-1080p",
+	"WEBRip-1080p",
+	"WEBDL-1080p",
+	"Bluray-1080p",
+	"Remux-1080p",
+	"HDTV-2160p",
+	"WEBRip-2160p",
+	"WEBDL-2160p",
+	"Bluray-2160p",
+	"Remux-2160p",
+}
+
+// Qualities returns every quality MEX recognizes, worst first.
+func Qualities() []string {
+	return append([]string{}, qualities...)
+}
+
+// Valid returns true if q is a recognized quality.
+func Valid(q string) bool {
+	return Rank(q) >= 0
+}
+
+// Rank orders the qualities from worst to best. Unknown ranks 0 and
+// unrecognized qualities -1.
+func Rank(q string) int {
+	for i, name := range qualities {
+		if name == q {
+			return i
+		}
+	}
+	return -1
+}
+
+// Of returns the quality of a parsed release name.
+func Of(r parser.Result) string {
+	switch r.Source {
+	case parser.SourceCam:
+		return "CAM"
+	case parser.SourceTelesync:
+		return "TELESYNC"
+	case parser.SourceScreener:
+		return "SCREENER"
+	case parser.SourceDVD:
+		return "DVD"
+	case parser.SourceSDTV:
+		return "SDTV"
+	}
+
+	if r.Remux {
+		if r.Resolution == "2160p" {
+			return "Remux-2160p"
+		}
+		return "Remux-1080p"
+	}
+
+	switch r.Source {
+	case parser.SourceBluRay:
+		switch r.Resolution {
+		case "480p", "576p", "720p", "1080p", "2160p":
+			return "Bluray-" + r.Resolution
+		}
+		// Blu-ray releases that don't say are usually 720p encodes.
+		return "Bluray-720p"
+
+	case parser.SourceWebDL, parser.SourceWebRip:
+		name := "WEBDL-"
+		if r.Source == parser.SourceWebRip {
+			name = "WEBRip-"
+		}
+		switch r.Resolution {
+		case "720p", "1080p", "2160p":
+			return name + r.Resolution
+		}
+		return name + "480p"
+
+	case parser.SourceHDTV, "":
+		// Releases without a source, such as most anime, are treated as
+		// TV captures. HDTV without a resolution is standard definition.
+		switch r.Resolution {
+		case "720p", "1080p", "2160p":
+			return "HDTV-" + r.Resolution
+		case "480p", "576p":
+			return "SDTV"
+		}
+		if r.Source == parser.SourceHDTV {
+			return "SDTV"
+		}
+	}
+
+	return Unknown
+}
@@ -0,0 +1,106 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package releases finds copies of library media on the configured indexers.
+package releases
+
+import (
+	"github.com/MediaExchange/mex/clients/torznab"
+	"github.com/MediaExchange/mex/library"
+	"github.com/MediaExchange/mex/models"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Search looks for releases of the media on every indexer at once. For a TV
+// show, season and episode narrow the search; leave them 0 to search the
+// whole show, or set only season for season packs. An indexer that fails is
+// reported in the response instead of failing the whole search.
+func Search(details *models.Details, season int, episode int) models.ReleaseResponse {
+	q := Query(details, season, episode)
+	indexers := torznab.Indexers()
+
+	results := make([][]models.Release, len(indexers))
+	states := make([]models.ProviderState, len(indexers))
+
+	var wg sync.WaitGroup
+	for i, c := range indexers {
+		wg.Add(1)
+		go func(i int, c *torznab.Client) {
+			defer wg.Done()
+
+			states[i].Name = c.Name()
+			list, err := c.Search(q)
+			if err != nil {
+				// Error was already logged by the client.
+				states[i].Error = err.Error()
+				return
+			}
+			states[i].Available = true
+			results[i] = list
+		}(i, c)
+	}
+	wg.Wait()
+
+	response := models.ReleaseResponse {
+		Releases: make([]models.Release, 0),
+		Indexers: states,
+	}
+	for _, list := range results {
+		response.Releases = append(response.Releases, list...)
+	}
+
+	// Newest first, like the indexers themselves.
+	sort.SliceStable(response.Releases, func(i, j int) bool {
+		return response.Releases[i].Published.After(response.Releases[j].Published)
+	})
+	return response
+}
+
+// Query returns the indexer query for the media.
+func Query(details *models.Details, season int, episode int) torznab.Query {
+	q := torznab.Query {
+		Term:   details.Title,
+		ImdbId: details.ImdbId,
+	}
+
+	provider, id, err := library.ParseId(details.Id)
+	if err == nil {
+		switch provider {
+		case "tvdb":
+			q.TvdbId = id
+		case "tmdb":
+			q.TmdbId = id
+		}
+	}
+
+	if details.Type == models.Movie {
+		q.Type = torznab.MovieSearch
+
+		// Only used when the indexer can't search by ID.
+		if year := library.Year(details.ReleaseDate); year > 0 {
+			q.Term = q.Term + " " + strconv.Itoa(year)
+		}
+	} else {
+		q.Type = torznab.TvSearch
+		q.Season = season
+		if season > 0 {
+			q.Episode = episode
+		}
+	}
+	return q
+}
@@ -0,0 +1,351 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package requests implements the workflow for users to ask for media.
+// Requests start out pending, are approved or denied by an admin, and
+// become available once the media can be watched. Requests for a title that
+// already has an open request are merged into it.
+package requests
+
+import (
+	"errors"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/events"
+	"github.com/MediaExchange/mex/library"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/storage"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidTransition is returned when a request can't move to the requested state.
+	ErrInvalidTransition = errors.New("requests: request can't change to that state")
+
+	// ErrSeasonsForMovie is returned when seasons are requested for a movie.
+	ErrSeasonsForMovie = errors.New("requests: seasons can only be requested for TV shows")
+
+	// Event published when a request moves to each state.
+	transitionEvents = map[models.RequestStatus]string {
+		models.RequestApproved:  events.RequestApproved,
+		models.RequestDenied:    events.RequestDenied,
+		models.RequestAvailable: events.RequestAvailable,
+	}
+
+	// Requests are changed one at a time, so two submissions can't both
+	// create a request for the same title or undo a review made meanwhile.
+	mutex sync.Mutex
+)
+
+// Submit records a request from user for media identified by `provider:id`.
+// Seasons limit a TV show request to those seasons; leave it empty to
+// request a movie or a whole series. If the title already has an open
+// request, the user and seasons are merged into it.
+func Submit(store *storage.Store, mediaId string, seasons []int, user string) (*models.MediaRequest, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	existing, err := find(store.Requests, mediaId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if existing != nil {
+		if existing.Type == models.Movie && len(seasons) > 0 {
+			return nil, ErrSeasonsForMovie
+		}
+
+		existing.RequestedBy = addUser(existing.RequestedBy, user)
+		existing.Seasons = mergeSeasons(existing.Seasons, seasons)
+		existing.Updated = now
+		if err := store.Requests.Save(existing); err != nil {
+			log.Error("requests.Submit: unable to save request", log.Err(err))
+			return nil, err
+		}
+
+		// Seasons added to an approved request are wanted right away.
+		if existing.Status == models.RequestApproved {
+			if err := fulfil(store, existing); err != nil {
+				return nil, err
+			}
+		}
+
+		log.Info("requests.Submit: merged into existing request", log.String("mediaId", mediaId), log.String("user", user))
+		events.Publish(events.RequestSubmitted, existing)
+		return existing, nil
+	}
+
+	details, err := library.Lookup(mediaId)
+	if err != nil {
+		return nil, err
+	}
+
+	if details.Type == models.Movie && len(seasons) > 0 {
+		return nil, ErrSeasonsForMovie
+	}
+
+	r := &models.MediaRequest {
+		MediaId:     details.Id,
+		Type:        details.Type,
+		Title:       details.Title,
+		PosterUri:   details.PosterUri,
+		Seasons:     uniqueSeasons(seasons),
+		RequestedBy: addUser(nil, user),
+		Status:      models.RequestPending,
+		Comments:    make([]models.RequestComment, 0),
+		Created:     now,
+		Updated:     now,
+	}
+
+	if err := store.Requests.Save(r); err != nil {
+		log.Error("requests.Submit: unable to save request", log.Err(err))
+		return nil, err
+	}
+
+	log.Info("requests.Submit", log.String("mediaId", mediaId), log.String("user", user))
+	events.Publish(events.RequestSubmitted, r)
+	return r, nil
+}
+
+// Approve approves a pending request and adds the media to the library so
+// that MEX acquires it.
+func Approve(store *storage.Store, id uint64, admin string, comment string) (*models.MediaRequest, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	r, err := store.Requests.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Status != models.RequestPending {
+		return nil, ErrInvalidTransition
+	}
+
+	if err := fulfil(store, r); err != nil {
+		return nil, err
+	}
+
+	return transition(store, r, models.RequestApproved, admin, comment)
+}
+
+// Deny denies a pending or approved request.
+func Deny(store *storage.Store, id uint64, admin string, comment string) (*models.MediaRequest, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	r, err := store.Requests.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !r.Open() {
+		return nil, ErrInvalidTransition
+	}
+
+	return transition(store, r, models.RequestDenied, admin, comment)
+}
+
+// MarkAvailable marks the approved requests for a library item as available
+// once everything they asked for is downloaded: the movie, or every aired
+// episode of the requested seasons.
+func MarkAvailable(store *storage.Store, item *models.MediaItem) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	list, err := store.Requests.List()
+	if err != nil {
+		return err
+	}
+
+	for i := range list {
+		r := &list[i]
+		if r.MediaId == item.Id && r.Status == models.RequestApproved && library.Available(item, r.Seasons) {
+			if _, err := transition(store, r, models.RequestAvailable, "", ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// List returns the requests in a state, or every request if status is empty.
+// The newest requests come first.
+func List(repo storage.RequestRepository, status models.RequestStatus) ([]models.MediaRequest, error) {
+	list, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]models.MediaRequest, 0, len(list))
+	for _, r := range list {
+		if len(status) == 0 || r.Status == status {
+			matched = append(matched, r)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].Id > matched[j].Id
+	})
+	return matched, nil
+}
+
+// ValidStatus returns true if status is one of the known request states.
+func ValidStatus(status models.RequestStatus) bool {
+	switch status {
+	case models.RequestPending, models.RequestApproved, models.RequestDenied, models.RequestAvailable:
+		return true
+	}
+	return false
+}
+
+// transition moves a request to a new state, recording an optional comment.
+func transition(store *storage.Store, r *models.MediaRequest, status models.RequestStatus, author string, comment string) (*models.MediaRequest, error) {
+	now := time.Now()
+	r.Status = status
+	r.Updated = now
+	if len(comment) > 0 {
+		r.Comments = append(r.Comments, models.RequestComment {
+			Author:  author,
+			Text:    comment,
+			Created: now,
+		})
+	}
+
+	if err := store.Requests.Save(r); err != nil {
+		log.Error("requests.transition: unable to save request", log.Err(err))
+		return nil, err
+	}
+
+	log.Info("requests.transition", log.Int64("id", int64(r.Id)), log.String("status", string(status)))
+	events.Publish(transitionEvents[status], r)
+	return r, nil
+}
+
+// fulfil makes sure the requested media is monitored in the library. For a
+// TV show limited to some seasons, only those seasons' episodes are wanted.
+func fulfil(store *storage.Store, r *models.MediaRequest) error {
+	item, err := store.Media.Get(r.MediaId)
+	if err == storage.ErrNotFound {
+		// Only the requested seasons should become wanted, so add unmonitored first.
+		item, err = library.Add(store.Media, r.MediaId, len(r.Seasons) == 0, 0)
+		if err != nil {
+			return err
+		}
+		if len(r.Seasons) == 0 {
+			return nil
+		}
+	} else if err != nil {
+		return err
+	}
+
+	item.Monitored = true
+	if item.Type == models.Movie && item.State != models.Downloaded {
+		item.State = models.Wanted
+	}
+
+	for i := range item.Episodes {
+		e := &item.Episodes[i]
+		if e.State == models.Downloaded {
+			continue
+		}
+		if wantsSeason(r.Seasons, e.Season) {
+			e.State = models.Wanted
+			e.Unwanted = false
+		}
+	}
+	item.Updated = time.Now()
+
+	if err := store.Media.Save(item); err != nil {
+		return err
+	}
+	events.Publish(events.LibraryUpdated, item)
+	return nil
+}
+
+// find returns the open request for the media, or nil.
+func find(repo storage.RequestRepository, mediaId string) (*models.MediaRequest, error) {
+	list, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range list {
+		if list[i].MediaId == mediaId && list[i].Open() {
+			return &list[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// wantsSeason returns true if the season is covered by a request. Specials
+// (season 0) are only included when asked for by number.
+func wantsSeason(seasons []int, season int) bool {
+	if len(seasons) == 0 {
+		return season != 0
+	}
+
+	for _, s := range seasons {
+		if s == season {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeSeasons combines the seasons of an open request with newly requested
+// seasons. An empty list means the whole series, so merging with one results
+// in the whole series.
+func mergeSeasons(existing []int, requested []int) []int {
+	if len(existing) == 0 || len(requested) == 0 {
+		return make([]int, 0)
+	}
+	return uniqueSeasons(append(append([]int{}, existing...), requested...))
+}
+
+// uniqueSeasons returns the seasons sorted with duplicates removed.
+func uniqueSeasons(seasons []int) []int {
+	seen := make(map[int]bool)
+	unique := make([]int, 0, len(seasons))
+	for _, s := range seasons {
+		if !seen[s] {
+			seen[s] = true
+			unique = append(unique, s)
+		}
+	}
+	sort.Ints(unique)
+	return unique
+}
+
+// addUser adds a user to the list of requesters if they aren't already in it.
+func addUser(users []string, user string) []string {
+	if users == nil {
+		users = make([]string, 0, 1)
+	}
+
+	if len(user) == 0 {
+		return users
+	}
+
+	for _, u := range users {
+		if u == user {
+			return users
+		}
+	}
+	return append(users, user)
+}
@@ -0,0 +1,104 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"github.com/MediaExchange/router"
+	"github.com/MediaExchange/mex/api"
+	"github.com/MediaExchange/mex/auth"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/ui"
+)
+
+// Shorthand for the role each route requires.
+var (
+	viewer    = func(h router.Handler) router.Handler { return auth.Require(models.Viewer, h) }
+	requester = func(h router.Handler) router.Handler { return auth.Require(models.Requester, h) }
+	admin     = func(h router.Handler) router.Handler { return auth.Require(models.Admin, h) }
+)
+
+// newRouter returns the router for every HTTP endpoint. Routes are matched in
+// order, so more specific paths must come before the paths they overlap.
+// Routes not wrapped with a role are open to anyone.
+func newRouter(conf *MexConfig) *router.Router {
+	return router.NewRouter().
+		AddRoute("GET",    "/healthz",                     api.Healthz).
+		AddRoute("GET",    "/readyz",                      api.Readyz).
+		AddRoute("GET",    "/api/auth/setup",              api.GetSetup).
+		AddRoute("POST",   "/api/auth/setup",              api.Setup).
+		AddRoute("POST",   "/api/auth/login",              api.Login).
+		AddRoute("POST",   "/api/auth/logout",             api.Logout).
+		AddRoute("POST",   "/api/auth/plex",               api.StartPlexLogin).
+		AddRoute("POST",   "/api/auth/plex/{id}",          api.FinishPlexLogin).
+		AddRoute("GET",    "/api/auth/me",                 viewer(api.Me)).
+		AddRoute("GET",    "/api/details",                 viewer(api.GetDetails)).
+		AddRoute("GET",    "/api/library",                 viewer(api.ListLibrary)).
+		AddRoute("POST",   "/api/library",                 admin(api.AddLibraryItem)).
+		AddRoute("GET",    "/api/library/scan",            admin(api.ListScanEntries)).
+		AddRoute("POST",   "/api/library/scan",            admin(api.ScanLibrary)).
+		AddRoute("POST",   "/api/library/scan/{id}/resolve", admin(api.ResolveScanEntry)).
+		AddRoute("POST",   "/api/library/scan/{id}/ignore", admin(api.IgnoreScanEntry)).
+		AddRoute("DELETE", "/api/library/scan/{id}",       admin(api.DeleteScanEntry)).
+		AddRoute("PUT",    "/api/library/{id}/episodes",   admin(api.UpdateLibraryEpisodes)).
+		AddRoute("POST",   "/api/library/{id}/seasons/{season}/search", admin(api.SearchLibrarySeason)).
+		AddRoute("POST",   "/api/library/{id}/search",     admin(api.SearchLibraryItem)).
+		AddRoute("GET",    "/api/library/{id}",            viewer(api.GetLibraryItem)).
+		AddRoute("PUT",    "/api/library/{id}",            admin(api.UpdateLibraryItem)).
+		AddRoute("DELETE", "/api/library/{id}",            admin(api.DeleteLibraryItem)).
+		AddRoute("GET",    "/api/requests",                viewer(api.ListRequests)).
+		AddRoute("POST",   "/api/requests",                requester(api.SubmitRequest)).
+		AddRoute("POST",   "/api/requests/{id}/approve",   admin(api.ApproveRequest)).
+		AddRoute("POST",   "/api/requests/{id}/deny",      admin(api.DenyRequest)).
+		AddRoute("GET",    "/api/requests/{id}",           viewer(api.GetRequest)).
+		AddRoute("DELETE", "/api/requests/{id}",           admin(api.DeleteRequest)).
+		AddRoute("GET",    "/api/downloads",               viewer(api.ListDownloads)).
+		AddRoute("POST",   "/api/downloads/{id}/pause",    admin(api.PauseDownload)).
+		AddRoute("POST",   "/api/downloads/{id}/resume",   admin(api.ResumeDownload)).
+		AddRoute("POST",   "/api/downloads/{id}/retry",    admin(api.RetryDownload)).
+		AddRoute("POST",   "/api/downloads/{id}/import",   admin(api.ImportDownload)).
+		AddRoute("GET",    "/api/downloads/{id}",          viewer(api.GetDownload)).
+		AddRoute("DELETE", "/api/downloads/{id}",          admin(api.DeleteDownload)).
+		AddRoute("GET",    "/api/events",                  viewer(api.Events)).
+		AddRoute("GET",    "/api/history",                 viewer(api.ListHistory)).
+		AddRoute("GET",    "/api/blocklist",               viewer(api.ListBlocklist)).
+		AddRoute("DELETE", "/api/blocklist/{id}",          admin(api.DeleteBlocklistEntry)).
+		AddRoute("DELETE", "/api/blocklist",               admin(api.ClearBlocklist)).
+		AddRoute("GET",    "/api/releases/decisions",      admin(api.ListDecisions)).
+		AddRoute("GET",    "/api/releases",                admin(api.ListReleases)).
+		AddRoute("GET",    "/api/naming",                  admin(api.GetNaming)).
+		AddRoute("POST",   "/api/naming/preview",          admin(api.PreviewNaming)).
+		AddRoute("GET",    "/api/plex/libraries",          admin(api.ListPlexLibraries)).
+		AddRoute("POST",   "/api/plex/sync",               admin(api.SyncPlex)).
+		AddRoute("GET",    "/api/profiles",                viewer(api.ListProfiles)).
+		AddRoute("POST",   "/api/profiles",                admin(api.CreateProfile)).
+		AddRoute("GET",    "/api/profiles/{id}",           viewer(api.GetProfile)).
+		AddRoute("PUT",    "/api/profiles/{id}",           admin(api.UpdateProfile)).
+		AddRoute("DELETE", "/api/profiles/{id}",           admin(api.DeleteProfile)).
+		AddRoute("GET",    "/api/qualities",               viewer(api.ListQualities)).
+		AddRoute("GET",    "/api/proxy",                   viewer(api.Proxy)).
+		AddRoute("GET",    "/api/search",                  viewer(api.Search)).
+		AddRoute("GET",    "/api/system/status",           admin(api.SystemStatus)).
+		AddRoute("GET",    "/api/tokens",                  viewer(api.ListTokens)).
+		AddRoute("POST",   "/api/tokens",                  viewer(api.CreateToken)).
+		AddRoute("DELETE", "/api/tokens/{id}",             viewer(api.DeleteToken)).
+		AddRoute("GET",    "/api/users",                   admin(api.ListUsers)).
+		AddRoute("POST",   "/api/users",                   admin(api.CreateUser)).
+		AddRoute("PUT",    "/api/users/{username}",        admin(api.UpdateUser)).
+		AddRoute("DELETE", "/api/users/{username}",        admin(api.DeleteUser)).
+		AddRoute("GET",    "/api/watch-history",           viewer(api.ListWatchHistory)).
+		AddRoute("POST",   "/api/webhooks/plex",           api.PlexWebhook).
+		AddRoute("GET",    "/.*",                          ui.Handler(conf.Server.UiDir))
+}
@@ -0,0 +1,271 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package scanner
+
+import (
+	"github.com/MediaExchange/mex/clients/tmdb"
+	"github.com/MediaExchange/mex/clients/tvdb"
+	"github.com/MediaExchange/mex/health"
+	"github.com/MediaExchange/mex/library"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/parser"
+	"github.com/MediaExchange/mex/storage"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// A match scoring at least this is accepted without asking...
+	minScore = 0.85
+
+	// ...as long as it beats the next best candidate by this much.
+	minLead = 0.1
+
+	// Candidates kept for someone to choose from.
+	maxCandidates = 5
+)
+
+// An ID in a folder name, in the forms Plex and other tools use, e.g.
+// `{tmdb-603}`, `[tmdbid-603]` or `{tvdb-81189}`.
+var idPattern = regexp.MustCompile(`(?i)[\[{](tmdb|tvdb)(?:id)?[-=](\d+)[\]}]`)
+
+// match finds the media a new folder holds. The folder is matched if its
+// name has an ID, or if its best candidate is certain enough. Otherwise it
+// is pending, with its best candidates to choose from.
+func match(store *storage.Store, entry *models.ScanEntry) error {
+	if id := idOf(entry); len(id) > 0 {
+		entry.Status = models.ScanMatched
+		entry.MediaId = id
+		entry.Score = 1
+		return nil
+	}
+
+	// Media already in the library is the likeliest match, and checking it
+	// first saves asking the provider about every folder.
+	candidates, err := fromLibrary(store.Media, entry)
+	if err != nil {
+		return err
+	}
+	if !certain(candidates) {
+		found, err := search(entry)
+		if err != nil {
+			return err
+		}
+		candidates = merge(candidates, found)
+	}
+
+	if certain(candidates) {
+		entry.Status = models.ScanMatched
+		entry.MediaId = candidates[0].Id
+		entry.Score = candidates[0].Score
+		entry.Candidates = []models.ScanCandidate{}
+		return nil
+	}
+
+	if len(candidates) > maxCandidates {
+		candidates = candidates[:maxCandidates]
+	}
+	entry.Status = models.ScanPending
+	entry.Candidates = candidates
+	return nil
+}
+
+// idOf returns the `provider:id` in a folder's name, or an empty string.
+// IDs of the other type's provider are ignored.
+func idOf(entry *models.ScanEntry) string {
+	for _, m := range idPattern.FindAllStringSubmatch(filepath.Base(entry.Path), -1) {
+		provider := strings.ToLower(m[1])
+		if provider == providerOf(entry.Type) {
+			return provider + ":" + m[2]
+		}
+	}
+	return ""
+}
+
+// fromLibrary scores the library items of the folder's type.
+func fromLibrary(repo storage.MediaRepository, entry *models.ScanEntry) ([]models.ScanCandidate, error) {
+	items, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]models.ScanCandidate, 0)
+	for _, item := range items {
+		if item.Type != entry.Type {
+			continue
+		}
+		candidates = append(candidates, models.ScanCandidate {
+			Id:    item.Id,
+			Title: item.Title,
+			Year:  item.Year,
+			Score: score(entry.Title, entry.Year, item.Title, item.Year),
+		})
+	}
+	return sorted(candidates), nil
+}
+
+// search scores the provider's search results for the folder's title.
+func search(entry *models.ScanEntry) ([]models.ScanCandidate, error) {
+	candidates := make([]models.ScanCandidate, 0)
+	if len(entry.Title) == 0 {
+		return candidates, nil
+	}
+
+	provider := providerOf(entry.Type)
+	if !health.Provider(provider).Available() {
+		return nil, library.ErrUnavailable
+	}
+
+	find := tmdb.Search
+	if provider == "tvdb" {
+		find = tvdb.Search
+	}
+	results := make([]models.SearchResult, 0)
+	if err := find(entry.Title, &results); err != nil {
+		return nil, err
+	}
+
+	for _, r := range results {
+		year := library.Year(r.ReleaseDate)
+		candidates = append(candidates, models.ScanCandidate {
+			Id:    r.Id,
+			Title: r.Title,
+			Year:  year,
+			Score: score(entry.Title, entry.Year, r.Title, year),
+		})
+	}
+	return sorted(candidates), nil
+}
+
+// merge combines two lists of candidates, keeping the higher score of any
+// that are in both.
+func merge(a []models.ScanCandidate, b []models.ScanCandidate) []models.ScanCandidate {
+	seen := make(map[string]int, len(a) + len(b))
+	merged := make([]models.ScanCandidate, 0, len(a) + len(b))
+	for _, c := range append(a, b...) {
+		if i, ok := seen[c.Id]; ok {
+			if c.Score > merged[i].Score {
+				merged[i].Score = c.Score
+			}
+			continue
+		}
+		seen[c.Id] = len(merged)
+		merged = append(merged, c)
+	}
+	return sorted(merged)
+}
+
+// sorted orders candidates by score, highest first.
+func sorted(candidates []models.ScanCandidate) []models.ScanCandidate {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates
+}
+
+// certain returns true if the best of the sorted candidates scores well
+// enough, and far enough ahead of the next, to be accepted without asking.
+func certain(candidates []models.ScanCandidate) bool {
+	if len(candidates) == 0 || candidates[0].Score < minScore {
+		return false
+	}
+	return len(candidates) == 1 || candidates[0].Score - candidates[1].Score >= minLead
+}
+
+// score returns how well a candidate's title and year match those parsed
+// from a folder name, from 0 to 1. Titles are compared by the pairs of
+// letters they share, so small differences in spelling cost little.
+func score(title string, year int, candidate string, candidateYear int) float64 {
+	want := parser.Normalize(title)
+	got := parser.Normalize(candidate)
+	s := similarity(want, got)
+
+	// Titles such as "Doctor Who (2005)" include the year.
+	if year > 0 {
+		if t := similarity(want + strconv.Itoa(year), got); t > s {
+			s = t
+		}
+	}
+
+	switch {
+	case year == 0 || candidateYear == 0:
+		s *= 0.95
+	case year == candidateYear:
+	case year == candidateYear + 1 || year == candidateYear - 1:
+		// Release dates differ between countries and providers.
+		s *= 0.9
+	default:
+		s *= 0.6
+	}
+
+	// Round so scores read well in the API.
+	return math.Round(s * 1000) / 1000
+}
+
+// similarity returns the Sørensen–Dice coefficient of two normalized
+// titles: twice the number of letter pairs they share, divided by the
+// number of pairs in both.
+func similarity(a string, b string) float64 {
+	if a == b {
+		if len(a) == 0 {
+			return 0
+		}
+		return 1
+	}
+
+	pairs := func(s string) map[string]int {
+		r := []rune(s)
+		m := make(map[string]int, len(r))
+		for i := 0; i < len(r) - 1; i++ {
+			m[string(r[i:i+2])]++
+		}
+		return m
+	}
+
+	pa, pb := pairs(a), pairs(b)
+	total := 0
+	for _, n := range pa {
+		total += n
+	}
+	for _, n := range pb {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	shared := 0
+	for p, n := range pa {
+		if m := pb[p]; m < n {
+			shared += m
+		} else {
+			shared += n
+		}
+	}
+	return float64(2 * shared) / float64(total)
+}
+
+// providerOf returns the provider of media of a type.
+func providerOf(typ models.MediaType) string {
+	if typ == models.TvShow {
+		return "tvdb"
+	}
+	return "tmdb"
+}
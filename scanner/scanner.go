@@ -0,0 +1,427 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package scanner finds the movies and TV shows already in the library
+// folders, so that MEX knows what is on disk and doesn't go looking for
+// media it already has. Each folder in a root folder is matched with media
+// by the title and year in its name:
+//
+//     Movies/Title (Year)/...
+//     TV/Title (Year)/Season 01/Title - s01e02 - Episode Name.mkv
+//
+// An ID in the name, as in `Title (Year) {tmdb-603}`, is used as is.
+// Otherwise the library and then the provider are searched, and each
+// candidate is scored. Folders whose best match isn't certain wait for
+// someone to choose the media. Matched media is added to the library, and
+// the movie or the episodes found in the folder are marked as downloaded.
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/mex/events"
+	"github.com/MediaExchange/mex/importer"
+	"github.com/MediaExchange/mex/library"
+	"github.com/MediaExchange/mex/models"
+	"github.com/MediaExchange/mex/parser"
+	"github.com/MediaExchange/mex/requests"
+	"github.com/MediaExchange/mex/storage"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrScanning is returned when a scan is started while another is running.
+	ErrScanning = errors.New("scanner: a scan is already running")
+
+	// ErrNoRoot is returned when neither library folder is configured.
+	ErrNoRoot = errors.New("scanner: no library folders are configured")
+
+	// ErrMissing is returned when a scanned folder no longer exists.
+	ErrMissing = errors.New("scanner: the folder can't be found")
+
+	// ErrWrongType is returned when resolving a folder with media of the other type.
+	ErrWrongType = errors.New("scanner: media is the wrong type for the folder")
+)
+
+var (
+	// Monitor is whether media the scanner adds to the library is monitored.
+	Monitor bool
+
+	// True while a scan runs or a scanned folder is changed. Only one may
+	// happen at a time.
+	mutex   sync.Mutex
+	running bool
+)
+
+// Summary counts what a scan found.
+type Summary struct {
+	Folders     int     `json:"folders"`    // Folders with videos in the root folders.
+	Matched     int     `json:"matched"`    // Folders matched for the first time.
+	Pending     int     `json:"pending"`    // Folders waiting for someone to choose the media.
+	Added       int     `json:"added"`      // Media added to the library.
+}
+
+// Filter restricts the entries returned by List. Empty fields match everything.
+type Filter struct {
+	Status models.ScanStatus
+}
+
+// Run returns a function for services.NewTicker that scans the library
+// folders. It does nothing while another scan is running.
+func Run(store *storage.Store) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		if len(importer.MoviesDir) == 0 && len(importer.TvDir) == 0 {
+			return
+		}
+
+		if _, err := Scan(ctx, store); err != nil && err != ErrScanning {
+			log.Error("scanner.Run: scan failed", log.Err(err))
+		}
+	}
+}
+
+// Scan walks the movie and TV folders and matches each folder that holds
+// videos. Folders already matched are only checked for new videos, and
+// folders that are pending or ignored are left as they are. A folder whose
+// provider can't be reached is skipped and matched by a later scan.
+func Scan(ctx context.Context, store *storage.Store) (*Summary, error) {
+	if len(importer.MoviesDir) == 0 && len(importer.TvDir) == 0 {
+		return nil, ErrNoRoot
+	}
+	if !begin() {
+		return nil, ErrScanning
+	}
+	defer end()
+
+	return walk(ctx, store)
+}
+
+// Start runs Scan in the background. It returns ErrNoRoot or ErrScanning
+// straight away if the scan can't start; otherwise the summary is published
+// as a LibraryScanned event when the scan finishes.
+func Start(store *storage.Store) error {
+	if len(importer.MoviesDir) == 0 && len(importer.TvDir) == 0 {
+		return ErrNoRoot
+	}
+	if !begin() {
+		return ErrScanning
+	}
+
+	go func() {
+		defer end()
+		if _, err := walk(context.Background(), store); err != nil {
+			log.Error("scanner.Start: scan failed", log.Err(err))
+		}
+	}()
+	return nil
+}
+
+// walk scans the root folders, as with Scan. The caller has called begin.
+func walk(ctx context.Context, store *storage.Store) (*Summary, error) {
+	list, err := store.Scans.List()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]*models.ScanEntry, len(list))
+	for i := range list {
+		known[list[i].Path] = &list[i]
+	}
+
+	log.Info("scanner.Scan: starting", log.String("movies", importer.MoviesDir), log.String("tv", importer.TvDir))
+	summary := &Summary{}
+	for _, root := range []struct {
+		path string
+		typ  models.MediaType
+	}{
+		{importer.MoviesDir, models.Movie},
+		{importer.TvDir, models.TvShow},
+	} {
+		if len(root.path) == 0 {
+			continue
+		}
+
+		names, err := os.ReadDir(root.path)
+		if err != nil {
+			log.Warn("scanner.Scan: unable to read folder", log.String("path", root.path), log.Err(err))
+			continue
+		}
+
+		for _, name := range names {
+			if ctx.Err() != nil {
+				return summary, ctx.Err()
+			}
+
+			// Movies may sit in the root folder, but episodes need a show folder.
+			if strings.HasPrefix(name.Name(), ".") || (root.typ == models.TvShow && !name.IsDir()) {
+				continue
+			}
+
+			path := filepath.Join(root.path, name.Name())
+			if err := scan(store, known[path], path, root.typ, summary); err != nil {
+				log.Warn("scanner.Scan: unable to scan folder", log.String("path", path), log.Err(err))
+			}
+		}
+	}
+
+	log.Info("scanner.Scan: finished", log.Int64("folders", int64(summary.Folders)), log.Int64("matched", int64(summary.Matched)), log.Int64("pending", int64(summary.Pending)), log.Int64("added", int64(summary.Added)))
+	events.Publish(events.LibraryScanned, *summary)
+	return summary, nil
+}
+
+// List returns the scanned folders that match the filter, sorted by path.
+func List(repo storage.ScanRepository, filter Filter) ([]models.ScanEntry, error) {
+	all, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.ScanEntry, 0, len(all))
+	for _, entry := range all {
+		if len(filter.Status) > 0 && entry.Status != filter.Status {
+			continue
+		}
+		list = append(list, entry)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+	return list, nil
+}
+
+// Resolve matches a scanned folder with media chosen by hand, in the format
+// `provider:id`, whatever state the folder was in. The media is added to
+// the library if necessary, and what the folder holds is marked as
+// downloaded.
+func Resolve(store *storage.Store, id uint64, mediaId string) (*models.ScanEntry, error) {
+	if !begin() {
+		return nil, ErrScanning
+	}
+	defer end()
+
+	entry, err := store.Scans.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, _, err := library.ParseId(mediaId)
+	if err != nil {
+		return nil, err
+	}
+	if provider != providerOf(entry.Type) {
+		return nil, ErrWrongType
+	}
+
+	files, err := importer.Videos(entry.Path)
+	if err != nil {
+		log.Warn("scanner.Resolve: unable to read folder", log.String("path", entry.Path), log.Err(err))
+		return nil, ErrMissing
+	}
+
+	entry.Status = models.ScanMatched
+	entry.MediaId = mediaId
+	entry.Score = 1
+	entry.Candidates = []models.ScanCandidate{}
+	entry.Files = len(files)
+	entry.Scanned = time.Now()
+	if _, err := present(store, entry, files); err != nil {
+		return nil, err
+	}
+
+	if err := store.Scans.Save(entry); err != nil {
+		log.Error("scanner.Resolve: unable to save entry", log.String("path", entry.Path), log.Err(err))
+		return nil, err
+	}
+	log.Info("scanner.Resolve", log.String("path", entry.Path), log.String("mediaId", mediaId))
+	return entry, nil
+}
+
+// Ignore leaves a scanned folder out of the library. Later scans skip it
+// until it is resolved or removed.
+func Ignore(store *storage.Store, id uint64) (*models.ScanEntry, error) {
+	if !begin() {
+		return nil, ErrScanning
+	}
+	defer end()
+
+	entry, err := store.Scans.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.Status = models.ScanIgnored
+	entry.MediaId = ""
+	entry.Score = 0
+	if err := store.Scans.Save(entry); err != nil {
+		log.Error("scanner.Ignore: unable to save entry", log.String("path", entry.Path), log.Err(err))
+		return nil, err
+	}
+	log.Info("scanner.Ignore", log.String("path", entry.Path))
+	return entry, nil
+}
+
+// Remove forgets a scanned folder, so the next scan matches it again. The
+// library is unchanged.
+func Remove(store *storage.Store, id uint64) error {
+	if !begin() {
+		return ErrScanning
+	}
+	defer end()
+
+	if err := store.Scans.Delete(id); err != nil {
+		return err
+	}
+	log.Info("scanner.Remove", log.Int64("id", int64(id)))
+	return nil
+}
+
+// scan matches a folder, or a video in the movies folder, and records what
+// it holds. Entry is nil the first time the folder is seen.
+func scan(store *storage.Store, entry *models.ScanEntry, path string, typ models.MediaType, summary *Summary) error {
+	files, err := importer.Videos(path)
+	if err != nil {
+		return err
+	}
+
+	// Empty folders and leftovers such as subtitles aren't media.
+	if len(files) == 0 {
+		return nil
+	}
+	summary.Folders++
+
+	if entry == nil {
+		parsed := parser.Parse(filepath.Base(path))
+		entry = &models.ScanEntry {
+			Path:       path,
+			Type:       typ,
+			Title:      parsed.Title,
+			Year:       parsed.Year,
+			Candidates: []models.ScanCandidate{},
+		}
+	}
+	entry.Files = len(files)
+	entry.Scanned = time.Now()
+
+	switch entry.Status {
+	case models.ScanMatched:
+	case models.ScanPending:
+		summary.Pending++
+		return store.Scans.Save(entry)
+	case models.ScanIgnored:
+		return store.Scans.Save(entry)
+	default:
+		if err := match(store, entry); err != nil {
+			return err
+		}
+		if entry.Status == models.ScanPending {
+			log.Info("scanner.scan: match isn't certain", log.String("path", path), log.Int64("candidates", int64(len(entry.Candidates))))
+			summary.Pending++
+			return store.Scans.Save(entry)
+		}
+		log.Info("scanner.scan: matched", log.String("path", path), log.String("mediaId", entry.MediaId), log.String("score", fmt.Sprintf("%.2f", entry.Score)))
+		summary.Matched++
+	}
+
+	added, err := present(store, entry, files)
+	if err != nil {
+		return err
+	}
+	if added {
+		summary.Added++
+	}
+	return store.Scans.Save(entry)
+}
+
+// present adds a matched folder's media to the library if necessary and
+// marks the movie, or the episodes the videos contain, as downloaded. It
+// returns true if the media was added.
+func present(store *storage.Store, entry *models.ScanEntry, files []string) (bool, error) {
+	added := false
+	item, err := store.Media.Get(entry.MediaId)
+	if err == storage.ErrNotFound {
+		item, err = library.Add(store.Media, entry.MediaId, Monitor, 0)
+		added = true
+	}
+	if err != nil {
+		return false, err
+	}
+	if item.Type != entry.Type {
+		return false, ErrWrongType
+	}
+
+	changed := false
+	if item.Type == models.Movie {
+		if item.State != models.Downloaded {
+			if item, err = library.SetDownloaded(store.Media, item.Id, 0, nil); err != nil {
+				return added, err
+			}
+			changed = true
+		}
+	} else {
+		// Episodes not yet marked as downloaded, by season.
+		found := make(map[int][]int)
+		entry.Episodes = 0
+		for _, f := range files {
+			season, episodes := library.EpisodesOf(item, parser.Parse(filepath.Base(f)))
+			entry.Episodes += len(episodes)
+			for _, n := range episodes {
+				if e := item.FindEpisode(season, n); e != nil && e.State != models.Downloaded {
+					found[season] = append(found[season], n)
+				}
+			}
+		}
+
+		for season, episodes := range found {
+			if item, err = library.SetDownloaded(store.Media, item.Id, season, episodes); err != nil {
+				return added, err
+			}
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := requests.MarkAvailable(store, item); err != nil {
+			log.Warn("scanner.present: unable to mark requests available", log.String("mediaId", item.Id), log.Err(err))
+		}
+	}
+	return added, nil
+}
+
+// begin marks a scan or change as running, or returns false if one already is.
+func begin() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if running {
+		return false
+	}
+	running = true
+	return true
+}
+
+// end marks the running scan or change as finished.
+func end() {
+	mutex.Lock()
+	running = false
+	mutex.Unlock()
+}
@@ -0,0 +1,125 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Retry is a service that calls a function until it succeeds, waiting
+// longer after each failure. It can be started again once it has.
+type Retry struct {
+	name    string
+	min     time.Duration
+	max     time.Duration
+	fn      func(ctx context.Context) error
+	cancel  context.CancelFunc
+	done    sync.WaitGroup
+	mutex   sync.Mutex
+	running bool
+}
+
+// NewRetry returns a service that calls fn until it returns nil. The first
+// call is made after waiting min, since the caller has usually just failed;
+// the wait then doubles after each failure up to max.
+func NewRetry(name string, min time.Duration, max time.Duration, fn func(ctx context.Context) error) *Retry {
+	return &Retry {
+		name: name,
+		min:  min,
+		max:  max,
+		fn:   fn,
+	}
+}
+
+// Name returns the name of the retry.
+func (r *Retry) Name() string {
+	return r.name
+}
+
+// Start begins calling the function in a new goroutine, unless it is
+// already being called.
+func (r *Retry) Start() error {
+	if r.min <= 0 || r.max < r.min {
+		return errors.New("services.Retry: backoff must be greater than zero and min must not exceed max")
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.running {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.running = true
+	r.done.Add(1)
+
+	go func() {
+		defer r.done.Done()
+		defer func() {
+			r.mutex.Lock()
+			r.running = false
+			r.mutex.Unlock()
+		}()
+
+		delay := r.min
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			if err := r.fn(ctx); err == nil {
+				return
+			}
+
+			delay *= 2
+			if delay > r.max {
+				delay = r.max
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop cancels the function's context and waits for it to return.
+func (r *Retry) Stop(ctx context.Context) error {
+	r.mutex.Lock()
+	cancel := r.cancel
+	r.mutex.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		r.done.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
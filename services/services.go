@@ -0,0 +1,111 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package services manages the background work that runs for the lifetime
+// of the application, such as schedulers, pollers and caches. Services are
+// registered while the application is configured, started once the
+// configuration is loaded, and stopped in reverse order during shutdown.
+package services
+
+import (
+	"context"
+	"github.com/MediaExchange/log"
+	"sync"
+)
+
+// Service is a unit of background work.
+type Service interface {
+	// Name identifies the service in log messages.
+	Name() string
+
+	// Start begins the work. It must not block.
+	Start() error
+
+	// Stop ends the work, returning early if ctx expires.
+	Stop(ctx context.Context) error
+}
+
+var (
+	mutex    sync.Mutex
+	registry []Service
+	started  []Service
+)
+
+// Register adds a service to the registry. Services registered after Start
+// has been called are started immediately.
+func Register(s Service) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	registry = append(registry, s)
+	if started == nil {
+		return nil
+	}
+
+	return start(s)
+}
+
+// Start starts all registered services in the order they were registered.
+// If any service fails to start, the services already started are stopped
+// and the error is returned.
+func Start() error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	started = make([]Service, 0, len(registry))
+	for _, s := range registry {
+		if err := start(s); err != nil {
+			stopAll(context.Background())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stop stops all started services in reverse order. Errors are logged and
+// do not prevent the remaining services from stopping.
+func Stop(ctx context.Context) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	stopAll(ctx)
+}
+
+// start starts a single service and records it. The mutex must be held.
+func start(s Service) error {
+	log.Info("Starting service", log.String("name", s.Name()))
+	if err := s.Start(); err != nil {
+		log.Error("services.start: unable to start service", log.String("name", s.Name()), log.Err(err))
+		return err
+	}
+
+	started = append(started, s)
+	return nil
+}
+
+// stopAll stops the started services in reverse order. The mutex must be held.
+func stopAll(ctx context.Context) {
+	for i := len(started) - 1; i >= 0; i-- {
+		s := started[i]
+		log.Info("Stopping service", log.String("name", s.Name()))
+		if err := s.Stop(ctx); err != nil {
+			log.Error("services.stopAll: unable to stop service", log.String("name", s.Name()), log.Err(err))
+		}
+	}
+
+	started = nil
+}
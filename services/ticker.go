@@ -0,0 +1,99 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Ticker is a service that calls a function on a fixed interval. The
+// function is called once immediately when the service starts.
+type Ticker struct {
+	name     string
+	interval time.Duration
+	fn       func(ctx context.Context)
+	cancel   context.CancelFunc
+	done     sync.WaitGroup
+}
+
+// NewTicker returns a service that calls fn every interval. The context
+// passed to fn is cancelled when the service is stopped.
+func NewTicker(name string, interval time.Duration, fn func(ctx context.Context)) *Ticker {
+	return &Ticker {
+		name:     name,
+		interval: interval,
+		fn:       fn,
+	}
+}
+
+// Name returns the name of the ticker.
+func (t *Ticker) Name() string {
+	return t.name
+}
+
+// Start begins calling the function in a new goroutine.
+func (t *Ticker) Start() error {
+	if t.interval <= 0 {
+		return errors.New("services.Ticker: interval must be greater than zero")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	t.done.Add(1)
+
+	go func() {
+		defer t.done.Done()
+
+		timer := time.NewTicker(t.interval)
+		defer timer.Stop()
+
+		for {
+			t.fn(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop cancels the function's context and waits for it to return.
+func (t *Ticker) Stop(ctx context.Context) error {
+	if t.cancel == nil {
+		return nil
+	}
+	t.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		t.done.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,64 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package storage
+
+import (
+	"github.com/MediaExchange/mex/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// downloadRepository implements DownloadRepository.
+type downloadRepository struct {
+	db *bolt.DB
+}
+
+func (r *downloadRepository) Get(id string) (*models.Download, error) {
+	download := new(models.Download)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return get(tx, downloadBucket, []byte(id), download)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return download, nil
+}
+
+func (r *downloadRepository) List() ([]models.Download, error) {
+	downloads := make([]models.Download, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return each(tx, downloadBucket, func(decode func(v interface{}) error) error {
+			var download models.Download
+			if err := decode(&download); err != nil {
+				return err
+			}
+			downloads = append(downloads, download)
+			return nil
+		})
+	})
+	return downloads, err
+}
+
+func (r *downloadRepository) Save(download *models.Download) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, downloadBucket, []byte(download.Id), download)
+	})
+}
+
+func (r *downloadRepository) Delete(id string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return remove(tx, downloadBucket, []byte(id))
+	})
+}
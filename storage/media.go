@@ -0,0 +1,64 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package storage
+
+import (
+	"github.com/MediaExchange/mex/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// mediaRepository implements MediaRepository.
+type mediaRepository struct {
+	db *bolt.DB
+}
+
+func (r *mediaRepository) Get(id string) (*models.MediaItem, error) {
+	item := new(models.MediaItem)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return get(tx, mediaBucket, []byte(id), item)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (r *mediaRepository) List() ([]models.MediaItem, error) {
+	items := make([]models.MediaItem, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return each(tx, mediaBucket, func(decode func(v interface{}) error) error {
+			var item models.MediaItem
+			if err := decode(&item); err != nil {
+				return err
+			}
+			items = append(items, item)
+			return nil
+		})
+	})
+	return items, err
+}
+
+func (r *mediaRepository) Save(item *models.MediaItem) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, mediaBucket, []byte(item.Id), item)
+	})
+}
+
+func (r *mediaRepository) Delete(id string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return remove(tx, mediaBucket, []byte(id))
+	})
+}
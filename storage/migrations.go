@@ -0,0 +1,147 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/MediaExchange/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// Bucket names.
+	metaBucket      = []byte("meta")
+	mediaBucket     = []byte("media")
+	requestBucket   = []byte("requests")
+	downloadBucket  = []byte("downloads")
+	settingBucket   = []byte("settings")
+	userBucket      = []byte("users")
+	passwordBucket  = []byte("passwords")
+	sessionBucket   = []byte("sessions")
+	tokenBucket     = []byte("tokens")
+	profileBucket   = []byte("profiles")
+	historyBucket   = []byte("history")
+	blocklistBucket = []byte("blocklist")
+	scanBucket      = []byte("scans")
+	watchBucket     = []byte("watches")
+
+	// Key in the meta bucket holding the schema version.
+	versionKey = []byte("schema_version")
+)
+
+// migration upgrades the schema by one version.
+type migration struct {
+	description string
+	apply       func(tx *bolt.Tx) error
+}
+
+// migrations must only ever be appended to. The schema version stored in the
+// database is the number of migrations that have been applied.
+var migrations = []migration {
+	{
+		description: "create media, request, download and setting buckets",
+		apply: createBuckets(mediaBucket, requestBucket, downloadBucket, settingBucket),
+	},
+	{
+		description: "create user, password, session and token buckets",
+		apply: createBuckets(userBucket, passwordBucket, sessionBucket, tokenBucket),
+	},
+	{
+		description: "create quality profile bucket",
+		apply: createBuckets(profileBucket),
+	},
+	{
+		description: "create history bucket",
+		apply: createBuckets(historyBucket),
+	},
+	{
+		description: "create blocklist bucket",
+		apply: createBuckets(blocklistBucket),
+	},
+	{
+		description: "create library scan bucket",
+		apply: createBuckets(scanBucket),
+	},
+	{
+		description: "create watch history bucket",
+		apply: createBuckets(watchBucket),
+	},
+}
+
+// migrate applies every migration newer than the database's schema version.
+// Each migration runs in its own transaction along with the version update.
+func migrate(db *bolt.DB) error {
+	for {
+		done := false
+		err := db.Update(func(tx *bolt.Tx) error {
+			meta, err := tx.CreateBucketIfNotExists(metaBucket)
+			if err != nil {
+				return err
+			}
+
+			current := uint64(0)
+			if buf := meta.Get(versionKey); buf != nil {
+				current = binary.BigEndian.Uint64(buf)
+			}
+
+			if current > uint64(len(migrations)) {
+				return fmt.Errorf("storage.migrate: database schema version %d is newer than this version of MEX supports (%d)", current, len(migrations))
+			}
+
+			if current == uint64(len(migrations)) {
+				done = true
+				return nil
+			}
+
+			m := migrations[current]
+			log.Info("storage.migrate: applying migration", log.Int64("version", int64(current + 1)), log.String("description", m.description))
+			if err := m.apply(tx); err != nil {
+				return err
+			}
+
+			return meta.Put(versionKey, itob(current + 1))
+		})
+
+		if err != nil {
+			log.Error("storage.migrate: migration failed", log.Err(err))
+			return err
+		}
+
+		if done {
+			return nil
+		}
+	}
+}
+
+// createBuckets returns a migration that creates each of the buckets.
+func createBuckets(names ...[]byte) func(tx *bolt.Tx) error {
+	return func(tx *bolt.Tx) error {
+		for _, name := range names {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// itob encodes an integer as an 8-byte big-endian key, which keeps keys in numeric order.
+func itob(v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	return buf
+}
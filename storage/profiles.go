@@ -0,0 +1,71 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package storage
+
+import (
+	"github.com/MediaExchange/mex/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// profileRepository implements ProfileRepository.
+type profileRepository struct {
+	db *bolt.DB
+}
+
+func (r *profileRepository) Get(id uint64) (*models.QualityProfile, error) {
+	profile := new(models.QualityProfile)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return get(tx, profileBucket, itob(id), profile)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func (r *profileRepository) List() ([]models.QualityProfile, error) {
+	profiles := make([]models.QualityProfile, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return each(tx, profileBucket, func(decode func(v interface{}) error) error {
+			var profile models.QualityProfile
+			if err := decode(&profile); err != nil {
+				return err
+			}
+			profiles = append(profiles, profile)
+			return nil
+		})
+	})
+	return profiles, err
+}
+
+func (r *profileRepository) Save(profile *models.QualityProfile) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		if profile.Id == 0 {
+			id, err := tx.Bucket(profileBucket).NextSequence()
+			if err != nil {
+				return err
+			}
+			profile.Id = id
+		}
+		return put(tx, profileBucket, itob(profile.Id), profile)
+	})
+}
+
+func (r *profileRepository) Delete(id uint64) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return remove(tx, profileBucket, itob(id))
+	})
+}
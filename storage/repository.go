@@ -0,0 +1,212 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package storage
+
+import (
+	"github.com/MediaExchange/mex/models"
+	"time"
+)
+
+// MediaRepository stores the media items in the library, keyed by `provider:id`.
+type MediaRepository interface {
+	// Get returns a single item, or ErrNotFound.
+	Get(id string) (*models.MediaItem, error)
+
+	// List returns every item.
+	List() ([]models.MediaItem, error)
+
+	// Save creates or replaces an item.
+	Save(item *models.MediaItem) error
+
+	// Delete removes an item, or returns ErrNotFound.
+	Delete(id string) error
+}
+
+// RequestRepository stores media requests. IDs are assigned when a request
+// is first saved.
+type RequestRepository interface {
+	// Get returns a single request, or ErrNotFound.
+	Get(id uint64) (*models.MediaRequest, error)
+
+	// List returns every request, oldest first.
+	List() ([]models.MediaRequest, error)
+
+	// Save creates a request when its ID is zero, otherwise replaces it.
+	Save(request *models.MediaRequest) error
+
+	// Delete removes a request, or returns ErrNotFound.
+	Delete(id uint64) error
+}
+
+// DownloadRepository stores the last known state of each download, keyed by `client:id`.
+type DownloadRepository interface {
+	// Get returns a single download, or ErrNotFound.
+	Get(id string) (*models.Download, error)
+
+	// List returns every download.
+	List() ([]models.Download, error)
+
+	// Save creates or replaces a download.
+	Save(download *models.Download) error
+
+	// Delete removes a download, or returns ErrNotFound.
+	Delete(id string) error
+}
+
+// SettingsRepository stores application settings that can be changed while
+// MEX is running. Values are any type that can be encoded as JSON.
+type SettingsRepository interface {
+	// Get decodes the setting into v, or returns ErrNotFound.
+	Get(key string, v interface{}) error
+
+	// Set stores the setting.
+	Set(key string, v interface{}) error
+
+	// Delete removes the setting, or returns ErrNotFound.
+	Delete(key string) error
+}
+
+// UserRepository stores user accounts, keyed by username without regard to
+// case. Password hashes are kept apart from the users so they can't be
+// returned by accident.
+type UserRepository interface {
+	// Get returns a single user, or ErrNotFound.
+	Get(username string) (*models.User, error)
+
+	// List returns every user.
+	List() ([]models.User, error)
+
+	// Count returns the number of users.
+	Count() (int, error)
+
+	// Save creates or replaces a user.
+	Save(user *models.User) error
+
+	// Delete removes a user along with their password, sessions and API
+	// tokens, or returns ErrNotFound.
+	Delete(username string) error
+
+	// PasswordHash returns the user's password hash, or ErrNotFound.
+	PasswordHash(username string) ([]byte, error)
+
+	// SetPasswordHash stores the user's password hash and revokes their
+	// sessions and API tokens.
+	SetPasswordHash(username string, hash []byte) error
+}
+
+// SessionRepository stores logged in sessions, keyed by a hash of the session cookie.
+type SessionRepository interface {
+	// Get returns a single session, or ErrNotFound.
+	Get(key string) (*models.Session, error)
+
+	// Save creates or replaces a session.
+	Save(key string, session *models.Session) error
+
+	// Delete removes a session, or returns ErrNotFound.
+	Delete(key string) error
+
+	// DeleteExpired removes every session that expired before now.
+	DeleteExpired(now time.Time) error
+}
+
+// TokenRepository stores API tokens, keyed by their ID, which is a hash of the token.
+type TokenRepository interface {
+	// Get returns a single token, or ErrNotFound.
+	Get(id string) (*models.ApiToken, error)
+
+	// List returns the tokens belonging to a user.
+	List(username string) ([]models.ApiToken, error)
+
+	// Save creates or replaces a token.
+	Save(token *models.ApiToken) error
+
+	// Delete removes a token, or returns ErrNotFound.
+	Delete(id string) error
+}
+
+// ProfileRepository stores quality profiles. IDs are assigned when a profile
+// is first saved.
+type ProfileRepository interface {
+	// Get returns a single profile, or ErrNotFound.
+	Get(id uint64) (*models.QualityProfile, error)
+
+	// List returns every profile, oldest first.
+	List() ([]models.QualityProfile, error)
+
+	// Save creates a profile when its ID is zero, otherwise replaces it.
+	Save(profile *models.QualityProfile) error
+
+	// Delete removes a profile, or returns ErrNotFound.
+	Delete(id uint64) error
+}
+
+// HistoryRepository stores what MEX did with releases. IDs are assigned when
+// an entry is first saved, so they increase over time.
+type HistoryRepository interface {
+	// List returns every entry, oldest first.
+	List() ([]models.History, error)
+
+	// Save creates an entry when its ID is zero, otherwise replaces it.
+	Save(entry *models.History) error
+
+	// Delete removes an entry, or returns ErrNotFound.
+	Delete(id uint64) error
+}
+
+// BlocklistRepository stores releases that must not be grabbed again. IDs
+// are assigned when an entry is first saved.
+type BlocklistRepository interface {
+	// Get returns an entry, or ErrNotFound.
+	Get(id uint64) (*models.BlocklistEntry, error)
+
+	// List returns every entry, oldest first.
+	List() ([]models.BlocklistEntry, error)
+
+	// Save creates an entry when its ID is zero, otherwise replaces it.
+	Save(entry *models.BlocklistEntry) error
+
+	// Delete removes an entry, or returns ErrNotFound.
+	Delete(id uint64) error
+}
+
+// ScanRepository stores the folders found by the library scanner. IDs are
+// assigned when an entry is first saved.
+type ScanRepository interface {
+	// Get returns an entry, or ErrNotFound.
+	Get(id uint64) (*models.ScanEntry, error)
+
+	// List returns every entry, oldest first.
+	List() ([]models.ScanEntry, error)
+
+	// Save creates an entry when its ID is zero, otherwise replaces it.
+	Save(entry *models.ScanEntry) error
+
+	// Delete removes an entry, or returns ErrNotFound.
+	Delete(id uint64) error
+}
+
+// WatchRepository stores what users watched in Plex. IDs are assigned when
+// an entry is first saved, so they increase over time.
+type WatchRepository interface {
+	// List returns every entry, oldest first.
+	List() ([]models.Watch, error)
+
+	// Save creates an entry when its ID is zero, otherwise replaces it.
+	Save(entry *models.Watch) error
+
+	// Delete removes an entry, or returns ErrNotFound.
+	Delete(id uint64) error
+}
@@ -0,0 +1,71 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package storage
+
+import (
+	"github.com/MediaExchange/mex/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// requestRepository implements RequestRepository.
+type requestRepository struct {
+	db *bolt.DB
+}
+
+func (r *requestRepository) Get(id uint64) (*models.MediaRequest, error) {
+	request := new(models.MediaRequest)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return get(tx, requestBucket, itob(id), request)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func (r *requestRepository) List() ([]models.MediaRequest, error) {
+	requests := make([]models.MediaRequest, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return each(tx, requestBucket, func(decode func(v interface{}) error) error {
+			var request models.MediaRequest
+			if err := decode(&request); err != nil {
+				return err
+			}
+			requests = append(requests, request)
+			return nil
+		})
+	})
+	return requests, err
+}
+
+func (r *requestRepository) Save(request *models.MediaRequest) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		if request.Id == 0 {
+			id, err := tx.Bucket(requestBucket).NextSequence()
+			if err != nil {
+				return err
+			}
+			request.Id = id
+		}
+		return put(tx, requestBucket, itob(request.Id), request)
+	})
+}
+
+func (r *requestRepository) Delete(id uint64) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return remove(tx, requestBucket, itob(id))
+	})
+}
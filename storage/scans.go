@@ -0,0 +1,71 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package storage
+
+import (
+	"github.com/MediaExchange/mex/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// scanRepository implements ScanRepository.
+type scanRepository struct {
+	db *bolt.DB
+}
+
+func (r *scanRepository) Get(id uint64) (*models.ScanEntry, error) {
+	var entry models.ScanEntry
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return get(tx, scanBucket, itob(id), &entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *scanRepository) List() ([]models.ScanEntry, error) {
+	entries := make([]models.ScanEntry, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return each(tx, scanBucket, func(decode func(v interface{}) error) error {
+			var entry models.ScanEntry
+			if err := decode(&entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	return entries, err
+}
+
+func (r *scanRepository) Save(entry *models.ScanEntry) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		if entry.Id == 0 {
+			id, err := tx.Bucket(scanBucket).NextSequence()
+			if err != nil {
+				return err
+			}
+			entry.Id = id
+		}
+		return put(tx, scanBucket, itob(entry.Id), entry)
+	})
+}
+
+func (r *scanRepository) Delete(id uint64) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return remove(tx, scanBucket, itob(id))
+	})
+}
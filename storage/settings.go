@@ -0,0 +1,43 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package storage
+
+import (
+	bolt "go.etcd.io/bbolt"
+)
+
+// settingsRepository implements SettingsRepository.
+type settingsRepository struct {
+	db *bolt.DB
+}
+
+func (r *settingsRepository) Get(key string, v interface{}) error {
+	return r.db.View(func(tx *bolt.Tx) error {
+		return get(tx, settingBucket, []byte(key), v)
+	})
+}
+
+func (r *settingsRepository) Set(key string, v interface{}) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, settingBucket, []byte(key), v)
+	})
+}
+
+func (r *settingsRepository) Delete(key string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return remove(tx, settingBucket, []byte(key))
+	})
+}
@@ -0,0 +1,146 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package storage keeps MEX state in an embedded bbolt database. Each kind of
+// record lives in its own bucket as JSON and is accessed through a
+// repository interface, so the rest of MEX never touches the database
+// directly.
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/MediaExchange/log"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// Name of the database file inside the data directory.
+	fileName = "mex.db"
+)
+
+var (
+	// ErrNotFound is returned when a record does not exist.
+	ErrNotFound = errors.New("storage: not found")
+)
+
+// Store provides access to every repository.
+type Store struct {
+	db          *bolt.DB
+	Media       MediaRepository
+	Requests    RequestRepository
+	Downloads   DownloadRepository
+	Settings    SettingsRepository
+	Users       UserRepository
+	Sessions    SessionRepository
+	Tokens      TokenRepository
+	Profiles    ProfileRepository
+	History     HistoryRepository
+	Blocklist   BlocklistRepository
+	Scans       ScanRepository
+	Watches     WatchRepository
+}
+
+// Open opens the database in dir, creating the directory and database if
+// necessary, and migrates the schema to the latest version.
+func Open(dir string) (*Store, error) {
+	if len(dir) == 0 {
+		s := "storage.Open: data directory must be provided"
+		log.Error(s)
+		return nil, errors.New(s)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Error("storage.Open: unable to create data directory", log.String("dir", dir), log.Err(err))
+		return nil, err
+	}
+
+	path := filepath.Join(dir, fileName)
+	log.Info("storage.Open", log.String("path", path))
+
+	// The timeout stops a second copy of MEX from hanging on the file lock.
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		log.Error("storage.Open: unable to open database", log.String("path", path), log.Err(err))
+		return nil, err
+	}
+
+	if err := migrate(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &Store {
+		db:        db,
+		Media:     &mediaRepository{db: db},
+		Requests:  &requestRepository{db: db},
+		Downloads: &downloadRepository{db: db},
+		Settings:  &settingsRepository{db: db},
+		Users:     &userRepository{db: db},
+		Sessions:  &sessionRepository{db: db},
+		Tokens:    &tokenRepository{db: db},
+		Profiles:  &profileRepository{db: db},
+		History:   &historyRepository{db: db},
+		Blocklist: &blocklistRepository{db: db},
+		Scans:     &scanRepository{db: db},
+		Watches:   &watchRepository{db: db},
+	}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// get decodes the JSON record stored at key into v.
+func get(tx *bolt.Tx, bucket []byte, key []byte, v interface{}) error {
+	buf := tx.Bucket(bucket).Get(key)
+	if buf == nil {
+		return ErrNotFound
+	}
+	return json.Unmarshal(buf, v)
+}
+
+// put encodes v as JSON and stores it at key.
+func put(tx *bolt.Tx, bucket []byte, key []byte, v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucket).Put(key, buf)
+}
+
+// remove deletes the record stored at key.
+func remove(tx *bolt.Tx, bucket []byte, key []byte) error {
+	b := tx.Bucket(bucket)
+	if b.Get(key) == nil {
+		return ErrNotFound
+	}
+	return b.Delete(key)
+}
+
+// each decodes every record in the bucket, in key order, calling fn with a
+// function that decodes the record into a value.
+func each(tx *bolt.Tx, bucket []byte, fn func(decode func(v interface{}) error) error) error {
+	return tx.Bucket(bucket).ForEach(func(k, buf []byte) error {
+		return fn(func(v interface{}) error {
+			return json.Unmarshal(buf, v)
+		})
+	})
+}
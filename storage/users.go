@@ -0,0 +1,242 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package storage
+
+import (
+	"encoding/json"
+	"github.com/MediaExchange/mex/models"
+	bolt "go.etcd.io/bbolt"
+	"strings"
+	"time"
+)
+
+// userRepository implements UserRepository.
+type userRepository struct {
+	db *bolt.DB
+}
+
+// userKey returns the key for a username. Usernames are not case-sensitive.
+func userKey(username string) []byte {
+	return []byte(strings.ToLower(username))
+}
+
+func (r *userRepository) Get(username string) (*models.User, error) {
+	user := new(models.User)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return get(tx, userBucket, userKey(username), user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *userRepository) List() ([]models.User, error) {
+	users := make([]models.User, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return each(tx, userBucket, func(decode func(v interface{}) error) error {
+			var user models.User
+			if err := decode(&user); err != nil {
+				return err
+			}
+			users = append(users, user)
+			return nil
+		})
+	})
+	return users, err
+}
+
+func (r *userRepository) Count() (int, error) {
+	count := 0
+	err := r.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(userBucket).Stats().KeyN
+		return nil
+	})
+	return count, err
+}
+
+func (r *userRepository) Save(user *models.User) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, userBucket, userKey(user.Username), user)
+	})
+}
+
+// Delete removes the user along with their password, sessions and API tokens.
+func (r *userRepository) Delete(username string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		if err := remove(tx, userBucket, userKey(username)); err != nil {
+			return err
+		}
+		_ = tx.Bucket(passwordBucket).Delete(userKey(username))
+
+		for _, bucket := range [][]byte{sessionBucket, tokenBucket} {
+			if err := deleteOwned(tx, bucket, username); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *userRepository) PasswordHash(username string) ([]byte, error) {
+	var hash []byte
+	err := r.db.View(func(tx *bolt.Tx) error {
+		buf := tx.Bucket(passwordBucket).Get(userKey(username))
+		if buf == nil {
+			return ErrNotFound
+		}
+		hash = append([]byte{}, buf...)
+		return nil
+	})
+	return hash, err
+}
+
+// SetPasswordHash stores the hash and revokes the user's sessions and API
+// tokens in the same transaction.
+func (r *userRepository) SetPasswordHash(username string, hash []byte) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(passwordBucket).Put(userKey(username), hash); err != nil {
+			return err
+		}
+
+		for _, bucket := range [][]byte{sessionBucket, tokenBucket} {
+			if err := deleteOwned(tx, bucket, username); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// sessionRepository implements SessionRepository.
+type sessionRepository struct {
+	db *bolt.DB
+}
+
+func (r *sessionRepository) Get(key string) (*models.Session, error) {
+	session := new(models.Session)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return get(tx, sessionBucket, []byte(key), session)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *sessionRepository) Save(key string, session *models.Session) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, sessionBucket, []byte(key), session)
+	})
+}
+
+func (r *sessionRepository) Delete(key string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return remove(tx, sessionBucket, []byte(key))
+	})
+}
+
+func (r *sessionRepository) DeleteExpired(now time.Time) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		expired := make([][]byte, 0)
+		err := tx.Bucket(sessionBucket).ForEach(func(k, v []byte) error {
+			var session models.Session
+			if err := json.Unmarshal(v, &session); err != nil || session.Expires.Before(now) {
+				expired = append(expired, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := tx.Bucket(sessionBucket).Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// tokenRepository implements TokenRepository.
+type tokenRepository struct {
+	db *bolt.DB
+}
+
+func (r *tokenRepository) Get(id string) (*models.ApiToken, error) {
+	token := new(models.ApiToken)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return get(tx, tokenBucket, []byte(id), token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *tokenRepository) List(username string) ([]models.ApiToken, error) {
+	tokens := make([]models.ApiToken, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return each(tx, tokenBucket, func(decode func(v interface{}) error) error {
+			var token models.ApiToken
+			if err := decode(&token); err != nil {
+				return err
+			}
+			if strings.EqualFold(token.Username, username) {
+				tokens = append(tokens, token)
+			}
+			return nil
+		})
+	})
+	return tokens, err
+}
+
+func (r *tokenRepository) Save(token *models.ApiToken) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, tokenBucket, []byte(token.Id), token)
+	})
+}
+
+func (r *tokenRepository) Delete(id string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return remove(tx, tokenBucket, []byte(id))
+	})
+}
+
+// deleteOwned removes every record in the bucket whose `username` field matches.
+func deleteOwned(tx *bolt.Tx, bucket []byte, username string) error {
+	owned := make([][]byte, 0)
+	err := tx.Bucket(bucket).ForEach(func(k, v []byte) error {
+		var owner struct {
+			Username string `json:"username"`
+		}
+		if err := json.Unmarshal(v, &owner); err == nil && strings.EqualFold(owner.Username, username) {
+			owned = append(owned, append([]byte{}, k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range owned {
+		if err := tx.Bucket(bucket).Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
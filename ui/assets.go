@@ -0,0 +1,185 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package ui serves the compiled Angular application. The contents of
+// ui/dist/mex are embedded into the executable when it is built, so `make ui`
+// must run before `go build` for the UI to be included.
+package ui
+
+import (
+	"bytes"
+	"embed"
+	"github.com/MediaExchange/log"
+	"github.com/MediaExchange/router"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// Entry point of the single page application.
+	indexFile = "index.html"
+
+	// Cache-Control values for fingerprinted bundles and everything else.
+	immutableCache = "public, max-age=31536000, immutable"
+	revalidateCache = "no-cache"
+)
+
+var (
+	// Output of the Angular build. The `all:` prefix includes dist/.gitkeep so
+	// the directive still compiles in a fresh checkout before the UI is built.
+	//go:embed all:dist
+	embedded embed.FS
+
+	// Angular production builds add a content hash to bundle names, e.g. main.6f3c2a9d1e8b7c40.js
+	hashedRE = regexp.MustCompile(`\.[0-9a-f]{16,20}\.[a-z0-9]+$`)
+
+	// Precompressed variants, in order of preference.
+	encodings = []struct {
+		name string
+		ext  string
+	}{
+		{"br", ".br"},
+		{"gzip", ".gz"},
+	}
+)
+
+// Handler returns a router handler that serves the UI. When dir is not empty
+// the files are read from that directory instead of the built-in assets,
+// which is useful while working on the UI with `ng build --watch`.
+func Handler(dir string) router.Handler {
+	var files fs.FS
+	if len(dir) > 0 {
+		log.Info("ui.Handler: serving UI from directory", log.String("dir", dir))
+		files = os.DirFS(dir)
+	} else {
+		files = assets()
+		if !exists(files, indexFile) {
+			log.Warn("ui.Handler: the UI was not built into this executable; run `make ui` before building")
+		}
+	}
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+		serve(files, writer, request)
+	}
+}
+
+// assets returns the UI files compiled into the executable.
+func assets() fs.FS {
+	files, err := fs.Sub(embedded, "dist/mex")
+	if err != nil {
+		// Only possible if the embed directive above is changed without updating the path here.
+		panic(err)
+	}
+	return files
+}
+
+// serve writes a single file from the UI assets to the client.
+func serve(files fs.FS, writer http.ResponseWriter, request *http.Request) {
+	// Unknown API routes should not be answered with the UI.
+	if strings.HasPrefix(request.URL.Path, "/api/") {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/" + request.URL.Path), "/")
+	if len(name) == 0 {
+		name = indexFile
+	}
+
+	// Deep links such as /downloads are routes inside the Angular application,
+	// not files. Anything without a file extension falls back to index.html.
+	if !exists(files, name) {
+		if len(path.Ext(name)) > 0 {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		name = indexFile
+	}
+
+	if hashedRE.MatchString(name) {
+		writer.Header().Set("Cache-Control", immutableCache)
+	} else {
+		writer.Header().Set("Cache-Control", revalidateCache)
+	}
+
+	if ct := mime.TypeByExtension(path.Ext(name)); len(ct) > 0 {
+		writer.Header().Set("Content-Type", ct)
+	}
+
+	// Prefer a precompressed sibling when the client accepts it.
+	writer.Header().Add("Vary", "Accept-Encoding")
+	accept := request.Header.Get("Accept-Encoding")
+	for _, e := range encodings {
+		if strings.Contains(accept, e.name) && exists(files, name + e.ext) {
+			writer.Header().Set("Content-Encoding", e.name)
+			name = name + e.ext
+			break
+		}
+	}
+
+	f, content, modTime, err := open(files, name)
+	if err != nil {
+		log.Error("ui.serve: unable to open asset", log.String("name", name), log.Err(err))
+		writer.Header().Del("Content-Encoding")
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	defer f.Close()
+
+	http.ServeContent(writer, request, name, modTime, content)
+}
+
+// exists returns true when name is a regular file in files.
+func exists(files fs.FS, name string) bool {
+	info, err := fs.Stat(files, name)
+	return err == nil && !info.IsDir()
+}
+
+// open returns a seekable reader for the named asset along with its
+// modification time. The caller must close the returned file.
+func open(files fs.FS, name string) (fs.File, io.ReadSeeker, time.Time, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, time.Time{}, err
+	}
+
+	// Both embedded and on-disk files are seekable. The fallback only exists for other fs.FS implementations.
+	if rs, ok := f.(io.ReadSeeker); ok {
+		return f, rs, info.ModTime(), nil
+	}
+
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, time.Time{}, err
+	}
+	return f, bytes.NewReader(buf), info.ModTime(), nil
+}
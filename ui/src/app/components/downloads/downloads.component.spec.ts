@@ -1,4 +1,6 @@
 import { async, ComponentFixture, TestBed } from '@angular/core/testing';
+import { HttpClientTestingModule } from '@angular/common/http/testing';
+import { ClarityModule } from '@clr/angular';
 
 import { DownloadsComponent } from './downloads.component';
 
@@ -8,6 +10,7 @@ describe('DownloadsComponent', () => {
 
   beforeEach(async(() => {
     TestBed.configureTestingModule({
+      imports: [ ClarityModule, HttpClientTestingModule ],
       declarations: [ DownloadsComponent ]
     })
     .compileComponents();
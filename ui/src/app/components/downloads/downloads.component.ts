@@ -1,15 +1,62 @@
-import { Component, OnInit } from '@angular/core';
+import { Component, OnDestroy, OnInit } from '@angular/core';
+import { interval, Subscription } from 'rxjs';
+import { startWith, switchMap } from 'rxjs/operators';
+import { Download } from '../../models/download';
+import { DownloadsService } from '../../services/downloads.service';
 
 @Component({
   selector: 'app-downloads',
   templateUrl: './downloads.component.html',
   styleUrls: ['./downloads.component.less']
 })
-export class DownloadsComponent implements OnInit {
+export class DownloadsComponent implements OnDestroy, OnInit {
+  private refresh: Subscription;
+  public downloads: Array<Download> = [];
 
-  constructor() { }
+  // DI Constructor
+  constructor(private downloadsService: DownloadsService) { }
+
+  ngOnDestroy() {
+    // Have to unsubscribe to prevent memory leaks.
+    if (this.refresh) {
+      this.refresh.unsubscribe();
+    }
+  }
 
   ngOnInit() {
+    // The server polls the download clients; this only picks up its latest copy.
+    this.refresh = interval(5000).pipe(
+        startWith(0),
+        switchMap(() => this.downloadsService.list())
+    ).subscribe(
+        (data: Download[]) => {
+          this.downloads = data;
+        },
+        (err: any) => {
+          console.error(err);
+        });
+  }
+
+  public action(d: Download, action: string) {
+    this.downloadsService.action(d.id, action)
+        .subscribe(
+            () => this.reload(),
+            (err: any) => {
+              console.error(err);
+            });
   }
 
+  public remove(d: Download, deleteData: boolean) {
+    this.downloadsService.remove(d.id, deleteData)
+        .subscribe(
+            () => this.reload(),
+            (err: any) => {
+              console.error(err);
+            });
+  }
+
+  private reload() {
+    this.downloadsService.list()
+        .subscribe((data: Download[]) => this.downloads = data);
+  }
 }
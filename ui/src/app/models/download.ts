@@ -0,0 +1,60 @@
+export class Download {
+    // ID of the download in the format `client:id`.
+    id: string;
+
+    // Name of the download client handling the download.
+    client: string;
+
+    // Name of the release being downloaded.
+    name: string;
+
+    // queued, checking, downloading, paused, seeding, completed, failed or removed.
+    status: string;
+
+    // Fraction complete, from 0 to 1.
+    progress: number;
+
+    // Total size in bytes.
+    size: number;
+
+    // Download speed in bytes per second.
+    downloadSpeed: number;
+
+    // Seconds until complete, or -1 if unknown.
+    eta: number;
+
+    // Why the download failed, if it did.
+    error: string;
+
+    // Library item being downloaded, if known.
+    media: {id: string, title: string, year: number};
+
+    // constructor accepts an object and copies the fields into the new Download instance.
+    constructor(obj?: any) {
+        Object.assign(this, obj);
+    }
+
+    // getTitle returns the library title if known, otherwise the release name.
+    getTitle() {
+        if (this.media) {
+            return this.media.year > 0 ? `${this.media.title} (${this.media.year})` : this.media.title;
+        }
+        return this.name;
+    }
+
+    // getEta formats the time remaining as h:mm:ss.
+    getEta() {
+        if (this.eta < 0 || this.status !== 'downloading') {
+            return '';
+        }
+        const h = Math.floor(this.eta / 3600);
+        const m = Math.floor(this.eta % 3600 / 60);
+        const s = this.eta % 60;
+        return `${h}:${m.toString().padStart(2, '0')}:${s.toString().padStart(2, '0')}`;
+    }
+
+    // canRetry returns true if the download can be sent to its client again.
+    canRetry() {
+        return this.status === 'failed' || this.status === 'removed';
+    }
+}
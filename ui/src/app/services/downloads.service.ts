@@ -0,0 +1,36 @@
+import {Injectable} from '@angular/core';
+import {HttpClient, HttpHeaders, HttpParams} from '@angular/common/http';
+import {Observable} from 'rxjs';
+import {map} from 'rxjs/operators';
+import {Download} from '../models/download';
+
+@Injectable({
+    providedIn: 'root'
+})
+export class DownloadsService {
+    private downloadsUrl = 'http://localhost:9000/api/downloads';
+
+    constructor(private http: HttpClient) {
+    }
+
+    list(): Observable<Array<Download>> {
+        const headers = new HttpHeaders()
+            .append('Accept', 'application/json');
+        return this.http.get<Array<Download>>(this.downloadsUrl, {headers}).pipe(
+            map(res => res.map(d => new Download(d)))
+        );
+    }
+
+    // action runs pause, resume or retry on a download.
+    action(id: string, action: string): Observable<Download> {
+        return this.http.post<Download>(`${this.downloadsUrl}/${encodeURIComponent(id)}/${action}`, null).pipe(
+            map(d => new Download(d))
+        );
+    }
+
+    remove(id: string, deleteData: boolean): Observable<any> {
+        const params = new HttpParams()
+            .append('deleteData', String(deleteData));
+        return this.http.delete(`${this.downloadsUrl}/${encodeURIComponent(id)}`, {params});
+    }
+}
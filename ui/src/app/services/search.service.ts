@@ -18,8 +18,9 @@ export class SearchService {
             .append('Accept', 'application/json');
         const params = new HttpParams()
             .append('q', name);
-        return this.http.get<Array<SearchResult>>(this.searchUrl, {headers, params}).pipe(
-            map(a => a.map(r => new SearchResult(r)))
+        // The response also lists which providers were unavailable; only the results are used here.
+        return this.http.get<{results: Array<SearchResult>}>(this.searchUrl, {headers, params}).pipe(
+            map(res => res.results.map(r => new SearchResult(r)))
         );
     }
 }
@@ -0,0 +1,30 @@
+/*
+   Copyright 2019 Paul Howes
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package version holds information about the build. The variables are set
+// by the linker, e.g. `go build -ldflags "-X github.com/MediaExchange/mex/version.Commit=abc123"`.
+package version
+
+var (
+	// Version is the release version of MEX.
+	Version = "dev"
+
+	// Commit is the git commit hash the executable was built from.
+	Commit = "unknown"
+
+	// BuildDate is when the executable was built, in RFC 3339 format.
+	BuildDate = "unknown"
+)